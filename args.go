@@ -0,0 +1,351 @@
+package planetscale
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bindVariable is a query argument in the form the Execute API expects.
+// Value holds the argument's MySQL text representation and is base64
+// encoded by encoding/json.
+type bindVariable struct {
+	Type  string `json:"type"`
+	Value []byte `json:"value,omitempty"`
+}
+
+// bindVars maps bind variable names, without the leading colon, to values.
+type bindVars map[string]bindVariable
+
+const mysqlDatetimeFormat = "2006-01-02 15:04:05.999999"
+
+// newBindVariable converts a value produced by convertArg to a bind
+// variable. Times are sent in loc.
+func newBindVariable(v driver.Value, loc *time.Location) (bindVariable, error) {
+	switch v := v.(type) {
+	case nil:
+		return bindVariable{Type: "NULL_TYPE"}, nil
+	case int64:
+		return bindVariable{Type: "INT64", Value: strconv.AppendInt(nil, v, 10)}, nil
+	case uint64:
+		return bindVariable{Type: "UINT64", Value: strconv.AppendUint(nil, v, 10)}, nil
+	case float64:
+		return bindVariable{Type: "FLOAT64", Value: strconv.AppendFloat(nil, v, 'g', -1, 64)}, nil
+	case bool:
+		if v {
+			return bindVariable{Type: "INT64", Value: []byte("1")}, nil
+		}
+		return bindVariable{Type: "INT64", Value: []byte("0")}, nil
+	case []byte:
+		return bindVariable{Type: "VARBINARY", Value: v}, nil
+	case string:
+		return bindVariable{Type: "VARCHAR", Value: []byte(v)}, nil
+	case time.Time:
+		return bindVariable{Type: "DATETIME", Value: []byte(v.In(loc).Format(mysqlDatetimeFormat))}, nil
+	default:
+		return bindVariable{}, fmt.Errorf("unsupported argument type %T", v)
+	}
+}
+
+var _ driver.NamedValueChecker = (*PsConn)(nil)
+
+// CheckNamedValue converts query arguments with convertArg, instead of
+// database/sql's default conversion, which rejects large unsigned integers
+// and Valuers that return them.
+func (c *PsConn) CheckNamedValue(nv *driver.NamedValue) error {
+	v, err := convertArg(nv.Value)
+	if err != nil {
+		return err
+	}
+	nv.Value = v
+	return nil
+}
+
+// convertArg converts a query argument to a value newBindVariable accepts.
+// It follows driver.DefaultParameterConverter, which handles times, bools,
+// byte slices and the other driver.Value types, as well as pointers and
+// types whose underlying type is one of them, with a few exceptions:
+// json.RawMessage arguments become strings, unsigned integers are kept as
+// uint64, which the default conversion rejects once the high bit is set, and
+// the values of driver.Valuer types are converted the same way, so a Valuer
+// may return any type convertArg accepts.
+func convertArg(v interface{}) (driver.Value, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case json.RawMessage:
+		if v == nil {
+			return nil, nil
+		}
+		return string(v), nil
+	case uint64:
+		return v, nil
+	case driver.Valuer:
+		rv := reflect.ValueOf(v)
+		if rv.Kind() == reflect.Pointer && rv.IsNil() && rv.Type().Elem().Implements(valuerType) {
+			// A nil pointer to a type with a value receiver Value
+			// method is NULL, as database/sql treats it.
+			return nil, nil
+		}
+		sv, err := v.Value()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := sv.(driver.Valuer); ok {
+			return nil, fmt.Errorf("%T.Value returned another driver.Valuer, %T", v, sv)
+		}
+		return convertArg(sv)
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer:
+		if rv.IsNil() {
+			return nil, nil
+		}
+		return convertArg(rv.Elem().Interface())
+	case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		return rv.Uint(), nil
+	}
+	return driver.DefaultParameterConverter.ConvertValue(v)
+}
+
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+// parsedQuery is a query with its ? placeholders rewritten to the :v1,
+// :v2... bind variables the Execute API understands.
+type parsedQuery struct {
+	query        string
+	placeholders int
+}
+
+// parseQuery rewrites the ? placeholders in query. Placeholders inside quoted
+// strings, identifiers and comments are left alone.
+func parseQuery(query string) parsedQuery {
+	var b strings.Builder
+	b.Grow(len(query))
+
+	n := 0
+	for i := 0; i < len(query); i++ {
+		if end := skipLiteral(query, i); end > i {
+			b.WriteString(query[i:end])
+			i = end - 1
+			continue
+		}
+
+		if query[i] == '?' {
+			n++
+			b.WriteString(":v")
+			b.WriteString(strconv.Itoa(n))
+		} else {
+			b.WriteByte(query[i])
+		}
+	}
+
+	return parsedQuery{query: b.String(), placeholders: n}
+}
+
+// splitStatements splits query into its semicolon separated statements.
+// Semicolons inside quoted strings, identifiers and comments don't end a
+// statement, and empty statements are dropped.
+func splitStatements(query string) []string {
+	var stmts []string
+
+	start := 0
+	for i := 0; i <= len(query); i++ {
+		if i < len(query) {
+			if end := skipLiteral(query, i); end > i {
+				i = end - 1
+				continue
+			}
+			if query[i] != ';' {
+				continue
+			}
+		}
+
+		if stmt := strings.TrimSpace(query[start:i]); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+		start = i + 1
+	}
+
+	return stmts
+}
+
+// normalizeQuery collapses the whitespace in query outside of quoted strings,
+// identifiers and comments, so queries that differ only in formatting are
+// the same.
+func normalizeQuery(query string) string {
+	var b strings.Builder
+	b.Grow(len(query))
+
+	space := false
+	for i := 0; i < len(query); i++ {
+		if end := skipLiteral(query, i); end > i {
+			b.WriteString(query[i:end])
+			i, space = end-1, false
+			continue
+		}
+
+		switch query[i] {
+		case ' ', '\t', '\r', '\n':
+			if !space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			space = true
+		default:
+			b.WriteByte(query[i])
+			space = false
+		}
+	}
+
+	return strings.TrimRight(b.String(), " ")
+}
+
+// skipLiteral returns the index just past the quoted string, identifier or
+// comment that starts at query[i], or i if there is none there.
+func skipLiteral(query string, i int) int {
+	switch ch := query[i]; {
+	case ch == '\'' || ch == '"' || ch == '`':
+		return skipQuoted(query, i)
+	case ch == '#' || (ch == '-' && strings.HasPrefix(query[i:], "-- ")):
+		end := strings.IndexByte(query[i:], '\n')
+		if end < 0 {
+			return len(query)
+		}
+		return i + end
+	case ch == '/' && strings.HasPrefix(query[i:], "/*"):
+		end := strings.Index(query[i+2:], "*/")
+		if end < 0 {
+			return len(query)
+		}
+		return i + end + 4
+	default:
+		return i
+	}
+}
+
+// bind converts args to bind variables for q, with times in loc. Positional
+// arguments fill the placeholders in order. Named arguments are bound by name
+// and are referenced in the query as :name.
+func (q parsedQuery) bind(args []driver.NamedValue, loc *time.Location) (bindVars, error) {
+	binds := make(bindVars, len(args))
+
+	n := 0
+	for _, arg := range args {
+		name := arg.Name
+		if name == "" {
+			n++
+			name = "v" + strconv.Itoa(n)
+		}
+
+		bv, err := newBindVariable(arg.Value, loc)
+		if err != nil {
+			return nil, fmt.Errorf("argument %s: %w", name, err)
+		}
+		binds[name] = bv
+	}
+
+	if n != q.placeholders {
+		return nil, fmt.Errorf("query has %d placeholders but %d arguments were given", q.placeholders, n)
+	}
+
+	return binds, nil
+}
+
+// interpolate replaces the bind variables referenced in query with binds'
+// values as MySQL literals. References inside quoted strings, identifiers
+// and comments, and to variables that aren't bound, are left alone.
+func interpolate(query string, binds bindVars) string {
+	var b strings.Builder
+	b.Grow(len(query))
+
+	for i := 0; i < len(query); i++ {
+		if end := skipLiteral(query, i); end > i {
+			b.WriteString(query[i:end])
+			i = end - 1
+			continue
+		}
+
+		if query[i] == ':' && i+1 < len(query) && isBindNameStart(query[i+1]) && (i == 0 || query[i-1] != ':') {
+			end := i + 2
+			for end < len(query) && isIdentByte(query[end]) {
+				end++
+			}
+			if bv, ok := binds[query[i+1:end]]; ok {
+				appendLiteral(&b, bv)
+				i = end - 1
+				continue
+			}
+		}
+		b.WriteByte(query[i])
+	}
+
+	return b.String()
+}
+
+func isBindNameStart(ch byte) bool {
+	return ch == '_' || 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z'
+}
+
+// appendLiteral writes bv as a MySQL literal. Strings and times are quoted
+// and escaped with backslashes, the way go-sql-driver/mysql does without
+// NO_BACKSLASH_ESCAPES, and binary values are _binary strings.
+func appendLiteral(b *strings.Builder, bv bindVariable) {
+	switch bv.Type {
+	case "NULL_TYPE":
+		b.WriteString("NULL")
+		return
+	case "INT64", "UINT64", "FLOAT64":
+		b.Write(bv.Value)
+		return
+	case "VARBINARY":
+		b.WriteString("_binary")
+	}
+
+	b.WriteByte('\'')
+	for _, ch := range bv.Value {
+		switch ch {
+		case 0:
+			b.WriteString(`\0`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\x1a':
+			b.WriteString(`\Z`)
+		case '\'', '"', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(ch)
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	b.WriteByte('\'')
+}
+
+// skipQuoted returns the index just past the quoted string, identifier or
+// literal that starts at query[start]. Quotes are escaped by doubling them or,
+// except in identifiers, with a backslash.
+func skipQuoted(query string, start int) int {
+	quote := query[start]
+	for i := start + 1; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			if quote != '`' {
+				i++
+			}
+		case quote:
+			if i+1 < len(query) && query[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(query)
+}
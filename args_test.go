@@ -0,0 +1,223 @@
+package planetscale
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBindArgs(t *testing.T) {
+	q := parseQuery("SELECT * FROM t WHERE a = ? AND b = '?' AND `c?` = ? /* ? */ AND d = :name -- ?")
+
+	want := "SELECT * FROM t WHERE a = :v1 AND b = '?' AND `c?` = :v2 /* ? */ AND d = :name -- ?"
+	if q.query != want || q.placeholders != 2 {
+		t.Fatalf("expected %q with 2 placeholders, got %q with %d", want, q.query, q.placeholders)
+	}
+
+	binds, err := q.bind([]driver.NamedValue{
+		{Ordinal: 1, Value: int64(42)},
+		{Ordinal: 2, Value: "it's"},
+		{Name: "name", Ordinal: 3, Value: nil},
+	}, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bv := binds["v1"]; bv.Type != "INT64" || string(bv.Value) != "42" {
+		t.Fatalf("unexpected v1 %+v", bv)
+	}
+	if bv := binds["v2"]; bv.Type != "VARCHAR" || string(bv.Value) != "it's" {
+		t.Fatalf("unexpected v2 %+v", bv)
+	}
+	if bv := binds["name"]; bv.Type != "NULL_TYPE" || bv.Value != nil {
+		t.Fatalf("unexpected name %+v", bv)
+	}
+}
+
+func TestBindArgsCountMismatch(t *testing.T) {
+	one := []driver.NamedValue{{Ordinal: 1, Value: int64(1)}}
+
+	if _, err := parseQuery("SELECT ?, ?").bind(one, time.UTC); err == nil {
+		t.Fatal("expected error for too few arguments")
+	}
+	if _, err := parseQuery("SELECT 'x?'").bind(one, time.UTC); err == nil {
+		t.Fatal("expected error for too many arguments")
+	}
+}
+
+func TestBindVariableTypes(t *testing.T) {
+	ts := time.Date(2023, 2, 8, 1, 28, 32, 500000000, time.UTC)
+
+	for _, tt := range []struct {
+		value driver.Value
+		typ   string
+		text  string
+	}{
+		{1.5, "FLOAT64", "1.5"},
+		{uint64(18446744073709551615), "UINT64", "18446744073709551615"},
+		{true, "INT64", "1"},
+		{false, "INT64", "0"},
+		{[]byte{0, 1}, "VARBINARY", "\x00\x01"},
+		{ts, "DATETIME", "2023-02-08 01:28:32.5"},
+	} {
+		bv, err := newBindVariable(tt.value, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bv.Type != tt.typ || string(bv.Value) != tt.text {
+			t.Errorf("%v: expected %s %q, got %s %q", tt.value, tt.typ, tt.text, bv.Type, bv.Value)
+		}
+	}
+
+	bv, err := newBindVariable(ts, time.FixedZone("UTC+2", 2*60*60))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "2023-02-08 03:28:32.5"; string(bv.Value) != want {
+		t.Errorf("expected time in loc %q, got %q", want, bv.Value)
+	}
+}
+
+type jsonValuer struct{ doc string }
+
+func (v jsonValuer) Value() (driver.Value, error) {
+	return json.RawMessage(v.doc), nil
+}
+
+type accountID uint64
+
+func TestConvertArg(t *testing.T) {
+	ts := time.Date(2023, 2, 8, 1, 28, 32, 0, time.UTC)
+	n := int32(7)
+	var nilValuer *jsonValuer
+
+	for _, tt := range []struct {
+		arg  interface{}
+		want driver.Value
+	}{
+		{ts, ts},
+		{true, true},
+		{[]byte("b"), []byte("b")},
+		{json.RawMessage(`{"a":1}`), `{"a":1}`},
+		{json.RawMessage(nil), nil},
+		{uint64(1 << 63), uint64(1 << 63)},
+		{accountID(1 << 63), uint64(1 << 63)},
+		{&n, int64(7)},
+		{(*int32)(nil), nil},
+		{jsonValuer{`[1]`}, `[1]`},
+		{nilValuer, nil},
+		{sql.NullString{String: "s", Valid: true}, "s"},
+		{sql.NullTime{}, nil},
+	} {
+		got, err := convertArg(tt.arg)
+		if err != nil {
+			t.Fatalf("%#v: %v", tt.arg, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%#v: expected %#v, got %#v", tt.arg, tt.want, got)
+		}
+		if _, err := newBindVariable(got, time.UTC); err != nil {
+			t.Errorf("%#v: %v", tt.arg, err)
+		}
+	}
+
+	if _, err := convertArg(struct{}{}); err == nil {
+		t.Fatal("expected error converting a struct")
+	}
+}
+
+func TestQueryContextSendsBindVariables(t *testing.T) {
+	var query, value, typ string
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		v := parseJSON(t, string(body))
+		query = string(v.GetStringBytes("query"))
+		typ = string(v.GetStringBytes("bindVariables", "v1", "type"))
+		value = string(v.GetStringBytes("bindVariables", "v1", "value"))
+		return 200, `{"session":{},"result":{"fields":[],"rows":[]}}`
+	})
+
+	_, err := c.QueryContext(context.Background(), "SELECT * FROM user WHERE id = ?", []driver.NamedValue{
+		{Ordinal: 1, Value: int64(7)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if query != "SELECT * FROM user WHERE id = :v1" {
+		t.Fatalf("unexpected query %q", query)
+	}
+	if typ != "INT64" || value != base64.StdEncoding.EncodeToString([]byte("7")) {
+		t.Fatalf("unexpected bind variable %s %q", typ, value)
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	stmts := splitStatements("INSERT INTO t VALUES ('a;b'); /* ; */ UPDATE `t;` SET a = 1 -- ;\n;; SELECT \";\" ;")
+
+	want := []string{
+		"INSERT INTO t VALUES ('a;b')",
+		"/* ; */ UPDATE `t;` SET a = 1 -- ;",
+		`SELECT ";"`,
+	}
+	if len(stmts) != len(want) {
+		t.Fatalf("expected %d statements, got %q", len(want), stmts)
+	}
+	for i := range want {
+		if stmts[i] != want[i] {
+			t.Fatalf("statement %d: expected %q, got %q", i, want[i], stmts[i])
+		}
+	}
+}
+
+func TestNormalizeQuery(t *testing.T) {
+	got := normalizeQuery("  SELECT a,\n\t b  FROM t WHERE c = 'x  y' /* a  b */   ")
+	if want := "SELECT a, b FROM t WHERE c = 'x  y' /* a  b */"; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	q := parseQuery("SELECT * FROM t WHERE a = ? AND b = ? AND c = ? AND d = ? AND e = ':v1' AND f = :name AND g = :missing AND @x := 1")
+	binds, err := q.bind([]driver.NamedValue{
+		{Ordinal: 1, Value: int64(-7)},
+		{Ordinal: 2, Value: "it's a \"q\" \\ \n\x00\x1a"},
+		{Ordinal: 3, Value: []byte{0, 'x'}},
+		{Ordinal: 4, Value: time.Date(2023, 2, 8, 1, 28, 32, 0, time.UTC)},
+		{Name: "name", Ordinal: 5, Value: nil},
+	}, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := interpolate(q.query, binds)
+	want := `SELECT * FROM t WHERE a = -7 AND b = 'it\'s a \"q\" \\ \n\0\Z' AND c = _binary'\0x' AND d = '2023-02-08 01:28:32' AND e = ':v1' AND f = NULL AND g = :missing AND @x := 1`
+	if got != want {
+		t.Fatalf("expected\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestInterpolateParamsSendsNoBindVariables(t *testing.T) {
+	var query string
+	var hasBinds bool
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		v := parseJSON(t, string(body))
+		query = string(v.GetStringBytes("query"))
+		hasBinds = v.Exists("bindVariables")
+		return 200, `{"session":{},"result":{"fields":[],"rows":[]}}`
+	})
+	c.cfg.InterpolateParams = true
+
+	if _, err := c.QueryContext(context.Background(), "SELECT * FROM user WHERE name = ?", []driver.NamedValue{
+		{Ordinal: 1, Value: "o'brien"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if query != `SELECT * FROM user WHERE name = 'o\'brien'` || hasBinds {
+		t.Fatalf("unexpected query %q with bind variables %v", query, hasBinds)
+	}
+}
@@ -0,0 +1,101 @@
+package planetscale
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Connection attributes are sent as a sqlcommenter comment at the end of
+// every query, such as /*service='checkout',fastly_pop='LHR'*/, which
+// PlanetScale Insights reads as query tags. The psdb API has no way to attach
+// them to a session itself.
+
+// fastlyAttributeEnv maps the attributes FastlyAttributes reports to the
+// environment variables Compute sets for them.
+var fastlyAttributeEnv = map[string]string{
+	"fastly_service_id":      "FASTLY_SERVICE_ID",
+	"fastly_service_version": "FASTLY_SERVICE_VERSION",
+	"fastly_pop":             "FASTLY_POP",
+}
+
+// FastlyAttributes returns connection attributes identifying the Compute
+// service running the driver: its service ID, version and the POP it is
+// running in. Attributes whose environment variable isn't set, such as when
+// running outside of Compute, are left out.
+func FastlyAttributes() map[string]string {
+	attrs := make(map[string]string, len(fastlyAttributeEnv))
+	for key, env := range fastlyAttributeEnv {
+		if v := os.Getenv(env); v != "" {
+			attrs[key] = v
+		}
+	}
+	return attrs
+}
+
+// queryTags formats attrs as a sqlcommenter comment, with the keys sorted so
+// the same attributes always tag queries the same way. Keys and values are
+// URL encoded, which also escapes the quotes and asterisks that could end the
+// value or the comment early.
+func queryTags(attrs map[string]string) string {
+	if len(attrs) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("/*")
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(url.PathEscape(k))
+		b.WriteString("='")
+		b.WriteString(url.PathEscape(attrs[k]))
+		b.WriteByte('\'')
+	}
+	b.WriteString("*/")
+	return b.String()
+}
+
+// tagQuery appends the tags comment to query. A trailing semicolon is dropped
+// so the comment stays part of the statement, and a query that ends in a
+// line comment gets the tags on a line of their own.
+func tagQuery(query, tags string) string {
+	if tags == "" {
+		return query
+	}
+
+	line := false
+	for i := 0; i < len(query); i++ {
+		if end := skipLiteral(query, i); end > i {
+			line = end == len(query) && (query[i] == '#' || query[i] == '-')
+			i = end - 1
+		}
+	}
+	if line {
+		return query + "\n" + tags
+	}
+	return strings.TrimRight(query, "; \t\r\n") + " " + tags
+}
+
+// parseAttributes parses connection attributes in the key:value,key:value
+// form of the connectionAttributes DSN parameter.
+func parseAttributes(s string) (map[string]string, error) {
+	attrs := make(map[string]string)
+	for _, attr := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(attr, ":")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("error parsing dsn: invalid connection attribute %q", attr)
+		}
+		attrs[k] = v
+	}
+	return attrs, nil
+}
@@ -0,0 +1,69 @@
+package planetscale
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTagQuery(t *testing.T) {
+	tags := queryTags(map[string]string{"service": "checkout", "fastly_pop": "LHR", "note": "it's */ done"})
+	if want := `/*fastly_pop='LHR',note='it%27s%20%2A%2F%20done',service='checkout'*/`; tags != want {
+		t.Fatalf("expected %s, got %s", want, tags)
+	}
+
+	for query, want := range map[string]string{
+		"SELECT 1":                      "SELECT 1 " + tags,
+		"SELECT 1;\n":                   "SELECT 1 " + tags,
+		"SELECT ';'":                    "SELECT ';' " + tags,
+		"SELECT 1 -- why":               "SELECT 1 -- why\n" + tags,
+		"SELECT 1 # why":                "SELECT 1 # why\n" + tags,
+		"SELECT 1 /* a */":              "SELECT 1 /* a */ " + tags,
+		"SELECT '-- not a comment' + 1": "SELECT '-- not a comment' + 1 " + tags,
+	} {
+		if got := tagQuery(query, tags); got != want {
+			t.Errorf("%q: expected %q, got %q", query, want, got)
+		}
+	}
+
+	if got := tagQuery("SELECT 1;", ""); got != "SELECT 1;" {
+		t.Fatalf("expected query without attributes unchanged, got %q", got)
+	}
+}
+
+func TestFastlyAttributes(t *testing.T) {
+	t.Setenv("FASTLY_SERVICE_ID", "svc123")
+	t.Setenv("FASTLY_SERVICE_VERSION", "42")
+	t.Setenv("FASTLY_POP", "")
+
+	attrs := FastlyAttributes()
+	if len(attrs) != 2 || attrs["fastly_service_id"] != "svc123" || attrs["fastly_service_version"] != "42" {
+		t.Fatalf("unexpected attributes %v", attrs)
+	}
+}
+
+func TestConnectionAttributesTagQueries(t *testing.T) {
+	cfg, err := ParseDSN("username=u&password=p&host=h&backend=b&connectionAttributes=service:checkout,team:payments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	WithConnectionAttributes(map[string]string{"team": "billing"})(cfg)
+
+	var query string
+	c := newConn(*cfg)
+	c.session = []byte("{}")
+	c.send = stubConn(func(endpoint string, body []byte) (int, string) {
+		query = string(parseJSON(t, string(body)).GetStringBytes("query"))
+		return 200, `{"session":{},"result":{"rowsAffected":"1"}}`
+	}).send
+
+	if _, err := c.ExecContext(context.Background(), "DELETE FROM t", nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := "DELETE FROM t /*service='checkout',team='billing'*/"; query != want {
+		t.Fatalf("expected %q, got %q", want, query)
+	}
+
+	if _, err := ParseDSN("host=h&connectionAttributes=nocolon"); err == nil {
+		t.Fatal("expected error parsing an attribute without a value")
+	}
+}
@@ -0,0 +1,164 @@
+package planetscale
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// BackendRegistrar registers a dynamic backend called name that sends
+// requests to target, the PlanetScale host, over TLS. It is called at most
+// once per name within a Compute instance.
+//
+// This version of the Compute SDK doesn't support dynamic backends, so the
+// registration is left to the caller. With an SDK that does, a registrar is
+// typically as below, which is also where the backend's connect and
+// between-bytes timeouts are set:
+//
+//	func(name, target string) error {
+//		opts := fsthttp.NewBackendOptions().UseSSL(true).SNIHostname(target).
+//			ConnectTimeout(time.Second).BetweenBytesTimeout(10 * time.Second)
+//		_, err := fsthttp.RegisterDynamicBackend(name, target, opts)
+//		return err
+//	}
+type BackendRegistrar func(name, target string) error
+
+// dynamicBackends holds the dynamic backends that have been registered, so
+// each is only registered once.
+var dynamicBackends = struct {
+	sync.Mutex
+	registered map[string]bool
+}{registered: make(map[string]bool)}
+
+// dynamicBackendName returns the backend name used for host. Backend names
+// can't contain dots, among other characters, so those are replaced, and a
+// hash of host tells apart hosts that only differ in them.
+func dynamicBackendName(host string) string {
+	sum := sha256.Sum256([]byte(host))
+	return "planetscale_" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, host) + "_" + hex.EncodeToString(sum[:])[:8]
+}
+
+// TLSOptions control the TLS connection a dynamic backend makes to the
+// PlanetScale host, for services with stricter requirements than the
+// backend's defaults. The zero value keeps the defaults.
+type TLSOptions struct {
+	// MinVersion is the oldest TLS version the connection may use: "1.0",
+	// "1.1", "1.2" or "1.3".
+	MinVersion string
+
+	// SNIHostname is the server name sent in the handshake, and
+	// CertHostname the name the host's certificate must be valid for. Both
+	// default to the host, and are only worth setting when connecting
+	// through a proxy or by address.
+	SNIHostname  string
+	CertHostname string
+
+	// CACertificate, if set, is the PEM encoded certificate of the CA the
+	// host's certificate must be issued by, instead of any publicly trusted
+	// one, which pins the connection to that CA.
+	CACertificate string
+}
+
+// validTLSVersion reports an error if v isn't a TLS version MinVersion can
+// be set to.
+func validTLSVersion(v string) error {
+	switch v {
+	case "", "1.0", "1.1", "1.2", "1.3":
+		return nil
+	}
+	return fmt.Errorf("invalid TLS version %q", v)
+}
+
+// id returns a short hash of the options, which tells apart the backends of
+// a host registered with different ones.
+func (o TLSOptions) id() string {
+	h := sha256.New()
+	for _, s := range []string{o.MinVersion, o.SNIHostname, o.CertHostname, o.CACertificate} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:8]
+}
+
+// TLSBackendRegistrar registers a dynamic backend like a BackendRegistrar,
+// with its TLS connection set up as opts describes. With an SDK that
+// supports dynamic backends, a registrar is typically:
+//
+//	func(name, target string, opts planetscale.TLSOptions) error {
+//		b := fsthttp.NewBackendOptions().UseSSL(true).
+//			SNIHostname(target).CertHostname(target)
+//		if opts.SNIHostname != "" {
+//			b.SNIHostname(opts.SNIHostname)
+//		}
+//		if opts.CertHostname != "" {
+//			b.CertHostname(opts.CertHostname)
+//		}
+//		if opts.CACertificate != "" {
+//			b.CACert(opts.CACertificate)
+//		}
+//		versions := map[string]fsthttp.TLSVersion{
+//			"1.0": fsthttp.TLSVersion1_0,
+//			"1.1": fsthttp.TLSVersion1_1,
+//			"1.2": fsthttp.TLSVersion1_2,
+//			"1.3": fsthttp.TLSVersion1_3,
+//		}
+//		if v, ok := versions[opts.MinVersion]; ok {
+//			b.SSLMinVersion(v)
+//		}
+//		_, err := fsthttp.RegisterDynamicBackend(name, target, b)
+//		return err
+//	}
+//
+// A backend declared in the service is configured the same way in its TLS
+// settings instead.
+type TLSBackendRegistrar func(name, target string, opts TLSOptions) error
+
+// backend returns the name of the backend requests are sent to. If no backend
+// is configured and the connection has a BackendRegistrar or
+// TLSBackendRegistrar, a dynamic backend for the host is registered the
+// first time it is needed. The name of a backend with TLS options includes
+// their id, so connections to one host with different options don't share
+// a backend.
+func (c *PsConn) backend() (string, error) {
+	ep := c.currentEndpoint()
+	if ep.Backend != "" || (c.cfg.RegisterBackend == nil && c.cfg.RegisterTLSBackend == nil) {
+		return ep.Backend, nil
+	}
+
+	name := dynamicBackendName(ep.Host)
+	opts := c.cfg.TLS
+	if opts != (TLSOptions{}) {
+		name += "_" + opts.id()
+	}
+
+	dynamicBackends.Lock()
+	defer dynamicBackends.Unlock()
+
+	if dynamicBackends.registered[name] {
+		return name, nil
+	}
+
+	var err error
+	switch {
+	case c.cfg.RegisterTLSBackend != nil:
+		if err = validTLSVersion(opts.MinVersion); err == nil {
+			err = c.cfg.RegisterTLSBackend(name, ep.Host, opts)
+		}
+	case opts != (TLSOptions{}):
+		err = fmt.Errorf("TLS options need a TLSBackendRegistrar")
+	default:
+		err = c.cfg.RegisterBackend(name, ep.Host)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error registering backend for %s: %w", ep.Host, err)
+	}
+	dynamicBackends.registered[name] = true
+	return name, nil
+}
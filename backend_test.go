@@ -0,0 +1,118 @@
+package planetscale
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+)
+
+func TestDynamicBackend(t *testing.T) {
+	var registered []string
+	register := func(name, target string) error {
+		registered = append(registered, name+" "+target)
+		return nil
+	}
+
+	var backends []string
+	for i := 0; i < 2; i++ {
+		c := stubConn(func(endpoint string, body []byte) (int, string) {
+			return 200, `{"session":{},"result":{}}`
+		})
+		send := c.send
+		c.send = func(ctx context.Context, req *fsthttp.Request, backend string) (*fsthttp.Response, error) {
+			backends = append(backends, backend)
+			return send(ctx, req, backend)
+		}
+		WithDynamicBackend(register)(&c.cfg)
+		c.cfg.Host = "dynamic.connect.psdb.cloud"
+
+		if err := c.Ping(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(registered) != 1 || registered[0] != "planetscale_dynamic_connect_psdb_cloud_1de7ab18 dynamic.connect.psdb.cloud" {
+		t.Fatalf("expected the backend to be registered once, got %q", registered)
+	}
+	for _, b := range backends {
+		if b != "planetscale_dynamic_connect_psdb_cloud_1de7ab18" {
+			t.Fatalf("expected requests to use the dynamic backend, got %q", b)
+		}
+	}
+}
+
+func TestDynamicBackendName(t *testing.T) {
+	if a, b := dynamicBackendName("a.b"), dynamicBackendName("a_b"); a == b {
+		t.Fatalf("expected hosts that differ in replaced characters to get different backends, both got %s", a)
+	}
+}
+
+func TestDynamicBackendError(t *testing.T) {
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		return 200, `{"session":{},"result":{}}`
+	})
+	errRegister := errors.New("dynamic backends are disabled")
+	WithDynamicBackend(func(name, target string) error { return errRegister })(&c.cfg)
+	c.cfg.Host = "failing.connect.psdb.cloud"
+
+	if err := c.Ping(context.Background()); !errors.Is(err, errRegister) {
+		t.Fatalf("expected registration error, got %v", err)
+	}
+}
+
+func TestTLSBackend(t *testing.T) {
+	var registered []string
+	register := func(name, target string, opts TLSOptions) error {
+		registered = append(registered, name+" "+target+" "+opts.MinVersion)
+		return nil
+	}
+
+	opts := TLSOptions{MinVersion: "1.3", CertHostname: "tls.connect.psdb.cloud"}
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		return 200, `{"session":{},"result":{}}`
+	})
+	WithTLSBackend(register, opts)(&c.cfg)
+	c.cfg.Host = "tls.connect.psdb.cloud"
+
+	backend, err := c.backend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "planetscale_tls_connect_psdb_cloud_dd94ac57_" + opts.id(); backend != want {
+		t.Fatalf("expected backend %s, got %s", want, backend)
+	}
+	if len(registered) != 1 || registered[0] != backend+" tls.connect.psdb.cloud 1.3" {
+		t.Fatalf("expected the backend to be registered with its options, got %q", registered)
+	}
+
+	c.cfg.TLS.MinVersion = "1.2"
+	if other, err := c.backend(); err != nil || other == backend {
+		t.Fatalf("expected other options to get their own backend, got %s, %v", other, err)
+	}
+
+	c.cfg.TLS.MinVersion = "2"
+	if _, err := c.backend(); err == nil {
+		t.Fatal("expected an invalid TLS version to fail registration")
+	}
+
+	c.cfg.TLS.MinVersion = "1.2"
+	c.cfg.RegisterTLSBackend = nil
+	c.cfg.RegisterBackend = func(name, target string) error { return nil }
+	c.cfg.Host = "plain.connect.psdb.cloud"
+	if _, err := c.backend(); err == nil {
+		t.Fatal("expected TLS options without a TLSBackendRegistrar to fail")
+	}
+
+	if _, err := ParseDSN("mysql://u:p@h/db?minTLSVersion=1.4"); err == nil {
+		t.Fatal("expected an invalid minTLSVersion to be rejected")
+	}
+	cfg, err := ParseDSN("mysql://u:p@h/db?minTLSVersion=1.3&sniHostname=sni.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.TLS.MinVersion != "1.3" || cfg.TLS.SNIHostname != "sni.example" {
+		t.Fatalf("unexpected TLS options %+v", cfg.TLS)
+	}
+}
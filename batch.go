@@ -0,0 +1,95 @@
+package planetscale
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// maxBatchRequests is how many requests of a batch are in flight at once.
+const maxBatchRequests = 16
+
+// Query is a query of a batch, with the arguments bound to its placeholders.
+type Query struct {
+	SQL  string
+	Args []interface{}
+}
+
+// ExecuteBatch runs independent queries at the same time, so a page that
+// needs several small queries waits for about one round trip instead of one
+// per query. The psdb API runs a single statement per request, so each
+// query is its own request; they all start from the client's session, and
+// their results are returned in order.
+//
+// The queries must not depend on each other: changes one makes to the
+// session, such as a SET or USE, aren't seen by the others, and they must
+// not be part of a transaction. Afterwards the client has the session of the
+// last query that succeeded. If any query fails, the error of the first one
+// that did is returned along with the results of the others, which are nil
+// for the queries that failed.
+func (cl *Client) ExecuteBatch(ctx context.Context, queries []Query) ([]*QueryResult, error) {
+	c := cl.conn
+	release, err := c.use()
+	defer release()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.session == nil && !c.cfg.NoAutoRefresh {
+		if err := c.refreshSession(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	conns := make([]*PsConn, len(queries))
+	results := make([]*QueryResult, len(queries))
+	errs := make([]error, len(queries))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxBatchRequests)
+	for i, q := range queries {
+		conns[i] = c.fork()
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, q Query) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i], errs[i] = (&Client{conn: conns[i]}).Execute(ctx, q.SQL, q.Args...)
+		}(i, q)
+	}
+	wg.Wait()
+
+	var first error
+	for i, fc := range conns {
+		if fc.noProtobuf {
+			c.noProtobuf = true
+		}
+		if errs[i] != nil {
+			if first == nil {
+				first = fmt.Errorf("query %d: %w", i, errs[i])
+			}
+			continue
+		}
+		c.session, c.sessionID, c.routing, c.creds = fc.session, fc.sessionID, fc.routing, fc.creds
+	}
+	c.saveSession(ctx)
+
+	return results, first
+}
+
+// fork returns a connection with a copy of c's session and state, which can
+// be used at the same time as c and the other connections forked from it.
+func (c *PsConn) fork() *PsConn {
+	cfg := c.cfg
+	cfg.SessionStore = nil
+
+	fc := newConn(cfg)
+	fc.send, fc.limiter = c.send, c.limiter
+	fc.session = append([]byte(nil), c.session...)
+	fc.sessionID, fc.routing, fc.creds = c.sessionID, c.routing, c.creds
+	fc.noProtobuf, fc.endpoint = c.noProtobuf, c.endpoint
+	return fc
+}
@@ -0,0 +1,67 @@
+package planetscale
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestExecuteBatchRunsQueriesConcurrently(t *testing.T) {
+	const n = 4
+	var mu sync.Mutex
+	arrived := 0
+	all := make(chan struct{})
+
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		query := string(parseJSON(t, string(body)).GetStringBytes("query"))
+
+		// Every request waits for the others, so the batch only finishes
+		// if they are all in flight at once.
+		mu.Lock()
+		if arrived++; arrived == n {
+			close(all)
+		}
+		mu.Unlock()
+		select {
+		case <-all:
+		case <-time.After(5 * time.Second):
+			return 500, "requests weren't concurrent"
+		}
+
+		if query == "SELECT fail" {
+			return 200, `{"session":{},"error":{"code":"INVALID_ARGUMENT","message":"bad query"}}`
+		}
+		return 200, `{"session":{"signature":"` + query + `"},"result":{"fields":[{"name":"v","type":"VARCHAR"}],"rows":[` + rowJSON(query) + `]}}`
+	})
+	c.session = []byte(`{"signature":"start"}`)
+	cl := &Client{conn: c}
+
+	results, err := cl.ExecuteBatch(context.Background(), []Query{
+		{SQL: "SELECT a"},
+		{SQL: "SELECT fail"},
+		{SQL: "SELECT b"},
+		{SQL: "SELECT c"},
+	})
+	var psErr *Error
+	if !errors.As(err, &psErr) || !strings.HasPrefix(err.Error(), "query 1:") {
+		t.Fatalf("expected the error of query 1, got %v", err)
+	}
+
+	for i, want := range []string{"SELECT a", "", "SELECT b", "SELECT c"} {
+		if want == "" {
+			if results[i] != nil {
+				t.Fatalf("expected no result for the failed query, got %+v", results[i])
+			}
+			continue
+		}
+		if got := string(results[i].Rows[0].Values[0]); got != want {
+			t.Fatalf("result %d: expected %q, got %q", i, want, got)
+		}
+	}
+	if string(c.session) != `{"signature":"SELECT c"}` {
+		t.Fatalf("expected the session of the last query, got %s", c.session)
+	}
+}
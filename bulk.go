@@ -0,0 +1,141 @@
+package planetscale
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// DefaultBulkInsertSize is the payload size BulkInsert batches rows up to
+// when it isn't given one.
+const DefaultBulkInsertSize = 1 << 20
+
+// BulkInsert inserts rows into the columns of table with as few multi-row
+// INSERT statements as it can, each holding as many rows as fit in maxBytes
+// of query text and bind variables, or DefaultBulkInsertSize if maxBytes is
+// zero. A row too large to share a statement is inserted on its own. db is
+// typically a *sql.DB or *sql.Tx, and the statements are run in order, so an
+// error leaves the earlier batches inserted unless db is a transaction.
+//
+// BulkInsert returns the total number of rows affected by the statements
+// that succeeded.
+func BulkInsert(ctx context.Context, db Execer, table string, columns []string, rows [][]interface{}, maxBytes int) (int64, error) {
+	batches, err := bulkInsertBatches(table, columns, rows, maxBytes)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, b := range batches {
+		res, err := db.ExecContext(ctx, b.query, b.args...)
+		if err != nil {
+			return total, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// BulkInsert is BulkInsert for a Client. The statements run on the client's
+// session.
+func (cl *Client) BulkInsert(ctx context.Context, table string, columns []string, rows [][]interface{}, maxBytes int) (uint64, error) {
+	batches, err := bulkInsertBatches(table, columns, rows, maxBytes)
+	if err != nil {
+		return 0, err
+	}
+
+	var total uint64
+	for _, b := range batches {
+		qr, err := cl.Execute(ctx, b.query, b.args...)
+		if err != nil {
+			return total, err
+		}
+		total += qr.RowsAffected
+	}
+	return total, nil
+}
+
+// bulkInsert is one INSERT statement of a bulk insert.
+type bulkInsert struct {
+	query string
+	args  []interface{}
+}
+
+// bindVarOverhead approximates the size a bind variable adds to a request
+// beyond its value: its name, type and the JSON around them.
+const bindVarOverhead = len(`"v1000":{"type":"VARBINARY","value":""},`)
+
+// bulkInsertBatches splits rows into INSERT statements of at most maxBytes.
+func bulkInsertBatches(table string, columns []string, rows [][]interface{}, maxBytes int) ([]bulkInsert, error) {
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("bulk insert into %s: no columns", table)
+	}
+	if maxBytes <= 0 {
+		maxBytes = DefaultBulkInsertSize
+	}
+
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = quoteIdentifier(c)
+	}
+	prefix := "INSERT INTO " + quoteIdentifier(table) + " (" + strings.Join(quoted, ", ") + ") VALUES "
+	tuple := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+
+	var batches []bulkInsert
+	var b strings.Builder
+	var args []interface{}
+	size := 0
+
+	flush := func() {
+		if args == nil {
+			return
+		}
+		batches = append(batches, bulkInsert{query: b.String(), args: args})
+		b.Reset()
+		args, size = nil, 0
+	}
+
+	for i, row := range rows {
+		if len(row) != len(columns) {
+			return nil, fmt.Errorf("bulk insert into %s: row %d has %d values for %d columns", table, i, len(row), len(columns))
+		}
+
+		rowSize := len(tuple) + len(", ")
+		for _, v := range row {
+			rowSize += valueSize(v) + bindVarOverhead
+		}
+		if args != nil && size+rowSize > maxBytes {
+			flush()
+		}
+
+		if args == nil {
+			b.WriteString(prefix)
+			size = len(prefix)
+		} else {
+			b.WriteString(", ")
+		}
+		b.WriteString(tuple)
+		args = append(args, row...)
+		size += rowSize
+	}
+	flush()
+
+	return batches, nil
+}
+
+// valueSize approximates the size of v as a bind variable, whose value is
+// base64 encoded.
+func valueSize(v interface{}) int {
+	switch v := v.(type) {
+	case string:
+		return (len(v) + 2) / 3 * 4
+	case []byte:
+		return (len(v) + 2) / 3 * 4
+	default:
+		return len(`"MjAyMy0wMi0wOCAwMToyODozMi41MDAwMDA="`)
+	}
+}
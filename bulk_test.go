@@ -0,0 +1,61 @@
+package planetscale
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestBulkInsertBatches(t *testing.T) {
+	rows := make([][]interface{}, 10)
+	for i := range rows {
+		rows[i] = []interface{}{int64(i), strings.Repeat("x", 100)}
+	}
+
+	batches, err := bulkInsertBatches("user", []string{"id", "name"}, rows, 700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batches) < 2 {
+		t.Fatalf("expected the rows to be split, got %d batch", len(batches))
+	}
+
+	n := 0
+	for _, b := range batches {
+		if !strings.HasPrefix(b.query, "INSERT INTO `user` (`id`, `name`) VALUES (?, ?)") {
+			t.Fatalf("unexpected query %q", b.query)
+		}
+		if got := strings.Count(b.query, "?"); got != len(b.args) {
+			t.Fatalf("query has %d placeholders for %d arguments", got, len(b.args))
+		}
+		n += len(b.args) / 2
+	}
+	if n != len(rows) {
+		t.Fatalf("expected %d rows across the batches, got %d", len(rows), n)
+	}
+
+	if _, err := bulkInsertBatches("user", []string{"id", "name"}, [][]interface{}{{1}}, 0); err == nil {
+		t.Fatal("expected error for a row with too few values")
+	}
+}
+
+func TestClientBulkInsert(t *testing.T) {
+	var queries []string
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		queries = append(queries, string(parseJSON(t, string(body)).GetStringBytes("query")))
+		return 200, `{"session":{},"result":{"rowsAffected":"2"}}`
+	})
+	c.session = []byte(`{}`)
+	cl := &Client{conn: c}
+
+	n, err := cl.BulkInsert(context.Background(), "t", []string{"a"}, [][]interface{}{{1}, {2}, {3}, {4}}, 250)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 2 || queries[0] != "INSERT INTO `t` (`a`) VALUES (:v1), (:v2)" {
+		t.Fatalf("unexpected queries %q", queries)
+	}
+	if n != 4 {
+		t.Fatalf("expected 4 rows affected, got %d", n)
+	}
+}
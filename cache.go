@@ -0,0 +1,151 @@
+package planetscale
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// ResultCache caches the results of queries run with a context from
+// WithCacheTTL, so later invocations can be served without a round trip to
+// PlanetScale.
+//
+// Get returns nil and no error if nothing is cached under key. Set caches
+// value under key for ttl. Errors from Get are treated as a miss, and
+// errors from Set are ignored, so an unavailable cache only costs queries
+// their caching.
+//
+// Fastly's Simple Cache is a natural fit. With an SDK that has it, a cache
+// can be:
+//
+//	type simpleResults struct{}
+//
+//	func (simpleResults) Get(ctx context.Context, key string) ([]byte, error) {
+//		r, err := simplecache.Get([]byte(key))
+//		if errors.Is(err, simplecache.ErrNotFound) {
+//			return nil, nil
+//		} else if err != nil {
+//			return nil, err
+//		}
+//		defer r.Close()
+//		return io.ReadAll(r)
+//	}
+//
+//	func (simpleResults) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+//		r, err := simplecache.GetOrSet([]byte(key), func() (simplecache.CacheEntry, error) {
+//			return simplecache.CacheEntry{Body: bytes.NewReader(value), TTL: ttl}, nil
+//		})
+//		if err == nil {
+//			r.Close()
+//		}
+//		return err
+//	}
+type ResultCache interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+type cacheTTLKey struct{}
+
+// WithCacheTTL returns a context that lets the results of read queries run
+// with it be cached in the connection's ResultCache for ttl. Queries in a
+// transaction are never cached.
+func WithCacheTTL(ctx context.Context, ttl time.Duration) context.Context {
+	return context.WithValue(ctx, cacheTTLKey{}, ttl)
+}
+
+// cacheTTL returns how long the result of query run with ctx may be cached,
+// or zero if it can't be.
+func (c *PsConn) cacheTTL(ctx context.Context, query string) time.Duration {
+	ttl, _ := ctx.Value(cacheTTLKey{}).(time.Duration)
+	if c.cfg.ResultCache == nil || c.inTx || !isReadOnly(query) {
+		return 0
+	}
+	return ttl
+}
+
+// cacheKey returns the key the result of query is cached under. It covers
+// everything that decides the result: the host, keyspace and shard, the type
+// of tablet queried, the normalized query and its bind variables.
+func (c *PsConn) cacheKey(ctx context.Context, query string, binds bindVars) (string, error) {
+	r := c.routingFor(ctx)
+
+	b, err := json.Marshal(binds)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	for _, s := range []string{c.cfg.Host, r.keyspace, r.shard, r.tablet(), normalizeQuery(query)} {
+		io.WriteString(h, s)
+		h.Write([]byte{0})
+	}
+	h.Write(b)
+	return "planetscale:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// cachedResults returns the result of query from the result cache, or runs
+// it and caches its result for ttl. Only the result is cached, not the
+// session it was returned with.
+func (c *PsConn) cachedResults(ctx context.Context, query string, binds bindVars, ttl time.Duration) (*PsResults, error) {
+	key, err := c.cacheKey(ctx, query, binds)
+	if err != nil {
+		return nil, err
+	}
+
+	if b, err := c.cfg.ResultCache.Get(ctx, key); err == nil && b != nil {
+		return c.decodeResults(ctx, b, true)
+	}
+
+	if err := c.route(ctx); err != nil {
+		return nil, err
+	}
+
+	p := parserPool.Get()
+	defer parserPool.Put(p)
+
+	v, err := c.execute(ctx, p, query, binds)
+	if err != nil {
+		return nil, err
+	}
+
+	result := v.Get("result")
+	if result == nil {
+		return nil, protocolErrorf("no result")
+	}
+	b := append([]byte(`{"result":`), result.MarshalTo(nil)...)
+	b = append(b, '}')
+
+	results, err := c.decodeResults(ctx, b, false)
+	if err != nil {
+		return nil, err
+	}
+	c.cfg.ResultCache.Set(ctx, key, b, ttl)
+	return results, nil
+}
+
+// decodeResults returns the results held in b, a response with a result and
+// no session. The rows of a cache hit are reported to metrics and QueryStats
+// as they are read, while those of a miss were reported when the query ran.
+// Neither counts as another query.
+func (c *PsConn) decodeResults(ctx context.Context, b []byte, hit bool) (*PsResults, error) {
+	results := &PsResults{maxRows: c.cfg.MaxRows, truncate: c.cfg.TruncateRows, validateJSON: c.cfg.ValidateJSON, decodeDecimal: c.cfg.DecodeDecimal}
+	if hit {
+		results.metrics, results.stats = c.metrics(), queryStatsFrom(ctx)
+	}
+	if !c.cfg.NoParseTime {
+		results.loc = c.cfg.location()
+	}
+
+	s := newResponseStream(ctx, c, io.NopCloser(bytes.NewReader(b)))
+	s.cached = true
+	if err := s.start(); err != nil {
+		return nil, err
+	}
+	results.Fields, results.warnings, results.rows = s.fields, s.warnings, s
+	return results, nil
+}
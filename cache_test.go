@@ -0,0 +1,141 @@
+package planetscale
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+)
+
+type memCache map[string][]byte
+
+func (m memCache) Get(ctx context.Context, key string) ([]byte, error) {
+	return m[key], nil
+}
+
+func (m memCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	m[key] = value
+	return nil
+}
+
+func TestResultCache(t *testing.T) {
+	cache := memCache{}
+	var requests int
+	newCachingConn := func() *PsConn {
+		c := stubConn(func(endpoint string, body []byte) (int, string) {
+			requests++
+			return 200, `{"session":{},"result":{"fields":[{"name":"n","type":"VARCHAR"}],"rows":` + threeRows + `}}`
+		})
+		c.cfg.ResultCache = cache
+		return c
+	}
+
+	ctx := WithCacheTTL(context.Background(), time.Minute)
+	query := func(c *PsConn, q string, arg int64) []string {
+		t.Helper()
+		rows, err := c.QueryContext(ctx, q, []driver.NamedValue{{Ordinal: 1, Value: arg}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		values, err := readValues(t, rows)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return values
+	}
+
+	want := query(newCachingConn(), "SELECT n FROM t WHERE id = ?", 1)
+	if len(want) != 3 {
+		t.Fatalf("expected 3 rows, got %q", want)
+	}
+	sent := requests
+
+	// Another invocation is served from the cache, even with the query
+	// formatted differently.
+	got := query(newCachingConn(), "SELECT n\n  FROM t WHERE id = ?", 1)
+	if requests != sent {
+		t.Fatalf("expected no requests for a cached result, got %d", requests-sent)
+	}
+	if len(got) != len(want) || got[0] != want[0] || got[2] != want[2] {
+		t.Fatalf("expected cached rows %q, got %q", want, got)
+	}
+
+	query(newCachingConn(), "SELECT n FROM t WHERE id = ?", 2)
+	if requests == sent {
+		t.Fatal("expected a query with other arguments not to be served from the cache")
+	}
+}
+
+func TestResultCacheSkipsWrites(t *testing.T) {
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		return 200, `{"session":{},"result":{"rowsAffected":"1"}}`
+	})
+	cache := memCache{}
+	c.cfg.ResultCache = cache
+
+	if _, err := c.QueryContext(WithCacheTTL(context.Background(), time.Minute), "UPDATE t SET n = 1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(cache) != 0 {
+		t.Fatal("expected a write not to be cached")
+	}
+}
+
+func TestResultCacheStrictResponses(t *testing.T) {
+	cache := memCache{}
+	var requests int
+	ctx := WithCacheTTL(context.Background(), time.Minute)
+	for i := 0; i < 2; i++ {
+		c := stubConn(func(endpoint string, body []byte) (int, string) {
+			requests++
+			return 200, `{"session":{},"result":{"fields":[{"name":"n","type":"VARCHAR"}],"rows":` + threeRows + `}}`
+		})
+		c.cfg.ResultCache = cache
+		c.cfg.StrictResponses = true
+
+		rows, err := c.QueryContext(ctx, "SELECT n FROM t", nil)
+		if err != nil {
+			t.Fatalf("query %d: %v", i, err)
+		}
+		if values, err := readValues(t, rows); err != nil || len(values) != 3 {
+			t.Fatalf("query %d: expected 3 rows, got %q, %v", i, values, err)
+		}
+	}
+	if requests != 2 {
+		t.Fatalf("expected the second query to be served from the cache, got %d requests", requests)
+	}
+}
+
+func TestResultCacheMetrics(t *testing.T) {
+	cache := memCache{}
+	ctx := WithCacheTTL(context.Background(), time.Minute)
+	for _, hit := range []bool{false, true} {
+		m := &recordingMetrics{}
+		c := stubConn(func(endpoint string, body []byte) (int, string) {
+			return 200, `{"session":{},"result":{"fields":[{"name":"n","type":"VARCHAR"}],"rows":` + threeRows + `}}`
+		})
+		c.session = []byte(`{}`)
+		c.cfg.ResultCache = cache
+		c.cfg.Metrics = m
+		ctx, stats := WithQueryStats(ctx)
+
+		rows, err := c.QueryContext(ctx, "SELECT n FROM t", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readValues(t, rows); err != nil {
+			t.Fatal(err)
+		}
+
+		queries := 1
+		if hit {
+			queries = 0
+		}
+		if len(m.rows) != 1 || m.rows[0] != 3 {
+			t.Fatalf("hit %v: expected 3 rows observed once, got %v", hit, m.rows)
+		}
+		if stats.RowsReturned != 3 || stats.Queries != queries {
+			t.Fatalf("hit %v: expected 3 rows and %d queries, got %d rows and %d queries", hit, queries, stats.RowsReturned, stats.Queries)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package planetscale
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/valyala/fastjson"
+)
+
+// Client runs queries with the psdb API directly, for callers that want the
+// whole Execute response rather than database/sql's view of it. It uses the
+// same machinery as the driver's connections, including their sessions,
+// routing, retries and credentials, and is configured the same way.
+//
+// Like a connection, a Client has a single session and must not be used by
+// more than one goroutine at a time; a call made while another is running
+// fails with ErrConcurrentUse.
+type Client struct {
+	conn *PsConn
+}
+
+// Session is a Vitess session, as returned by the API.
+type Session struct {
+	// ID is the session's UUID.
+	ID string
+
+	// Raw is the session as the API returned it, which is JSON unless the
+	// client uses protobuf.
+	Raw []byte
+}
+
+// QueryResult is the result of a query run with Client.Execute.
+type QueryResult struct {
+	Fields       []PsField
+	Rows         []PsRow
+	RowsAffected uint64
+
+	// InsertID is the id generated by an auto-increment column, if
+	// HasInsertID is set.
+	InsertID    uint64
+	HasInsertID bool
+
+	// Warnings are the warnings MySQL raised for the query.
+	Warnings []string
+
+	// Info is the information MySQL reported about the statement, such as
+	// "Rows matched: 3  Changed: 1  Warnings: 0" for an UPDATE.
+	Info string
+
+	// Timing is how long the query took to execute, as reported by the API.
+	Timing time.Duration
+
+	// Session is the session after the query.
+	Session Session
+}
+
+// NewClient returns a Client for cfg.
+func NewClient(cfg Config) *Client {
+	c := newConn(cfg)
+	c.limiter = newLimiter(cfg)
+	return &Client{conn: c}
+}
+
+// Session returns the client's current session, which is empty until the
+// first session is created.
+func (cl *Client) Session() Session {
+	return Session{ID: cl.conn.sessionID, Raw: append([]byte(nil), cl.conn.session...)}
+}
+
+// CreateSession creates a new session, replacing the client's current one.
+func (cl *Client) CreateSession(ctx context.Context) (Session, error) {
+	release, err := cl.conn.use()
+	defer release()
+	if err != nil {
+		return Session{}, err
+	}
+
+	if err := cl.conn.refreshSession(ctx); err != nil {
+		return Session{}, err
+	}
+	return cl.Session(), nil
+}
+
+// Execute runs query with args bound to its placeholders, creating a session
+// if the client doesn't have one. Arguments are converted like they are for
+// database/sql queries, and sql.Named arguments are bound by name. An error
+// returned by PlanetScale for the query is an *Error.
+func (cl *Client) Execute(ctx context.Context, query string, args ...interface{}) (*QueryResult, error) {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		nv := driver.NamedValue{Ordinal: i + 1}
+		if na, ok := arg.(sql.NamedArg); ok {
+			nv.Name, arg = na.Name, na.Value
+		}
+
+		v, err := convertArg(arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i+1, err)
+		}
+		nv.Value = v
+		named[i] = nv
+	}
+
+	c := cl.conn
+	release, err := c.use()
+	defer release()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := withWriteDeadline(ctx, query)
+	defer cancel()
+
+	var qr *QueryResult
+	err = c.withHooks(ctx, query, func(ctx context.Context) error {
+		q, binds, err := c.bindArgs(query, named)
+		if err != nil {
+			return err
+		}
+		if err := c.route(ctx); err != nil {
+			return err
+		}
+
+		p := parserPool.Get()
+		defer parserPool.Put(p)
+
+		v, err := c.execute(ctx, p, q, binds)
+		if err != nil {
+			return err
+		}
+		if qr, err = c.queryResult(v); err != nil {
+			return err
+		}
+		queryStatsFrom(ctx).addWarnings(len(qr.Warnings))
+		return nil
+	})
+	return qr, err
+}
+
+// sessionWarnings returns the warnings of the connection's session, which
+// are those of the last query.
+func (c *PsConn) sessionWarnings() ([]string, error) {
+	if c.session == nil {
+		return nil, nil
+	}
+	if c.useProtobuf() {
+		_, warnings, err := decodeSession(c.session)
+		return warnings, err
+	}
+
+	p := parserPool.Get()
+	defer parserPool.Put(p)
+
+	v, err := p.ParseBytes(c.session)
+	if err != nil {
+		return nil, err
+	}
+	return readWarnings(v), nil
+}
+
+// queryResult reads the QueryResult of an Execute response.
+func (c *PsConn) queryResult(v *fastjson.Value) (*QueryResult, error) {
+	res, err := c.readResult(v)
+	if err != nil {
+		return nil, err
+	}
+
+	qr := &QueryResult{
+		RowsAffected: uint64(res.rowsAffected),
+		InsertID:     uint64(res.insertID),
+		HasInsertID:  res.hasInsertID,
+		Warnings:     res.warnings,
+		Info:         res.info,
+		Timing:       time.Duration(v.GetFloat64("timing") * float64(time.Second)),
+		Session:      Session{ID: c.sessionID, Raw: append([]byte(nil), c.session...)},
+	}
+
+	result := v.Get("result")
+	if result.Get("fields") == nil {
+		return qr, nil
+	}
+	if qr.Fields, err = c.readFields(result.Get("fields")); err != nil {
+		return nil, err
+	}
+
+	rows := result.GetArray("rows")
+	qr.Rows = make([]PsRow, 0, len(rows))
+	for _, r := range rows {
+		lengths := r.GetArray("lengths")
+		row := encodedRow{Lengths: make([]json.Number, 0, len(lengths))}
+		for _, l := range lengths {
+			row.Lengths = append(row.Lengths, json.Number(l.GetStringBytes()))
+		}
+		if row.Values, err = base64.StdEncoding.DecodeString(string(r.GetStringBytes("values"))); err != nil {
+			return nil, &ProtocolError{Msg: "invalid row values", Err: err}
+		}
+
+		decoded, err := decodeRow(row, nil)
+		if err != nil {
+			return nil, err
+		}
+		qr.Rows = append(qr.Rows, decoded)
+	}
+	return qr, nil
+}
@@ -0,0 +1,56 @@
+package planetscale
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestClientExecute(t *testing.T) {
+	var name, typ string
+	cl := &Client{conn: stubConn(func(endpoint string, body []byte) (int, string) {
+		if endpoint == defaultAPIPrefix+sessionPath {
+			return 200, `{"session":{"vitessSession":{"SessionUUID":"s1"}}}`
+		}
+		typ = string(parseJSON(t, string(body)).GetStringBytes("bindVariables", "name", "type"))
+		name = string(parseJSON(t, string(body)).GetStringBytes("query"))
+		return 200, `{
+			"session":{"vitessSession":{"SessionUUID":"s1","warnings":[{"code":1265,"message":"Data truncated"}]}},
+			"result":{"rowsAffected":"0","fields":[{"name":"n","type":"VARCHAR"}],"rows":` + threeRows + `},
+			"timing":0.25
+		}`
+	})}
+
+	session, err := cl.CreateSession(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.ID != "s1" || len(session.Raw) == 0 {
+		t.Fatalf("unexpected session %+v", session)
+	}
+
+	res, err := cl.Execute(context.Background(), "SELECT n FROM t WHERE name = :name", sql.Named("name", "x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name != "SELECT n FROM t WHERE name = :name" || typ != "VARCHAR" {
+		t.Fatalf("unexpected request %q with %s argument", name, typ)
+	}
+	if len(res.Fields) != 1 || res.Fields[0].Name != "n" {
+		t.Fatalf("unexpected fields %+v", res.Fields)
+	}
+	if len(res.Rows) != 3 || string(res.Rows[2].Values[0]) != "3" {
+		t.Fatalf("unexpected rows %q", res.Rows)
+	}
+	if res.Timing != 250*time.Millisecond {
+		t.Fatalf("expected timing 250ms, got %s", res.Timing)
+	}
+	if len(res.Warnings) != 1 || res.Warnings[0] != "Warning 1265: Data truncated" {
+		t.Fatalf("unexpected warnings %q", res.Warnings)
+	}
+	if res.Session.ID != "s1" {
+		t.Fatalf("unexpected session %+v", res.Session)
+	}
+}
@@ -0,0 +1,66 @@
+package planetscale
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+)
+
+// compressRequest sets up req for compression: responses are requested
+// gzip-encoded, and body is compressed if it is at least CompressMinSize
+// bytes. It returns the body to send.
+//
+// Compute decompresses gzip responses itself when asked to, which is much
+// faster than doing so in WebAssembly, so decompressBody only has work to do
+// where that isn't available.
+func (c *PsConn) compressRequest(req *fsthttp.Request, body []byte) ([]byte, error) {
+	if !c.cfg.Compress {
+		return body, nil
+	}
+
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.DecompressResponseOptions.Gzip = true
+
+	if c.cfg.CompressMinSize <= 0 || len(body) < c.cfg.CompressMinSize {
+		return body, nil
+	}
+
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	if _, err := zw.Write(body); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Encoding", "gzip")
+	return b.Bytes(), nil
+}
+
+// decompressBody returns a reader of the decoded body of resp, if it is
+// still gzip-encoded.
+func decompressBody(resp *fsthttp.Response) (io.ReadCloser, error) {
+	if !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return resp.Body, nil
+	}
+
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &gzipBody{Reader: zr, body: resp.Body}, nil
+}
+
+// gzipBody is a gzip-encoded response body being decoded.
+type gzipBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (b *gzipBody) Close() error {
+	b.Reader.Close()
+	return b.body.Close()
+}
@@ -0,0 +1,80 @@
+package planetscale
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+)
+
+func gzipped(t *testing.T, s string) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	zw.Write([]byte(s))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestCompression(t *testing.T) {
+	var acceptEncoding, contentEncoding string
+	var sent []byte
+
+	c := newConn(Config{Host: "example.com", Backend: "planetscale", Compress: true, CompressMinSize: 16})
+	c.send = func(ctx context.Context, req *fsthttp.Request, backend string) (*fsthttp.Response, error) {
+		acceptEncoding = req.Header.Get("Accept-Encoding")
+		contentEncoding = req.Header.Get("Content-Encoding")
+		if !req.DecompressResponseOptions.Gzip {
+			t.Error("expected automatic decompression to be requested")
+		}
+
+		zr, err := gzip.NewReader(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		if sent, err = io.ReadAll(zr); err != nil {
+			return nil, err
+		}
+
+		h := fsthttp.NewHeader()
+		h.Set("Content-Encoding", "gzip")
+		return &fsthttp.Response{
+			Request:    req,
+			StatusCode: 200,
+			Header:     h,
+			Body:       io.NopCloser(bytes.NewReader(gzipped(t, `{"session":{}}`))),
+		}, nil
+	}
+
+	body := []byte(`{"query":"SELECT 1","session":null}`)
+	resp, err := c.request(context.Background(), c.executorEndpoint, body, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if acceptEncoding != "gzip" || contentEncoding != "gzip" {
+		t.Fatalf("expected gzip encodings, got Accept-Encoding %q and Content-Encoding %q", acceptEncoding, contentEncoding)
+	}
+	if !bytes.Equal(sent, body) {
+		t.Fatalf("expected request body %s, got %s", body, sent)
+	}
+	if string(resp) != `{"session":{}}` {
+		t.Fatalf("expected decompressed response, got %q", resp)
+	}
+}
+
+func TestCompressionSkipsSmallBodies(t *testing.T) {
+	c := newConn(Config{Compress: true, CompressMinSize: 1024})
+	req, err := c.buildRequest(context.Background(), c.executorEndpoint, []byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enc := req.Header.Get("Content-Encoding"); enc != "" {
+		t.Fatalf("expected a small body to be sent as is, got Content-Encoding %q", enc)
+	}
+}
@@ -0,0 +1,88 @@
+package planetscale
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/fastly/compute-sdk-go/edgedict"
+)
+
+// ConfigStore is a read-only store of configuration, such as a Fastly edge
+// dictionary or Config Store. *edgedict.Dictionary implements it. Get must
+// return edgedict.ErrKeyNotFound for keys that aren't in the store.
+type ConfigStore interface {
+	Get(key string) (string, error)
+}
+
+// openConfigStore opens the named store. Tests replace it, since stores can
+// only be opened within Compute.
+var openConfigStore = func(name string) (ConfigStore, error) {
+	d, err := edgedict.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// ConfigFromStore reads a Config from store. The store either holds a whole
+// DSN under the key "dsn", or the options under the keys of their DSN
+// parameters, such as "host" and "backend". Keeping the configuration in a
+// store lets database settings change without rebuilding the service.
+func ConfigFromStore(store ConfigStore) (*Config, error) {
+	dsn, err := store.Get("dsn")
+	switch {
+	case err == nil:
+		return ParseDSN(dsn)
+	case !errors.Is(err, edgedict.ErrKeyNotFound):
+		return nil, fmt.Errorf("error reading config store: %w", err)
+	}
+
+	m := url.Values{}
+	for _, p := range (&Config{}).params() {
+		v, err := store.Get(p.key)
+		if errors.Is(err, edgedict.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading config store: %s: %w", p.key, err)
+		}
+		m.Set(p.key, v)
+	}
+
+	cfg := &Config{}
+	if err := cfg.setParams(m); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// OpenFromConfigStore opens a database configured by the named Config Store
+// or edge dictionary, as read by ConfigFromStore. It is the equivalent of
+// sql.Open("planetscale", "configstore://"+name).
+func OpenFromConfigStore(name string) (*sql.DB, error) {
+	cfg, err := parseConfigStoreDSN(name, nil)
+	if err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(NewConnector(WithConfig(cfg))), nil
+}
+
+// parseConfigStoreDSN reads the config from the named store, with the
+// options in params taking precedence.
+func parseConfigStoreDSN(name string, params url.Values) (*Config, error) {
+	store, err := openConfigStore(name)
+	if err != nil {
+		return nil, fmt.Errorf("error opening config store %s: %w", name, err)
+	}
+
+	cfg, err := ConfigFromStore(store)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.setParams(params); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
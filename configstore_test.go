@@ -0,0 +1,112 @@
+package planetscale
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/fastly/compute-sdk-go/edgedict"
+)
+
+// mapStore is a ConfigStore backed by a map.
+type mapStore map[string]string
+
+func (s mapStore) Get(key string) (string, error) {
+	v, ok := s[key]
+	if !ok {
+		return "", edgedict.ErrKeyNotFound
+	}
+	return v, nil
+}
+
+func TestConfigFromStore(t *testing.T) {
+	cfg, err := ConfigFromStore(mapStore{
+		"host":     "aws.connect.psdb.cloud",
+		"backend":  "planetscale",
+		"username": "alice",
+		"maxRows":  "100",
+		"protobuf": "true",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Host != "aws.connect.psdb.cloud" || cfg.Backend != "planetscale" || cfg.Username != "alice" || cfg.MaxRows != 100 || !cfg.Protobuf {
+		t.Fatalf("unexpected config %#v", *cfg)
+	}
+
+	cfg, err = ConfigFromStore(mapStore{"dsn": "alice:secret@tcp(example.com)/mydb?backend=planetscale"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Host != "example.com" || cfg.Database != "mydb" || cfg.Password != "secret" {
+		t.Fatalf("unexpected config %#v", *cfg)
+	}
+
+	if _, err := ConfigFromStore(mapStore{"maxRows": "lots"}); err == nil {
+		t.Fatal("expected error for an invalid option")
+	}
+}
+
+func TestConfigFromStoreReadsEveryParam(t *testing.T) {
+	values := map[string]string{
+		"username": "alice", "password": "secret", "host": "example.com", "backend": "planetscale",
+		"database": "main", "shard": "-80", "target": "replica", "boost": "true", "apiPrefix": "/psdb.v1alpha1.Database",
+		"appName": "checkout", "minTLSVersion": "1.3", "sniHostname": "sni.example.com", "certHostname": "cert.example.com",
+		"connectionAttributes": "team:payments", "maxRows": "10", "truncateRows": "true", "maxResponseBytes": "1024",
+		"validateOnOpen": "true", "noAutoRefresh": "true", "streamExecute": "true", "multiStatements": "true",
+		"interpolateParams": "true", "protobuf": "true", "compress": "true", "compressMinSize": "512",
+		"validateJSON": "true", "strictResponses": "true", "zeroCopyRows": "true", "stmtCacheSize": "8",
+		"maxAttempts": "3", "retryBackoff": "10ms", "maxConcurrentRequests": "4", "queueTimeout": "1s",
+		"firstByteTimeout": "2s", "sendPollInterval": "5ms", "parseTime": "false", "loc": "Europe/Paris",
+		"collation": "utf8mb4_bin",
+	}
+
+	for _, p := range (&Config{}).params() {
+		v, ok := values[p.key]
+		if !ok {
+			t.Errorf("no test value for the %s parameter", p.key)
+			continue
+		}
+
+		// The shard needs a database, which is set for every parameter.
+		store := mapStore{"database": "main", p.key: v}
+		cfg, err := ConfigFromStore(store)
+		if err != nil {
+			t.Fatalf("%s: %v", p.key, err)
+		}
+		want, err := ParseDSN(url.Values{"database": {"main"}, p.key: {v}}.Encode())
+		if err != nil {
+			t.Fatalf("%s: %v", p.key, err)
+		}
+		if !reflect.DeepEqual(cfg, want) {
+			t.Errorf("%s: expected %#v from the store, got %#v", p.key, *want, *cfg)
+		}
+		if p.key != "database" && reflect.DeepEqual(cfg, &Config{Database: "main"}) {
+			t.Errorf("%s: expected the parameter to set an option", p.key)
+		}
+	}
+}
+
+func TestConfigStoreDSN(t *testing.T) {
+	open := openConfigStore
+	defer func() { openConfigStore = open }()
+
+	openConfigStore = func(name string) (ConfigStore, error) {
+		if name != "db_config" {
+			return nil, edgedict.ErrDictionaryNotFound
+		}
+		return mapStore{"host": "example.com", "backend": "planetscale", "maxRows": "5"}, nil
+	}
+
+	cfg, err := ParseDSN("configstore://db_config?maxRows=10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Host != "example.com" || cfg.MaxRows != 10 {
+		t.Fatalf("expected store config with maxRows overridden, got %#v", *cfg)
+	}
+
+	if _, err := ParseDSN("configstore://missing"); err == nil {
+		t.Fatal("expected error for a missing store")
+	}
+}
@@ -0,0 +1,427 @@
+package planetscale
+
+import (
+	"context"
+	"database/sql/driver"
+	"time"
+)
+
+// Option configures a connector created with NewConnector.
+type Option func(*Config)
+
+// WithConfig replaces the connector's configuration with a copy of cfg.
+// Options after it modify the copy.
+func WithConfig(cfg *Config) Option {
+	return func(c *Config) {
+		*c = *cfg
+	}
+}
+
+// WithHost sets the PlanetScale host, such as "aws.connect.psdb.cloud".
+func WithHost(host string) Option {
+	return func(c *Config) {
+		c.Host = host
+	}
+}
+
+// WithCredentials sets the username and password used to authenticate.
+func WithCredentials(username, password string) Option {
+	return func(c *Config) {
+		c.Username = username
+		c.Password = password
+	}
+}
+
+// WithCredentialProvider authenticates with credentials from p, reusing them
+// for ttl.
+func WithCredentialProvider(p CredentialProvider, ttl time.Duration) Option {
+	return func(c *Config) {
+		c.CredentialProvider = p
+		c.CredentialTTL = ttl
+	}
+}
+
+// WithBearerToken authenticates with a bearer token, such as a PlanetScale
+// service token, instead of a username and password.
+func WithBearerToken(token string) Option {
+	return func(c *Config) {
+		c.BearerToken = token
+	}
+}
+
+// WithTokenProvider authenticates with bearer tokens from p, reusing them
+// for ttl.
+func WithTokenProvider(p TokenProvider, ttl time.Duration) Option {
+	return func(c *Config) {
+		c.TokenProvider = p
+		c.CredentialTTL = ttl
+	}
+}
+
+// WithBackend sets the name of the Fastly backend requests are sent to.
+func WithBackend(backend string) Option {
+	return func(c *Config) {
+		c.Backend = backend
+	}
+}
+
+// WithTransport sends requests with t, such as an HTTPTransport to use the
+// driver outside Compute.
+func WithTransport(t Transport) Option {
+	return func(c *Config) {
+		c.Transport = t
+	}
+}
+
+// WithDynamicBackend sends requests through a dynamic backend for the host,
+// registered with register, instead of a backend declared in the service.
+func WithDynamicBackend(register BackendRegistrar) Option {
+	return func(c *Config) {
+		c.Backend = ""
+		c.RegisterBackend = register
+	}
+}
+
+// WithTLSBackend sends requests through a dynamic backend for the host whose
+// TLS connection meets opts, registered with register, instead of a backend
+// declared in the service.
+func WithTLSBackend(register TLSBackendRegistrar, opts TLSOptions) Option {
+	return func(c *Config) {
+		c.Backend = ""
+		c.RegisterTLSBackend = register
+		c.TLS = opts
+	}
+}
+
+// WithFailover fails over to other endpoints when the host is failing, as
+// described by FailoverPolicy.
+func WithFailover(p FailoverPolicy) Option {
+	return func(c *Config) {
+		c.Failover = p
+	}
+}
+
+// WithResultCache caches the results of queries with a context from
+// WithCacheTTL in cache.
+func WithResultCache(cache ResultCache) Option {
+	return func(c *Config) {
+		c.ResultCache = cache
+	}
+}
+
+// WithTracer traces API calls with t, redacting the literals in traced
+// statements if redact is set.
+func WithTracer(t Tracer, redact bool) Option {
+	return func(c *Config) {
+		c.Tracer = t
+		c.RedactStatements = redact
+	}
+}
+
+// WithRedactedQueries masks the values in queries passed to hooks and
+// tracers, and in the messages of query errors.
+func WithRedactedQueries() Option {
+	return func(c *Config) {
+		c.RedactQueries = true
+	}
+}
+
+// WithConcurrencyLimit limits the connector's connections to n requests in
+// flight at once. Requests over the limit wait up to timeout, or as long as
+// their context allows if it is zero, before failing with
+// ErrConcurrencyLimit.
+func WithConcurrencyLimit(n int, timeout time.Duration) Option {
+	return func(c *Config) {
+		c.MaxConcurrentRequests = n
+		c.QueueTimeout = timeout
+	}
+}
+
+// WithDefaultRequestOptions sets the Fastly options of the connector's
+// requests to the API, which a context from WithRequestOptions overrides.
+func WithDefaultRequestOptions(opts RequestOptions) Option {
+	return func(c *Config) {
+		c.RequestOptions = opts
+	}
+}
+
+// WithMetrics reports measurements of queries and requests to m.
+func WithMetrics(m MetricsCollector) Option {
+	return func(c *Config) {
+		c.Metrics = m
+	}
+}
+
+// WithQueryHook adds a hook called around each query.
+func WithQueryHook(h QueryHook) Option {
+	return func(c *Config) {
+		c.Hooks = append(c.Hooks[:len(c.Hooks):len(c.Hooks)], h)
+	}
+}
+
+// WithSessionStore saves sessions in store, so they can be resumed across
+// invocations by queries with a context from WithSessionKey.
+func WithSessionStore(store SessionStore) Option {
+	return func(c *Config) {
+		c.SessionStore = store
+	}
+}
+
+// WithDatabase runs queries in database, or Vitess keyspace, name.
+func WithDatabase(name string) Option {
+	return func(c *Config) {
+		c.Database = name
+	}
+}
+
+// WithShard sends queries to shard of the connector's database, as
+// described by Config.Shard.
+func WithShard(shard string) Option {
+	return func(c *Config) {
+		c.Shard = shard
+	}
+}
+
+// WithTarget sets the type of tablet queries are sent to, such as "replica".
+func WithTarget(target string) Option {
+	return func(c *Config) {
+		c.Target = target
+	}
+}
+
+// WithBoostCachedQueries lets every query be served by PlanetScale Boost,
+// unless its context is from WithoutBoost.
+func WithBoostCachedQueries() Option {
+	return func(c *Config) {
+		c.Boost = true
+	}
+}
+
+// WithRegions sends queries routed to a replica to the nearest of regions, or
+// the one chosen by selectRegion if it isn't nil.
+func WithRegions(regions []Region, selectRegion RegionSelector) Option {
+	return func(c *Config) {
+		c.Regions = regions
+		c.SelectRegion = selectRegion
+	}
+}
+
+// WithHostLocation locates the region of the connection's host, so
+// NearestRegion only sends replica reads to another region that is nearer
+// to the client.
+func WithHostLocation(latitude, longitude float64) Option {
+	return func(c *Config) {
+		c.HostLatitude = latitude
+		c.HostLongitude = longitude
+	}
+}
+
+// WithLocation sets the time zone DATETIME and TIMESTAMP values are in.
+func WithLocation(loc *time.Location) Option {
+	return func(c *Config) {
+		c.Location = loc
+	}
+}
+
+// WithCollation sets the connection collation of new sessions.
+func WithCollation(collation string) Option {
+	return func(c *Config) {
+		c.Collation = collation
+	}
+}
+
+// WithInitStatements runs stmts on each new session, to set session
+// variables that every query on the connection should see.
+func WithInitStatements(stmts ...string) Option {
+	return func(c *Config) {
+		c.InitStatements = stmts
+	}
+}
+
+// WithAPIPrefix overrides the path prefix of the psdb API endpoints.
+func WithAPIPrefix(prefix string) Option {
+	return func(c *Config) {
+		c.APIPrefix = prefix
+	}
+}
+
+// WithHeader adds a header sent with every request.
+func WithHeader(key, value string) Option {
+	return func(c *Config) {
+		headers := make(map[string]string, len(c.Headers)+1)
+		for k, v := range c.Headers {
+			headers[k] = v
+		}
+		headers[key] = value
+		c.Headers = headers
+	}
+}
+
+// WithAppName appends name to the User-Agent of requests.
+func WithAppName(name string) Option {
+	return func(c *Config) {
+		c.AppName = name
+	}
+}
+
+// WithConnectionAttributes adds attrs to the attributes every query is
+// tagged with, such as FastlyAttributes().
+func WithConnectionAttributes(attrs map[string]string) Option {
+	return func(c *Config) {
+		merged := make(map[string]string, len(c.ConnectionAttributes)+len(attrs))
+		for k, v := range c.ConnectionAttributes {
+			merged[k] = v
+		}
+		for k, v := range attrs {
+			merged[k] = v
+		}
+		c.ConnectionAttributes = merged
+	}
+}
+
+// WithValidateOnOpen makes Connect create the connection's session, so it
+// fails right away if the host, backend or credentials are wrong.
+func WithValidateOnOpen() Option {
+	return func(c *Config) {
+		c.ValidateOnOpen = true
+	}
+}
+
+// WithMaxRows limits how many rows are decoded from a single result. If
+// truncate is true, larger results are truncated instead of failing with
+// ErrMaxRows.
+func WithMaxRows(n int, truncate bool) Option {
+	return func(c *Config) {
+		c.MaxRows = n
+		c.TruncateRows = truncate
+	}
+}
+
+// WithMaxResponseBytes limits the size of a response body, so a runaway
+// query fails with ErrMaxResponseBytes instead of exhausting memory.
+func WithMaxResponseBytes(n int) Option {
+	return func(c *Config) {
+		c.MaxResponseBytes = n
+	}
+}
+
+// WithValidateJSON makes reading an invalid JSON column value fail.
+func WithValidateJSON() Option {
+	return func(c *Config) {
+		c.ValidateJSON = true
+	}
+}
+
+// WithZeroCopyRows decodes rows into a buffer that is reused for the next
+// row, as described by Config.ZeroCopyRows.
+func WithZeroCopyRows() Option {
+	return func(c *Config) {
+		c.ZeroCopyRows = true
+	}
+}
+
+// WithStrictResponses fails requests whose responses aren't shaped like the
+// API's with a *ProtocolError, as described by Config.StrictResponses.
+func WithStrictResponses() Option {
+	return func(c *Config) {
+		c.StrictResponses = true
+	}
+}
+
+// WithDecimalDecoder converts DECIMAL values with decode instead of
+// returning them as strings.
+func WithDecimalDecoder(decode DecimalDecoder) Option {
+	return func(c *Config) {
+		c.DecodeDecimal = decode
+	}
+}
+
+// WithInterpolateParams inlines query arguments into the SQL text instead
+// of sending them as bind variables.
+func WithInterpolateParams() Option {
+	return func(c *Config) {
+		c.InterpolateParams = true
+	}
+}
+
+// WithStreamExecute runs queries with the StreamExecute endpoint, so large
+// results arrive in chunks of rows.
+func WithStreamExecute() Option {
+	return func(c *Config) {
+		c.StreamExecute = true
+	}
+}
+
+// WithMultiStatements allows queries made of several semicolon separated
+// statements.
+func WithMultiStatements() Option {
+	return func(c *Config) {
+		c.MultiStatements = true
+	}
+}
+
+// WithProtobuf encodes requests and responses as protobuf instead of JSON.
+func WithProtobuf() Option {
+	return func(c *Config) {
+		c.Protobuf = true
+	}
+}
+
+// WithCompression requests gzip-encoded responses, and sends request bodies
+// of at least minSize bytes gzip-encoded if minSize is positive.
+func WithCompression(minSize int) Option {
+	return func(c *Config) {
+		c.Compress = true
+		c.CompressMinSize = minSize
+	}
+}
+
+// WithRetry retries idempotent requests that fail with transient errors
+// according to p.
+func WithRetry(p RetryPolicy) Option {
+	return func(c *Config) {
+		c.Retry = p
+	}
+}
+
+// PsConnector opens connections from a Config. Use it with sql.OpenDB to
+// configure the driver in code instead of with a DSN:
+//
+//	db := sql.OpenDB(planetscale.NewConnector(
+//		planetscale.WithHost("aws.connect.psdb.cloud"),
+//		planetscale.WithCredentials(username, password),
+//		planetscale.WithBackend("planetscale"),
+//	))
+type PsConnector struct {
+	cfg     Config
+	limiter *limiter
+}
+
+var _ driver.Connector = (*PsConnector)(nil)
+
+// NewConnector returns a connector configured by opts.
+func NewConnector(opts ...Option) *PsConnector {
+	c := &PsConnector{}
+	for _, opt := range opts {
+		opt(&c.cfg)
+	}
+	c.limiter = newLimiter(c.cfg)
+	return c
+}
+
+func (c *PsConnector) String() string {
+	return c.cfg.String()
+}
+
+func (c *PsConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn := newConn(c.cfg)
+	conn.limiter = c.limiter
+	if err := conn.validate(ctx); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (c *PsConnector) Driver() driver.Driver {
+	return PsDriver{}
+}
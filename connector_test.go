@@ -0,0 +1,77 @@
+package planetscale
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+func TestNewConnector(t *testing.T) {
+	base := &Config{Host: "old.example.com", MaxRows: 5}
+	c := NewConnector(
+		WithConfig(base),
+		WithHost("aws.connect.psdb.cloud"),
+		WithCredentials("alice", "secret"),
+		WithBackend("planetscale"),
+	)
+
+	conn, err := c.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := conn.(*PsConn).cfg
+	want := Config{
+		Username: "alice",
+		Password: "secret",
+		Host:     "aws.connect.psdb.cloud",
+		Backend:  "planetscale",
+		MaxRows:  5,
+	}
+	if cfg.Username != want.Username || cfg.Password != want.Password || cfg.Host != want.Host ||
+		cfg.Backend != want.Backend || cfg.MaxRows != want.MaxRows {
+		t.Fatalf("expected %#v, got %#v", want, cfg)
+	}
+	if base.Host != "old.example.com" {
+		t.Fatal("WithConfig should not modify the config it copies")
+	}
+}
+
+func TestOpenConnector(t *testing.T) {
+	if _, err := sql.Open("planetscale", "host=example.com&maxRows=bad"); err == nil {
+		t.Fatal("expected invalid DSN error from sql.Open")
+	}
+}
+
+func TestValidateOnOpen(t *testing.T) {
+	status := 401
+	send := stubConn(func(endpoint string, body []byte) (int, string) {
+		if status != 200 {
+			return status, "unauthorized"
+		}
+		return 200, `{"session":{"vitessSession":{"SessionUUID":"abc"}}}`
+	}).send
+	c := NewConnector(WithHost("example.com"), WithTransport(TransportFunc(send)), WithValidateOnOpen())
+
+	_, err := c.Connect(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "error validating connection to example.com: credentials rejected") {
+		t.Fatalf("expected credentials to be rejected on connect, got %v", err)
+	}
+
+	status = 200
+	conn, err := c.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn.(*PsConn).session == nil {
+		t.Fatal("expected the session to be created on connect")
+	}
+
+	if _, err := NewConnector(WithHost("example.com"), WithTransport(TransportFunc(send))).Connect(context.Background()); err != nil {
+		t.Fatalf("expected no request without validateOnOpen, got %v", err)
+	}
+	if cfg, _ := ParseDSN("host=h&validateOnOpen=true"); cfg == nil || !cfg.ValidateOnOpen {
+		t.Fatal("expected validateOnOpen to be parsed")
+	}
+}
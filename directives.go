@@ -0,0 +1,155 @@
+package planetscale
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Directives are Vitess comment directives, which tune how vtgate plans and
+// runs a query, such as its priority or whether it may scatter across
+// shards. They are sent as a /*vt+ */ comment after the query's first
+// keyword. A directive with an empty value, such as ALLOW_SCATTER, is a flag
+// and is sent as its bare name.
+//
+// The methods that set a directive return d so they can be chained:
+//
+//	d := planetscale.Directives{}.Priority(10).WorkloadName("reports")
+//	rows, err := db.QueryContext(planetscale.WithDirectives(ctx, d), query)
+type Directives map[string]string
+
+// Set sets the directive name to value, or makes it a flag if value is
+// empty.
+func (d Directives) Set(name, value string) Directives {
+	d[name] = value
+	return d
+}
+
+// Priority sets the query's priority, from 0, the highest, to 100, which
+// vtgate uses to throttle lower priority queries when a tablet is
+// overloaded.
+func (d Directives) Priority(p int) Directives {
+	return d.Set("PRIORITY", strconv.Itoa(p))
+}
+
+// QueryTimeout makes vtgate abort the query if it runs longer than t.
+func (d Directives) QueryTimeout(t time.Duration) Directives {
+	return d.Set("QUERY_TIMEOUT_MS", strconv.FormatInt(t.Milliseconds(), 10))
+}
+
+// WorkloadName labels the query's workload in vtgate's metrics and for
+// throttling.
+func (d Directives) WorkloadName(name string) Directives {
+	return d.Set("WORKLOAD_NAME", name)
+}
+
+// AllowScatter lets the query scatter across shards when vtgate is set up to
+// reject queries that do.
+func (d Directives) AllowScatter() Directives {
+	return d.Set("ALLOW_SCATTER", "")
+}
+
+// ScatterErrorsAsWarnings returns the results of the shards that succeeded,
+// with the errors of those that failed as warnings, instead of failing a
+// scatter query when any shard does.
+func (d Directives) ScatterErrorsAsWarnings() Directives {
+	return d.Set("SCATTER_ERRORS_AS_WARNINGS", "")
+}
+
+// IgnoreMaxMemoryRows lifts vtgate's limit on the rows it holds in memory,
+// such as to sort or join the results of several shards.
+func (d Directives) IgnoreMaxMemoryRows() Directives {
+	return d.Set("IGNORE_MAX_MEMORY_ROWS", "")
+}
+
+// comment returns the /*vt+ */ comment of the directives, sorted by name, or
+// "" if there are none.
+func (d Directives) comment() (string, error) {
+	if len(d) == 0 {
+		return "", nil
+	}
+
+	names := make([]string, 0, len(d))
+	for name := range d {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("/*vt+")
+	for _, name := range names {
+		value := d[name]
+		if !validDirectiveName(name) {
+			return "", fmt.Errorf("invalid directive name %q", name)
+		}
+		if strings.ContainsAny(value, " \t\r\n'\"") || strings.Contains(value, "*/") {
+			return "", fmt.Errorf("invalid value %q for directive %s", value, name)
+		}
+		b.WriteString(" " + name)
+		if value != "" {
+			b.WriteString("=" + value)
+		}
+	}
+	b.WriteString(" */")
+	return b.String(), nil
+}
+
+func validDirectiveName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isIdentByte(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply returns query with the directives' comment after its first keyword,
+// which is where vtgate reads it. The keyword may follow opening
+// parentheses, as the first SELECT of (SELECT ...) UNION (SELECT ...) does.
+// A query without a keyword is returned unchanged.
+func (d Directives) Apply(query string) (string, error) {
+	comment, err := d.comment()
+	if err != nil || comment == "" {
+		return query, err
+	}
+
+	rest := skipLeadingComments(query)
+	for strings.HasPrefix(rest, "(") {
+		rest = skipLeadingComments(rest[1:])
+	}
+	start := len(query) - len(rest)
+	i := start
+	for i < len(query) && isIdentByte(query[i]) {
+		i++
+	}
+	if i == start {
+		return query, nil
+	}
+	return query[:i] + " " + comment + query[i:], nil
+}
+
+type directivesKey struct{}
+
+// WithDirectives returns a context that sends queries run with it with d,
+// along with the directives of ctx, which d overrides.
+func WithDirectives(ctx context.Context, d Directives) context.Context {
+	merged := Directives{}
+	for name, value := range directivesFrom(ctx) {
+		merged[name] = value
+	}
+	for name, value := range d {
+		merged[name] = value
+	}
+	return context.WithValue(ctx, directivesKey{}, merged)
+}
+
+func directivesFrom(ctx context.Context) Directives {
+	d, _ := ctx.Value(directivesKey{}).(Directives)
+	return d
+}
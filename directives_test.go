@@ -0,0 +1,57 @@
+package planetscale
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDirectivesApply(t *testing.T) {
+	d := Directives{}.Priority(10).WorkloadName("reports").AllowScatter()
+	for query, want := range map[string]string{
+		"SELECT * FROM t":                "SELECT /*vt+ ALLOW_SCATTER PRIORITY=10 WORKLOAD_NAME=reports */ * FROM t",
+		"/* app */ update t set n":       "/* app */ update /*vt+ ALLOW_SCATTER PRIORITY=10 WORKLOAD_NAME=reports */ t set n",
+		"( (SELECT 1) UNION (SELECT 2))": "( (SELECT /*vt+ ALLOW_SCATTER PRIORITY=10 WORKLOAD_NAME=reports */ 1) UNION (SELECT 2))",
+		"/* only a comment */":           "/* only a comment */",
+	} {
+		got, err := d.Apply(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%q: expected %q, got %q", query, want, got)
+		}
+	}
+
+	if got, err := (Directives{}).Apply("SELECT 1"); err != nil || got != "SELECT 1" {
+		t.Errorf("expected no directives to leave the query alone, got %q, %v", got, err)
+	}
+	for _, bad := range []Directives{
+		{"WORKLOAD_NAME": "a b"},
+		{"WORKLOAD_NAME": "*/ DROP"},
+		{"BAD NAME": "1"},
+	} {
+		if _, err := bad.Apply("SELECT 1"); err == nil {
+			t.Errorf("expected an error for %v", bad)
+		}
+	}
+}
+
+func TestWithDirectives(t *testing.T) {
+	var query string
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		query = string(parseJSON(t, string(body)).GetStringBytes("query"))
+		return 200, `{"session":{},"result":{"rowsAffected":"1"}}`
+	})
+	c.session = []byte(`{}`)
+
+	ctx := WithDirectives(context.Background(), Directives{}.Priority(50).QueryTimeout(time.Second))
+	ctx = WithDirectives(ctx, Directives{}.Priority(5))
+	ctx = WithQueryTimeout(ctx, 2*time.Second)
+	if _, err := c.ExecContext(ctx, "SELECT 1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := "SELECT /*+ MAX_EXECUTION_TIME(2000) */ /*vt+ PRIORITY=5 QUERY_TIMEOUT_MS=1000 */ 1"; query != want {
+		t.Fatalf("expected %q, got %q", want, query)
+	}
+}
@@ -7,34 +7,132 @@ import (
 	"database/sql/driver"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"net/url"
 	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/fastly/compute-sdk-go/fsthttp"
 	"github.com/valyala/fastjson"
 )
 
 const (
-	apiPrefix        = "/psdb.v1alpha1.Database"
-	executorEndpoint = apiPrefix + "/Execute"
-	sessionEndpoint  = apiPrefix + "/CreateSession"
+	defaultAPIPrefix = "/psdb.v1alpha1.Database"
+	executorPath     = "/Execute"
+	sessionPath      = "/CreateSession"
 	executorMethod   = "POST"
 	jsonContentType  = "application/json"
 	userAgent        = "database-go"
 )
 
-var unknownError = fmt.Errorf("unknown error")
+// parserPool holds the parsers used for API responses. A parser must not be
+// returned while values parsed from it are still in use.
+var parserPool fastjson.ParserPool
+
+// ErrConcurrentUse is returned when a connection is used by more than one
+// goroutine at a time.
+var ErrConcurrentUse = errors.New("planetscale: connection used concurrently")
+
+// ErrMaxRows is returned when a result has more rows than the maxRows
+// DSN option allows and truncateRows is not set.
+var ErrMaxRows = fmt.Errorf("result exceeds maxRows")
+
+// ErrMaxResponseBytes is returned when a response is larger than the
+// maxResponseBytes DSN option allows.
+var ErrMaxResponseBytes = fmt.Errorf("response exceeds maxResponseBytes")
 
 type PsDriver struct{}
 
+// PsConn is a connection with a single Vitess session. Like database/sql
+// expects of a driver.Conn, it must be used by one goroutine at a time: a
+// call made while another is still running on the connection fails with
+// ErrConcurrentUse rather than racing on the session. Rows returned by a
+// query read the rest of their response, and update the session, as they
+// are iterated, which database/sql serializes with the connection's other
+// calls.
 type PsConn struct {
+	cfg       Config
+	session   []byte
+	sessionID string
+	routing   routing
+	inTx      bool
+	bad       bool
+	creds     credentials
+	stmts     *stmtCache
+	send      sendFunc
+
+	// sessionBuf is the buffer JSON sessions are marshaled into, and
+	// bodyBuf the one request bodies are encoded into by bodyEnc.
+	sessionBuf []byte
+	bodyBuf    bytes.Buffer
+	bodyEnc    *json.Encoder
+
+	// sessionKey is the key the session is saved under in the
+	// SessionStore, and savedSession what was last saved or loaded.
+	// settingUp is set while a new session is being set up, which keeps it
+	// from being saved before it has its settings.
+	sessionKey   string
+	savedSession []byte
+	settingUp    bool
+
+	// status is the HTTP status of the last response, for tracing, and
+	// retries is how many times the last request was retried.
+	status  int
+	retries int
+
+	// noProtobuf is set once the server has rejected a protobuf request,
+	// so the connection uses JSON instead.
+	noProtobuf bool
+
+	// endpoint is the endpoint requests are sent to, which changes when
+	// the connection fails over.
+	endpoint Endpoint
+
+	// regions are the connections to other regions, by name.
+	regions map[string]*PsConn
+
+	// inUse is set while a call is running on the connection, and closed
+	// once it has been closed.
+	inUse  atomic.Bool
+	closed bool
+
+	// queryTags is the comment ConnectionAttributes tag queries with.
+	queryTags string
+
+	// limiter limits the requests in flight from the connections sharing
+	// it, if the connection has one.
+	limiter *limiter
+
+	executorEndpoint string
+	streamEndpoint   string
+	sessionEndpoint  string
+}
+
+var _ driver.DriverContext = PsDriver{}
+
+var (
+	_ driver.Conn            = (*PsConn)(nil)
+	_ driver.QueryerContext  = (*PsConn)(nil)
+	_ driver.ExecerContext   = (*PsConn)(nil)
+	_ driver.Pinger          = (*PsConn)(nil)
+	_ driver.SessionResetter = (*PsConn)(nil)
+	_ driver.Validator       = (*PsConn)(nil)
+)
+
+// sendFunc sends a request to the named backend. Connections use their
+// Transport unless one is set, which tests do to stub the API.
+type sendFunc func(ctx context.Context, req *fsthttp.Request, backend string) (*fsthttp.Response, error)
+
+// credentials are the most recently used username and password along with
+// the Authorization header derived from them.
+type credentials struct {
 	username string
 	password string
-	host     string
-	backend  string
-	session  []byte
+	header   string
+	expires  time.Time
 }
 
 type PsField struct {
@@ -43,6 +141,7 @@ type PsField struct {
 	Table        string
 	ColumnLength uint
 	Charset      uint
+	Decimals     uint
 	Flags        uint
 }
 
@@ -50,98 +149,442 @@ type PsRow struct {
 	Values [][]byte
 }
 
+// PsResults is a single query result. Rows are read from the response as
+// Next reaches them, so a result is never held in memory all at once and
+// callers that stop early (such as QueryRow) don't pay to decode the rest.
 type PsResults struct {
-	Fields []PsField
-	Rows   []PsRow
-	pos    int
+	Fields    []PsField
+	rows      rowSource
+	row       encodedRow
+	values    [][]byte
+	pos       int
+	maxRows   int
+	truncate  bool
+	truncated bool
+	warnings  []string
+
+	// validateJSON makes Next check that JSON values are valid.
+	validateJSON bool
+
+	// decodeDecimal converts DECIMAL values, which are strings if it is nil.
+	decodeDecimal DecimalDecoder
+
+	// loc is the time zone of date and time values, which are returned as
+	// raw text if it is nil.
+	loc *time.Location
+
+	// span is the span of the query, ended with the number of rows read
+	// when the results are closed, which are reported to metrics too.
+	span     Span
+	metrics  MetricsCollector
+	stats    *QueryStats
+	rowsRead int
 }
 
+var _ driver.RowsNextResultSet = (*PsResults)(nil)
+
 func (d PsDriver) Open(dsn string) (driver.Conn, error) {
-	m, err := url.ParseQuery(dsn)
+	cfg, err := ParseDSN(dsn)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing dsn: %w", err)
+		return nil, err
 	}
 
-	return PsConn{
-		username: m.Get("username"),
-		password: m.Get("password"),
-		host:     m.Get("host"),
-		backend:  m.Get("backend"),
-	}, nil
+	c := newConn(*cfg)
+	if err := c.validate(context.Background()); err != nil {
+		return nil, err
+	}
+	return c, nil
 }
 
-func (c PsConn) Close() error {
-	c.session = nil
+// validate creates the connection's session right away if ValidateOnOpen is
+// set, so a bad host, backend or credentials are reported when the
+// connection is opened rather than by its first query.
+func (c *PsConn) validate(ctx context.Context) error {
+	if !c.cfg.ValidateOnOpen {
+		return nil
+	}
+
+	err := c.refreshSession(ctx)
+	if err == nil {
+		return nil
+	}
+
+	var httpErr *httpError
+	switch {
+	case errors.As(err, &httpErr) && (httpErr.status == fsthttp.StatusUnauthorized || httpErr.status == fsthttp.StatusForbidden):
+		return fmt.Errorf("error validating connection to %s: credentials rejected: %w", c.currentEndpoint().Host, err)
+	case errors.As(err, &httpErr) && httpErr.status == fsthttp.StatusNotFound:
+		return fmt.Errorf("error validating connection to %s: API not found, check the host and apiPrefix: %w", c.currentEndpoint().Host, err)
+	case c.bad:
+		return fmt.Errorf("error validating connection to %s: request failed, check the host and backend %q: %w", c.currentEndpoint().Host, c.currentEndpoint().Backend, err)
+	}
+	return fmt.Errorf("error validating connection to %s: %w", c.currentEndpoint().Host, err)
+}
+
+// OpenConnector parses dsn once so database/sql doesn't reparse it for every
+// new connection.
+func (d PsDriver) OpenConnector(dsn string) (driver.Connector, error) {
+	cfg, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewConnector(WithConfig(cfg)), nil
+}
+
+func newConn(cfg Config) *PsConn {
+	prefix := cfg.APIPrefix
+	if prefix == "" {
+		prefix = defaultAPIPrefix
+	}
+
+	return &PsConn{
+		cfg:              cfg,
+		stmts:            newStmtCache(cfg.StmtCacheSize),
+		queryTags:        queryTags(cfg.ConnectionAttributes),
+		executorEndpoint: prefix + executorPath,
+		streamEndpoint:   prefix + streamExecutorPath,
+		sessionEndpoint:  prefix + sessionPath,
+	}
+}
+
+// String describes the connection with its password masked.
+func (c *PsConn) String() string {
+	return c.cfg.String()
+}
+
+// Close drops the connection's session, and those of its connections to
+// other regions. Calls made after the connection is closed fail with
+// driver.ErrBadConn.
+func (c *PsConn) Close() error {
+	release, err := c.use()
+	if err != nil && !errors.Is(err, driver.ErrBadConn) {
+		return err
+	}
+	defer release()
+
+	c.closed = true
+	c.session, c.sessionID = nil, ""
+	for _, rc := range c.regions {
+		rc.Close()
+	}
+	c.regions = nil
 	return nil
 }
 
-func (c PsConn) Prepare(query string) (driver.Stmt, error) {
-	return nil, fmt.Errorf("Prepare method not implemented")
+// use marks the connection as in use until release is called, failing if
+// it already is or the connection is closed.
+func (c *PsConn) use() (release func(), err error) {
+	if !c.inUse.CompareAndSwap(false, true) {
+		return func() {}, ErrConcurrentUse
+	}
+	release = func() { c.inUse.Store(false) }
+	if c.closed {
+		return release, driver.ErrBadConn
+	}
+	return release, nil
 }
 
-func (c PsConn) Begin() (driver.Tx, error) {
-	return nil, fmt.Errorf("Begin method not implemented")
+// authorization returns the Authorization header value for the next request.
+// Credentials from a CredentialProvider and tokens from a TokenProvider are
+// cached for the configured TTL, or until they are rejected, and the header
+// is only recomputed when they change.
+func (c *PsConn) authorization(ctx context.Context) (string, error) {
+	if c.cfg.TokenProvider != nil || c.cfg.BearerToken != "" {
+		return c.bearerAuthorization(ctx)
+	}
+
+	username, password := c.cfg.Username, c.cfg.Password
+
+	if p := c.cfg.CredentialProvider; p != nil {
+		if c.creds.header != "" && (c.cfg.CredentialTTL < 0 || time.Now().Before(c.creds.expires)) {
+			return c.creds.header, nil
+		}
+
+		var err error
+		username, password, err = p(ctx)
+		if err != nil {
+			return "", fmt.Errorf("error getting credentials: %w", err)
+		}
+		c.creds.expires = time.Now().Add(c.cfg.CredentialTTL)
+	}
+
+	if c.creds.header == "" || username != c.creds.username || password != c.creds.password {
+		auth := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+		c.creds.username = username
+		c.creds.password = password
+		c.creds.header = "Basic " + auth
+	}
+
+	return c.creds.header, nil
 }
 
-func (c *PsConn) Rollback() (driver.Stmt, error) {
-	return nil, fmt.Errorf("Rollback method not implemented")
+// bearerAuthorization returns the Authorization header for a bearer token.
+// The token is kept as the credentials' password, so it is redacted from
+// errors like one.
+func (c *PsConn) bearerAuthorization(ctx context.Context) (string, error) {
+	token := c.cfg.BearerToken
+
+	if p := c.cfg.TokenProvider; p != nil {
+		if c.creds.header != "" && (c.cfg.CredentialTTL < 0 || time.Now().Before(c.creds.expires)) {
+			return c.creds.header, nil
+		}
+
+		var err error
+		token, err = p(ctx)
+		if err != nil {
+			return "", fmt.Errorf("error getting token: %w", err)
+		}
+		c.creds.expires = time.Now().Add(c.cfg.CredentialTTL)
+	}
+
+	if c.creds.header == "" || c.creds.username != "" || token != c.creds.password {
+		c.creds.username = ""
+		c.creds.password = token
+		c.creds.header = "Bearer " + token
+	}
+
+	return c.creds.header, nil
 }
 
-func (c *PsConn) buildRequest(endpoint string, body []byte) (*fsthttp.Request, error) {
-	u := "https://" + c.host + endpoint
+func (c *PsConn) buildRequest(ctx context.Context, endpoint string, body []byte) (*fsthttp.Request, error) {
+	host := c.currentEndpoint().Host
+	u := "https://" + host + endpoint
 
 	req, err := fsthttp.NewRequest(executorMethod, u, nil)
 	if err != nil {
 		return nil, err
 	}
 
+	body, err = c.compressRequest(req, body)
+	if err != nil {
+		return nil, err
+	}
 	req.Body = io.NopCloser(bytes.NewReader(body))
 
-	auth := base64.StdEncoding.EncodeToString([]byte(c.username + ":" + c.password))
-	req.Header.Add("Host", c.host)
-	req.Header.Add("Content-Type", jsonContentType)
-	req.Header.Add("User-Agent", userAgent)
-	req.Header.Add("Authorization", "Basic "+auth)
+	opts := c.requestOptions(ctx)
+	req.CacheOptions = opts.CacheOptions
+	req.SendPollInterval = opts.SendPollInterval
+
+	auth, err := c.authorization(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := jsonContentType
+	switch {
+	case endpoint == c.streamEndpoint && c.useProtobuf():
+		contentType = connectProtoContentType
+	case endpoint == c.streamEndpoint:
+		contentType = connectStreamContentType
+	case c.useProtobuf():
+		contentType = protobufContentType
+	}
+
+	for k, v := range c.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	ua := userAgent
+	if c.cfg.AppName != "" {
+		ua += " " + c.cfg.AppName
+	}
+
+	req.Header.Set("Host", host)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", ua)
+	req.Header.Set("Authorization", auth)
 
 	return req, nil
 }
 
-func (c *PsConn) sendRequest(ctx context.Context, req *fsthttp.Request) ([]byte, error) {
-	resp, err := req.Send(ctx, c.backend)
+// redact masks any credentials that appear in b, such as when an error
+// response echoes part of the request, as well as the credentials of any
+// Basic or Bearer authorization in it.
+func (c *PsConn) redact(b []byte) []byte {
+	for _, secret := range []string{c.creds.password, c.creds.header, strings.TrimPrefix(c.creds.header, "Basic ")} {
+		if secret != "" {
+			b = bytes.ReplaceAll(b, []byte(secret), []byte("****"))
+		}
+	}
+	for _, scheme := range []string{"Basic ", "Bearer "} {
+		b = maskAuthorization(b, []byte(scheme))
+	}
+	return b
+}
+
+// maskAuthorization replaces the credentials following each occurrence of
+// scheme in b with ****.
+func maskAuthorization(b, scheme []byte) []byte {
+	for i := 0; ; {
+		j := bytes.Index(b[i:], scheme)
+		if j < 0 {
+			return b
+		}
+		start := i + j + len(scheme)
+		end := start
+		for end < len(b) && isTokenByte(b[end]) {
+			end++
+		}
+		if end > start && string(b[start:end]) != "****" {
+			b = append(b[:start:start], append([]byte("****"), b[end:]...)...)
+		}
+		i = start
+	}
+}
+
+// isTokenByte reports whether ch can be part of a base64 or bearer token.
+func isTokenByte(ch byte) bool {
+	return isIdentByte(ch) && ch != '$' || strings.IndexByte("+/=-._~", ch) >= 0
+}
+
+// sendRequest sends req and returns the body of the response, which the
+// caller must close. Responses other than 200 OK are returned as errors.
+func (c *PsConn) sendRequest(ctx context.Context, req *fsthttp.Request) (io.ReadCloser, error) {
+	send := c.transport()
+
+	// A request that fails before a complete response arrives leaves the
+	// connection in an unknown state, unless it failed because ctx ended.
+	c.bad = false
+	c.status = 0
+
+	// Don't start a request that couldn't finish before ctx ends.
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	backend, err := c.backend()
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := c.limiter.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	timeout := c.requestOptions(ctx).FirstByteTimeout
+	sendCtx, stop, cancel := firstByteTimeout(ctx, timeout)
+	resp, err := send(sendCtx, req, backend)
+	// The request stops counting against the limit once its response
+	// arrives. Holding the slot while the rows are read would deadlock
+	// queries run while as many others' rows are open as the limit allows.
+	release()
+	if timedOut := stop(); timedOut && ctx.Err() == nil {
+		// A response that arrived as the timeout passed can't be read with
+		// the ended context, so it is dropped too.
+		if err == nil {
+			resp.Body.Close()
+		}
+		err = fmt.Errorf("%w of %s", ErrFirstByteTimeout, timeout)
+	}
 	if err != nil {
+		cancel()
+		c.bad = ctx.Err() == nil
 		return nil, err
 	}
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: cancel}
+	resp.Body = &ctxBody{ctx: ctx, ReadCloser: resp.Body}
+	c.status = resp.StatusCode
 
-	respBody, err := io.ReadAll(resp.Body)
+	body, err := decompressBody(resp)
 	if err != nil {
-		return nil, fmt.Errorf("planetscale API error reading response body: %s", err)
+		resp.Body.Close()
+		c.bad = ctx.Err() == nil
+		return nil, fmt.Errorf("planetscale API error reading response body: %w", err)
+	}
+	resp.Body = body
+	if n := c.cfg.MaxResponseBytes; n > 0 {
+		resp.Body = &limitedBody{ReadCloser: resp.Body, n: int64(n), limit: n}
 	}
 
 	if resp.StatusCode != fsthttp.StatusOK {
+		respBody, err := c.readBody(ctx, resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return nil, &httpError{status: resp.StatusCode, body: c.redact(respBody)}
+	}
 
-		return nil, fmt.Errorf("planetscale API error: %d\n%s", resp.StatusCode, respBody)
+	return resp.Body, nil
+}
+
+// ctxBody is a response body that stops being read once its context ends.
+// Send only waits for the response's headers as long as the context allows,
+// so this keeps a slow response from holding up the caller past its
+// deadline while the body arrives.
+type ctxBody struct {
+	ctx context.Context
+	io.ReadCloser
+}
+
+func (b *ctxBody) Read(p []byte) (int, error) {
+	if err := b.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return b.ReadCloser.Read(p)
+}
+
+// limitedBody is a response body that fails with ErrMaxResponseBytes once
+// more than limit bytes have been read, leaving n to go.
+type limitedBody struct {
+	io.ReadCloser
+	n     int64
+	limit int
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.n < 0 {
+		return 0, fmt.Errorf("%w: limit is %d bytes", ErrMaxResponseBytes, b.limit)
+	}
+	// Read one byte past the limit so a body of exactly limit bytes ends
+	// normally.
+	if int64(len(p)) > b.n+1 {
+		p = p[:b.n+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.n -= int64(n)
+	if b.n < 0 {
+		return n + int(b.n), fmt.Errorf("%w: limit is %d bytes", ErrMaxResponseBytes, b.limit)
 	}
+	return n, err
+}
+
+// readBody reads and closes a response body.
+func (c *PsConn) readBody(ctx context.Context, body io.ReadCloser) ([]byte, error) {
+	defer body.Close()
 
-	return respBody, nil
+	b, err := io.ReadAll(body)
+	if err != nil {
+		c.bad = ctx.Err() == nil
+		return nil, fmt.Errorf("planetscale API error reading response body: %w", err)
+	}
+	return b, nil
 }
 
 func (c *PsConn) Query(query string, args []driver.Value) (driver.Rows, error) {
-	return c.QueryContext(context.Background(), query, args)
+	return c.QueryContext(context.Background(), query, namedValues(args))
 }
 
 func (c *PsConn) readFields(f *fastjson.Value) ([]PsField, error) {
 	if f == nil {
-		return nil, fmt.Errorf("missing fields")
+		return nil, protocolErrorf("missing fields")
+	}
+	if c.cfg.StrictResponses {
+		if err := validateFields(f); err != nil {
+			return nil, err
+		}
 	}
 
-	var fields []PsField
-	for _, v := range f.GetArray() {
+	arr := f.GetArray()
+	fields := make([]PsField, 0, len(arr))
+	for _, v := range arr {
 		fields = append(fields, PsField{
 			Name:         string(v.GetStringBytes("name")),
 			Type:         string(v.GetStringBytes("type")),
 			Table:        string(v.GetStringBytes("table")),
 			ColumnLength: v.GetUint("columnLength"),
 			Charset:      v.GetUint("charset"),
+			Decimals:     v.GetUint("decimals"),
 			Flags:        v.GetUint("flags"),
 		})
 	}
@@ -149,124 +592,498 @@ func (c *PsConn) readFields(f *fastjson.Value) ([]PsField, error) {
 	return fields, nil
 }
 
-func (c *PsConn) readRows(v *fastjson.Value) ([]PsRow, error) {
-	if v == nil {
-		return nil, fmt.Errorf("missing rows")
+// decodeRow splits the values of an encoded row into columns using the row's
+// lengths. NULL columns are nil. The columns are stored in values if it is
+// large enough, so callers that don't keep the row can reuse one slice for
+// every row.
+func decodeRow(v encodedRow, values [][]byte) (PsRow, error) {
+	dst := v.Values
+	if cap(values) < len(v.Lengths) {
+		values = make([][]byte, len(v.Lengths))
 	}
+	row := PsRow{values[:len(v.Lengths)]}
 
-	r := v.GetArray()
-	rows := make([]PsRow, len(r))
-
-	for i, v := range r {
-		b := v.GetStringBytes("values")
-		dst := make([]byte, base64.StdEncoding.DecodedLen(len(b)))
-		n, err := base64.StdEncoding.Decode(dst, b)
+	var pos int64
+	for i, l := range v.Lengths {
+		n, err := strconv.ParseInt(string(l), 10, 64)
 		if err != nil {
-			return nil, err
+			return PsRow{}, &ProtocolError{Msg: fmt.Sprintf("column %d: invalid length", i), Err: err}
 		}
-		dst = dst[:n]
-
-		lengths := v.GetArray("lengths")
-		row := PsRow{make([][]byte, len(lengths))}
-
-		var pos uint64
-		for i, l := range lengths {
-			val := string(l.GetStringBytes())
-			u, err := strconv.ParseUint(val, 10, 64)
-			if err != nil {
-				return nil, err
-			}
-			row.Values[i] = dst[pos : pos+u]
-			pos += u
+		// NULL values have a length of -1 and take up no space in values.
+		if n < 0 {
+			row.Values[i] = nil
+			continue
+		}
+		if n > int64(len(dst))-pos {
+			return PsRow{}, protocolErrorf("column %d: length %d overruns %d byte row value", i, n, len(dst))
 		}
+		row.Values[i] = dst[pos : pos+n]
+		pos += n
+	}
 
-		rows[i] = row
+	if pos != int64(len(dst)) {
+		return PsRow{}, protocolErrorf("lengths total %d bytes but row value is %d bytes", pos, len(dst))
 	}
 
-	return rows, nil
+	return row, nil
+}
+
+// readWarnings collects the warnings vtgate attached to the session for the
+// statement that was just executed.
+func readWarnings(session *fastjson.Value) []string {
+	var warnings []string
+	for _, w := range session.GetArray("vitessSession", "warnings") {
+		warnings = append(warnings, fmt.Sprintf("Warning %d: %s", w.GetUint("code"), w.GetStringBytes("message")))
+	}
+	return warnings
 }
 
+// refreshSession creates a new session and sets it up with the connection's
+// collation and InitStatements. If setting it up fails, the session is
+// dropped, so the next query doesn't run on it without its settings and
+// sets up a new one instead.
 func (c *PsConn) refreshSession(ctx context.Context) error {
-	req, err := c.buildRequest(sessionEndpoint, []byte("{}"))
+	collation := c.cfg.Collation
+	if collation != "" && !isCollationName(collation) {
+		return fmt.Errorf("invalid collation %q", collation)
+	}
+
+	create := c.withProtobufFallback(func() error {
+		ctx, span := c.startSpan(ctx, "planetscale.CreateSession", "")
+		err := c.createSession(ctx)
+		c.endSpan(span, err)
+		return err
+	})
+
+	c.settingUp = true
+	err := create()
+	if err == nil {
+		err = c.initSession(ctx, collation)
+	}
+	c.settingUp = false
 	if err != nil {
+		c.session, c.sessionID, c.routing = nil, "", routing{}
 		return err
 	}
+	c.saveSession(ctx)
+
+	if fn := c.cfg.OnSessionCreated; fn != nil {
+		fn(ctx, c.sessionID)
+	}
+	return nil
+}
+
+// initSession runs the statements that set up a new session.
+func (c *PsConn) initSession(ctx context.Context, collation string) error {
+	if collation != "" {
+		charset, _, _ := strings.Cut(collation, "_")
+		if err := c.run(ctx, "SET NAMES "+charset+" COLLATE "+collation); err != nil {
+			return err
+		}
+	}
 
-	respBody, err := c.sendRequest(ctx, req)
+	for _, stmt := range c.cfg.InitStatements {
+		if err := c.run(ctx, stmt); err != nil {
+			return fmt.Errorf("init statement %q: %w", stmt, err)
+		}
+	}
+	return nil
+}
+
+// createSession creates a new session for the connection.
+func (c *PsConn) createSession(ctx context.Context) error {
+	body := []byte("{}")
+	if c.useProtobuf() {
+		body = nil
+	}
+
+	// Creating a session has no side effects, so a failed attempt can safely
+	// be retried, including by database/sql on another connection.
+	respBody, err := c.request(ctx, c.sessionEndpoint, body, true)
 	if err != nil {
+		if c.bad {
+			return fmt.Errorf("%w: %v", driver.ErrBadConn, err)
+		}
+		return err
+	}
+	c.routing = routing{}
+
+	if c.useProtobuf() {
+		session, err := decodeCreateSessionResponse(respBody)
+		if err != nil {
+			return err
+		}
+		_, err = c.setProtoSession(ctx, session)
 		return err
 	}
 
-	var p fastjson.Parser
+	p := parserPool.Get()
+	defer parserPool.Put(p)
+
 	v, err := p.ParseBytes(respBody)
+	if err != nil {
+		return &ProtocolError{Msg: "malformed JSON", Err: err}
+	}
 
-	c.session = []byte{}
-	c.session = v.GetObject("session").MarshalTo(c.session)
+	session := v.Get("session")
+	if session == nil || session.Type() != fastjson.TypeObject {
+		return protocolErrorf("no session")
+	}
+	c.setSession(ctx, session)
 	return nil
 }
 
-func (c *PsConn) QueryContext(ctx context.Context, query string, args []driver.Value) (driver.Rows, error) {
-	if c.session == nil {
-		if err := c.refreshSession(ctx); err != nil {
-			return nil, err
+// setSession stores the session returned with a response, which is sent back
+// with the next request.
+func (c *PsConn) setSession(ctx context.Context, session *fastjson.Value) {
+	c.session = c.marshalSession(session)
+	c.sessionID = string(session.GetStringBytes("vitessSession", "SessionUUID"))
+	c.saveSession(ctx)
+}
+
+// marshalSession marshals session into the connection's session buffer,
+// which is reused for each new session. Request bodies copy the session, so
+// nothing else holds on to the buffer.
+func (c *PsConn) marshalSession(session *fastjson.Value) []byte {
+	c.sessionBuf = session.MarshalTo(c.sessionBuf[:0])
+	return c.sessionBuf
+}
+
+// sessionExpiredMessages are fragments of the error messages returned when a
+// session is no longer usable.
+var sessionExpiredMessages = []string{
+	"session expired",
+	"invalid session",
+	"session not found",
+}
+
+func isSessionExpired(msg string) bool {
+	msg = strings.ToLower(msg)
+	for _, m := range sessionExpiredMessages {
+		if strings.Contains(msg, m) {
+			return true
 		}
 	}
+	return false
+}
+
+// expireSession drops a session the server rejected so the next query starts
+// a new one.
+func (c *PsConn) expireSession(ctx context.Context) {
+	id := c.sessionID
+	c.session = nil
+	c.sessionID = ""
+	c.routing = routing{}
+
+	if fn := c.cfg.OnSessionExpired; fn != nil {
+		fn(ctx, id)
+	}
+}
+
+// execute runs query on the connection's session and returns the response
+// parsed with p, which is known to not contain an error. The response is
+// only valid until p is reused.
+func (c *PsConn) execute(ctx context.Context, p *fastjson.Parser, query string, binds bindVars) (*fastjson.Value, error) {
+	ctx, span := c.startSpan(ctx, "planetscale.Execute", query)
+
+	var v *fastjson.Value
+	err := c.replayExpired(ctx, c.withProtobufFallback(func() error {
+		body, err := c.executeBody(ctx, query, binds)
+		if err != nil {
+			return err
+		}
+
+		resp, err := c.request(ctx, c.executorEndpoint, body, !c.inTx && isReadOnly(query))
+		if err != nil {
+			return err
+		}
 
-	q, err := json.Marshal(query)
+		if c.useProtobuf() {
+			pr, _, err := c.readProtoResponse(ctx, resp)
+			if err != nil {
+				return err
+			}
+			v, err = pr.json(&fastjson.Arena{})
+			return err
+		}
+
+		v, err = p.ParseBytes(resp)
+		if err != nil {
+			return &ProtocolError{Msg: "malformed JSON", Err: err}
+		}
+		if c.cfg.StrictResponses {
+			if err := validateResponse(v); err != nil {
+				return err
+			}
+		}
+
+		if session := v.Get("session"); session != nil && session.Type() == fastjson.TypeObject {
+			c.setSession(ctx, session)
+		}
+
+		if jsonErr := v.Get("error"); jsonErr != nil && jsonErr.Type() == fastjson.TypeObject {
+			return readError(jsonErr)
+		}
+		return nil
+	}))
+	if err == nil {
+		rows := len(v.GetArray("result", "rows"))
+		span.SetAttributes(Attribute{Key: "db.rows_returned", Value: rows})
+		c.metrics().ObserveRows(rows)
+
+		stats := queryStatsFrom(ctx)
+		affected, _, _ := readUint(v.Get("result"), "rowsAffected")
+		stats.addQuery(v.GetFloat64("timing"), affected)
+		stats.addRows(rows)
+	}
+	c.endSpan(span, err)
 	if err != nil {
 		return nil, err
 	}
 
-	body := []byte(`{"query":`)
-	body = append(body, q[:]...)
-	body = append(body, []byte(`,"session":`)...)
-	body = append(body, c.session[:]...)
-	body = append(body, []byte(`}`)...)
+	return v, nil
+}
+
+// replayExpired calls fn, which executes a query. If the server rejects the
+// session as expired, a new session is created and fn is called once more,
+// unless NoAutoRefresh is set or the connection is in a transaction, which
+// ended with the session.
+func (c *PsConn) replayExpired(ctx context.Context, fn func() error) error {
+	err := fn()
+
+	var psErr *Error
+	if errors.As(err, &psErr) && isSessionExpired(psErr.Message) {
+		c.expireSession(ctx)
+		if c.cfg.NoAutoRefresh || c.inTx {
+			return err
+		}
+		return fn()
+	}
+
+	return err
+}
+
+// executeRequest is the body of an Execute request. A connection without a
+// session sends a null one.
+type executeRequest struct {
+	Query         string          `json:"query"`
+	Session       json.RawMessage `json:"session"`
+	BindVariables bindVars        `json:"bindVariables,omitempty"`
+}
+
+// executeBody returns the body of an Execute request for query, creating a
+// session first if the connection doesn't have one.
+func (c *PsConn) executeBody(ctx context.Context, query string, binds bindVars) ([]byte, error) {
+	if c.inTx && c.session == nil {
+		return nil, errTxSessionExpired
+	}
+
+	if c.session == nil && !c.cfg.NoAutoRefresh {
+		if err := c.refreshSession(ctx); err != nil {
+			return nil, err
+		}
+	}
 
-	req, err := c.buildRequest(executorEndpoint, body)
+	// The directives go in first, so an execution time hint still directly
+	// follows SELECT, as MySQL requires.
+	query, err := directivesFrom(ctx).Apply(query)
 	if err != nil {
 		return nil, err
 	}
+	query = tagQuery(addExecutionTime(query, queryTimeout(ctx)), c.queryTags)
+	if c.useProtobuf() {
+		return encodeExecuteRequest(c.session, query, binds)
+	}
 
-	resp, err := c.sendRequest(ctx, req)
+	c.bodyBuf.Reset()
+	if c.bodyEnc == nil {
+		c.bodyEnc = json.NewEncoder(&c.bodyBuf)
+	}
+	err = c.bodyEnc.Encode(executeRequest{
+		Query:         query,
+		Session:       c.session,
+		BindVariables: binds,
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	var p fastjson.Parser
-	v, err := p.ParseBytes(resp)
+	// The body is copied out of the buffer, without the newline Encode
+	// adds, since a transport may still be reading it after the response
+	// arrives.
+	b := bytes.TrimSuffix(c.bodyBuf.Bytes(), []byte("\n"))
+	return append(make([]byte, 0, len(b)), b...), nil
+}
+
+// ResetSession is called by database/sql before a pooled connection is
+// reused. Connections whose last request failed at the connection level are
+// rejected, and a session left in a transaction is dropped so the next user
+// starts with a fresh one. Connections to other regions that failed are
+// dropped too.
+func (c *PsConn) ResetSession(ctx context.Context) error {
+	release, err := c.use()
+	defer release()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	if session := v.GetObject("session"); session != nil {
-		c.session = []byte{}
-		c.session = session.MarshalTo(c.session)
+	if c.bad {
+		return driver.ErrBadConn
 	}
 
-	if jsonErr := v.GetObject("error"); jsonErr != nil {
-		if msg := jsonErr.Get("message"); msg != nil {
-			return nil, fmt.Errorf("%s", msg.GetStringBytes())
+	for name, rc := range c.regions {
+		if rc.bad {
+			delete(c.regions, name)
 		}
-		return nil, unknownError
 	}
 
-	result := v.GetObject("result")
-	if result == nil {
-		return nil, fmt.Errorf("no result")
+	if c.inTx {
+		c.inTx = false
+		c.expireSession(ctx)
+	}
+
+	return nil
+}
+
+// IsValid reports whether the connection can be returned to the pool.
+func (c *PsConn) IsValid() bool {
+	return !c.bad && !c.closed
+}
+
+// Ping checks that the backend is reachable and accepts the connection's
+// credentials by running SELECT 1, creating a session first if needed.
+func (c *PsConn) Ping(ctx context.Context) error {
+	release, err := c.use()
+	defer release()
+	if err != nil {
+		return err
 	}
 
-	f, err := c.readFields(result.Get("fields"))
+	return c.run(ctx, "SELECT 1")
+}
+
+// run runs a statement whose result isn't needed.
+func (c *PsConn) run(ctx context.Context, query string) error {
+	p := parserPool.Get()
+	defer parserPool.Put(p)
+
+	_, err := c.execute(ctx, p, query, nil)
+	return err
+}
+
+func (c *PsConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	release, err := c.use()
+	defer release()
 	if err != nil {
 		return nil, err
 	}
 
-	r, err := c.readRows(result.Get("rows"))
+	var rows driver.Rows
+	err = c.withHooks(ctx, query, func(ctx context.Context) error {
+		q, binds, err := c.bindArgs(query, args)
+		if err != nil {
+			return err
+		}
+		rows, err = c.query(ctx, q, binds)
+		return err
+	})
+	return rows, err
+}
+
+func (c *PsConn) query(ctx context.Context, query string, binds bindVars) (driver.Rows, error) {
+	if rc := c.regionConn(ctx); rc != nil {
+		return rc.query(ctx, query, binds)
+	}
+
+	if ttl := c.cacheTTL(ctx, query); ttl > 0 && len(c.statements(query)) <= 1 {
+		return c.cachedResults(ctx, query, binds, ttl)
+	}
+
+	if err := c.route(ctx); err != nil {
+		return nil, err
+	}
+
+	if stmts := c.statements(query); len(stmts) > 1 {
+		return c.queryMulti(ctx, stmts, binds)
+	}
+	return c.readResults(ctx, query, binds)
+}
+
+// readResults runs query and reads its result up to the first row. The rest
+// of the response is read as the rows are, so the results hold the response
+// body open until they are closed. With StreamExecute set, the query is run
+// with the StreamExecute endpoint, whose rows arrive in chunks.
+func (c *PsConn) readResults(ctx context.Context, query string, binds bindVars) (*PsResults, error) {
+	ctx, span := c.startSpan(ctx, "planetscale.Execute", query)
+
+	results := &PsResults{
+		maxRows:       c.cfg.MaxRows,
+		truncate:      c.cfg.TruncateRows,
+		validateJSON:  c.cfg.ValidateJSON,
+		decodeDecimal: c.cfg.DecodeDecimal,
+		metrics:       c.metrics(),
+		stats:         queryStatsFrom(ctx),
+	}
+	if !c.cfg.NoParseTime {
+		results.loc = c.cfg.location()
+	}
+
+	err := c.replayExpired(ctx, c.withProtobufFallback(func() error {
+		body, err := c.executeBody(ctx, query, binds)
+		if err != nil {
+			return err
+		}
+
+		endpoint := c.executorEndpoint
+		if c.cfg.StreamExecute {
+			endpoint, body = c.streamEndpoint, envelope(body)
+		}
+
+		resp, err := c.openRequest(ctx, endpoint, body, !c.inTx && isReadOnly(query))
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case c.cfg.StreamExecute:
+			s := newChunkStream(ctx, c, resp)
+			err = s.start()
+			results.Fields, results.warnings, results.rows = s.fields, s.warnings, s
+		case c.useProtobuf():
+			// Protobuf responses can't be decoded as they are read, but the
+			// whole response takes about half the memory of a JSON one.
+			var b []byte
+			if b, err = c.readBody(ctx, resp); err != nil {
+				return err
+			}
+			pr, warnings, err := c.readProtoResponse(ctx, b)
+			if err != nil {
+				return err
+			}
+			if !pr.hasResult {
+				return protocolErrorf("no result")
+			}
+			queryStatsFrom(ctx).addQuery(pr.timing, pr.rowsAffected)
+			results.Fields, results.warnings, results.rows = pr.fields, warnings, &protoRows{rows: pr.rows}
+			return nil
+		default:
+			s := newResponseStream(ctx, c, resp)
+			err = s.start()
+			results.Fields, results.warnings, results.rows = s.fields, s.warnings, s
+		}
+		if err != nil {
+			resp.Close()
+		}
+		return err
+	}))
 	if err != nil {
+		c.endSpan(span, err)
 		return nil, err
 	}
 
-	results := &PsResults{Fields: f, Rows: r}
+	c.annotateSpan(span, nil)
+	results.span = span
+	results.stats.addWarnings(len(results.warnings))
 	return results, nil
 }
 
@@ -278,22 +1095,134 @@ func (r *PsResults) Columns() []string {
 	return cols
 }
 
-func (r *PsResults) Close() error {
+// Truncated reports whether rows were dropped from the result because it
+// exceeded the connection's maxRows limit. It is only known once Next has
+// reached the limit.
+func (r *PsResults) Truncated() bool {
+	return r.truncated
+}
+
+// Warnings returns any warnings MySQL raised while executing the query, such
+// as implicit truncation, even though the query itself succeeded.
+func (r *PsResults) Warnings() []string {
+	return r.warnings
+}
+
+// HasNextResultSet reports whether another result set follows this one once
+// its rows have been read. Execute returns a single result, but a
+// StreamExecute response can hold several, such as those of a stored
+// procedure, and with MultiStatements set each statement has its own.
+func (r *PsResults) HasNextResultSet() bool {
+	return r.rows != nil && r.rows.hasNextResultSet()
+}
+
+// NextResultSet discards any unread rows and moves to the next result set.
+// It returns io.EOF if there is none.
+func (r *PsResults) NextResultSet() error {
+	if r.rows == nil {
+		return io.EOF
+	}
+
+	fields, warnings, err := r.rows.nextResultSet()
+	if err != nil {
+		return err
+	}
+
+	r.Fields, r.warnings, r.pos, r.truncated = fields, warnings, 0, false
 	return nil
 }
 
+// Close closes the response body. Rows that weren't read are discarded.
+func (r *PsResults) Close() error {
+	if r.rows == nil {
+		return nil
+	}
+	err := r.rows.close()
+	r.rows = nil
+
+	if r.metrics != nil {
+		r.metrics.ObserveRows(r.rowsRead)
+	}
+	r.stats.addRows(r.rowsRead)
+	if r.span != nil {
+		r.span.SetAttributes(Attribute{Key: "db.rows_returned", Value: r.rowsRead})
+		r.span.End()
+		r.span = nil
+	}
+	return err
+}
+
+// Next decodes the next row into dest, converting values according to their
+// column's type. Binary columns such as BLOB and VARBINARY are the exact bytes
+// returned by the server, including any null or invalid UTF-8 bytes, and
+// JSON columns are their JSON text as is.
+//
+// The []byte values Next returns stay valid after later calls to Next and
+// after Close, since each row is decoded into a buffer of its own, or
+// stays in a protobuf response that is never overwritten. With
+// Config.ZeroCopyRows set, rows of JSON responses are decoded into a single
+// buffer instead, so their []byte values are only valid until the next call
+// to Next, like sql.RawBytes; database/sql copies them when scanning into
+// anything but a *sql.RawBytes.
+//
+// If the connection has a MaxRows limit and the result exceeds it, Next
+// returns ErrMaxRows after the first MaxRows rows or, when TruncateRows is
+// set, stops there and the result reports that it was truncated.
 func (r *PsResults) Next(dest []driver.Value) error {
-	if r.pos+1 > len(r.Rows) {
+	if r.rows == nil || r.truncated {
 		return io.EOF
 	}
 
-	row := r.Rows[r.pos]
+	more, err := r.rows.nextRow(&r.row)
+	if err != nil {
+		return err
+	}
+	if !more {
+		return io.EOF
+	}
+
+	if r.maxRows > 0 && r.pos == r.maxRows {
+		if !r.truncate {
+			return fmt.Errorf("%w: limit is %d", ErrMaxRows, r.maxRows)
+		}
+		r.truncated = true
+		return io.EOF
+	}
+
+	row, err := decodeRow(r.row, r.values)
+	if err != nil {
+		return fmt.Errorf("row %d: %w", r.pos, err)
+	}
+	r.values = row.Values
+
+	// A row that doesn't match the fields would put values in the wrong
+	// columns, or past the end of dest.
+	if len(row.Values) != len(r.Fields) {
+		return fmt.Errorf("row %d: %d values for %d columns", r.pos, len(row.Values), len(r.Fields))
+	}
+	if len(dest) < len(row.Values) {
+		return fmt.Errorf("row %d: %d columns don't fit in %d destination values", r.pos, len(row.Values), len(dest))
+	}
 
 	for i := 0; i != len(row.Values); i++ {
-		dest[i] = row.Values[i]
+		if row.Values[i] == nil {
+			dest[i] = nil
+			continue
+		}
+		if r.validateJSON && r.Fields[i].Type == "JSON" {
+			if err := validJSON(row.Values[i]); err != nil {
+				return fmt.Errorf("row %d column %s: %w", r.pos, r.Fields[i].Name, err)
+			}
+		}
+		v, err := r.Fields[i].convert(row.Values[i], r.loc, r.decodeDecimal)
+		if err != nil {
+			return fmt.Errorf("row %d column %s: %w", r.pos, r.Fields[i].Name, err)
+		}
+		dest[i] = v
 	}
 
 	r.pos++
+	r.rowsRead++
 	return nil
 }
 
@@ -1,8 +1,21 @@
 package planetscale
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+	"github.com/valyala/fastjson"
 )
 
 func TestDriverOpen(t *testing.T) {
@@ -11,3 +24,852 @@ func TestDriverOpen(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func parseJSON(t *testing.T, s string) *fastjson.Value {
+	t.Helper()
+	var p fastjson.Parser
+	v, err := p.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// threeRows is a rows array of three single-column rows with the values
+// "1", "2" and "3".
+const threeRows = `[
+	{"lengths":["1"],"values":"MQ=="},
+	{"lengths":["1"],"values":"Mg=="},
+	{"lengths":["1"],"values":"Mw=="}
+]`
+
+// threeRowsConn returns a connection that answers every query with
+// threeRows.
+func threeRowsConn(cfg Config) *PsConn {
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		return 200, `{"session":{},"result":{"fields":[{"name":"n","type":"VARCHAR"}],"rows":` + threeRows + `}}`
+	})
+	c.cfg.MaxRows, c.cfg.TruncateRows = cfg.MaxRows, cfg.TruncateRows
+	return c
+}
+
+// readValues reads the single column values of all rows, returning the error
+// that ended them other than io.EOF.
+func readValues(t *testing.T, rows driver.Rows) ([]string, error) {
+	t.Helper()
+	defer rows.Close()
+
+	var values []string
+	dest := make([]driver.Value, 1)
+	for {
+		err := rows.Next(dest)
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return values, err
+		}
+		switch v := dest[0].(type) {
+		case string:
+			values = append(values, v)
+		default:
+			values = append(values, string(v.([]byte)))
+		}
+	}
+}
+
+func TestReadRowsMaxRowsError(t *testing.T) {
+	c := threeRowsConn(Config{MaxRows: 2})
+	rows, err := c.QueryContext(context.Background(), "SELECT n FROM t", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readValues(t, rows); !errors.Is(err, ErrMaxRows) {
+		t.Fatalf("expected ErrMaxRows, got %v", err)
+	}
+}
+
+func TestReadRowsMaxRowsTruncate(t *testing.T) {
+	c := threeRowsConn(Config{MaxRows: 2, TruncateRows: true})
+	rows, err := c.QueryContext(context.Background(), "SELECT n FROM t", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := readValues(t, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rows.(*PsResults).Truncated() {
+		t.Fatal("expected result to be truncated")
+	}
+	if got := strings.Join(values, ","); got != "1,2" {
+		t.Fatalf("expected rows 1,2, got %s", got)
+	}
+
+	c.cfg.MaxRows = 3
+	rows, err = c.QueryContext(context.Background(), "SELECT n FROM t", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readValues(t, rows); err != nil {
+		t.Fatal(err)
+	}
+	if rows.(*PsResults).Truncated() {
+		t.Fatal("result at the limit should not be truncated")
+	}
+}
+
+func TestDriverOpenMaxRows(t *testing.T) {
+	conn, err := (PsDriver{}).Open("host=guh&maxRows=10&truncateRows=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := conn.(*PsConn)
+	if c.cfg.MaxRows != 10 || !c.cfg.TruncateRows {
+		t.Fatalf("unexpected limits: maxRows=%d truncateRows=%v", c.cfg.MaxRows, c.cfg.TruncateRows)
+	}
+
+	if _, err := (PsDriver{}).Open("maxRows=lots"); err == nil {
+		t.Fatal("expected error for invalid maxRows")
+	}
+}
+
+func TestReadWarnings(t *testing.T) {
+	v := parseJSON(t, `{"session":{"vitessSession":{"warnings":[
+		{"code":1265,"message":"Data truncated for column 'name' at row 1"}
+	]}}}`)
+
+	warnings := readWarnings(v.Get("session"))
+	if len(warnings) != 1 {
+		t.Fatalf("expected 1 warning, got %d", len(warnings))
+	}
+	if want := "Warning 1265: Data truncated for column 'name' at row 1"; warnings[0] != want {
+		t.Fatalf("expected %q, got %q", want, warnings[0])
+	}
+
+	if warnings := readWarnings(parseJSON(t, `{}`)); warnings != nil {
+		t.Fatalf("expected no warnings, got %v", warnings)
+	}
+}
+
+func TestCredentialProviderRotation(t *testing.T) {
+	creds := [][2]string{{"alice", "first"}, {"alice", "second"}}
+	var calls int
+	c := &PsConn{cfg: Config{
+		Host: "example.com",
+		CredentialProvider: func(ctx context.Context) (string, string, error) {
+			cred := creds[calls]
+			calls++
+			return cred[0], cred[1], nil
+		},
+		CredentialTTL: time.Hour,
+	}}
+
+	auth := func() string {
+		t.Helper()
+		req, err := c.buildRequest(context.Background(), c.executorEndpoint, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return req.Header.Get("Authorization")
+	}
+	basic := func(user, pass string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+pass))
+	}
+
+	if got, want := auth(), basic("alice", "first"); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+	if got, want := auth(), basic("alice", "first"); got != want || calls != 1 {
+		t.Fatalf("expected cached %q after 1 call, got %q after %d calls", want, got, calls)
+	}
+
+	c.creds.expires = time.Now().Add(-time.Second)
+	if got, want := auth(), basic("alice", "second"); got != want {
+		t.Fatalf("expected rotated %q, got %q", want, got)
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	c := newConn(Config{Host: "example.com", Username: "alice", Password: "unused", BearerToken: "pscale_tkn_abc"})
+	req, err := c.buildRequest(context.Background(), c.executorEndpoint, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := req.Header.Get("Authorization"); got != "Bearer pscale_tkn_abc" {
+		t.Fatalf("expected bearer authorization, got %q", got)
+	}
+
+	tokens := []string{"expired", "fresh"}
+	var calls int
+	c = stubConn(func(endpoint string, body []byte) (int, string) {
+		if calls == 1 {
+			return 401, "token expired"
+		}
+		return 200, `{"session":{},"result":{}}`
+	})
+	c.cfg.TokenProvider = func(ctx context.Context) (string, error) {
+		token := tokens[calls]
+		calls++
+		return token, nil
+	}
+	c.cfg.CredentialTTL = -1
+
+	if err := c.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 || c.creds.header != "Bearer fresh" {
+		t.Fatalf("expected a rejected token to be replaced, got %q after %d calls", c.creds.header, calls)
+	}
+	if got := string(c.redact([]byte("echo fresh"))); got != "echo ****" {
+		t.Fatalf("expected the token to be redacted, got %q", got)
+	}
+}
+
+func TestExtraHeadersAndAppName(t *testing.T) {
+	var cfg Config
+	for _, opt := range []Option{
+		WithHost("example.com"),
+		WithHeader("X-Trace-Id", "abc123"),
+		WithHeader("Authorization", "Bearer nope"),
+		WithAppName("checkout/1.2"),
+	} {
+		opt(&cfg)
+	}
+	c := newConn(cfg)
+
+	req, err := c.buildRequest(context.Background(), c.executorEndpoint, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := req.Header.Get("X-Trace-Id"); got != "abc123" {
+		t.Fatalf("expected the extra header, got %q", got)
+	}
+	if got := req.Header.Get("User-Agent"); got != "database-go checkout/1.2" {
+		t.Fatalf("unexpected User-Agent %q", got)
+	}
+	if got := req.Header.Values("Authorization"); len(got) != 1 || !strings.HasPrefix(got[0], "Basic ") {
+		t.Fatalf("expected the driver's Authorization header only, got %q", got)
+	}
+}
+
+func TestSingleResultSet(t *testing.T) {
+	r := &PsResults{}
+	if r.HasNextResultSet() {
+		t.Fatal("expected no next result set")
+	}
+	if err := r.NextResultSet(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
+
+// stubConn returns a connection whose requests are answered by handler
+// instead of being sent to a backend.
+func stubConn(handler func(endpoint string, body []byte) (int, string)) *PsConn {
+	c := newConn(Config{Host: "example.com", Backend: "planetscale"})
+	c.send = func(ctx context.Context, req *fsthttp.Request, backend string) (*fsthttp.Response, error) {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		status, resp := handler(req.URL.Path, body)
+		return &fsthttp.Response{
+			Request:    req,
+			Backend:    backend,
+			StatusCode: status,
+			Header:     fsthttp.NewHeader(),
+			Body:       io.NopCloser(strings.NewReader(resp)),
+		}, nil
+	}
+	return c
+}
+
+// rowJSON encodes values as a row in the Execute response format.
+func rowJSON(values ...string) string {
+	var lengths []string
+	for _, v := range values {
+		lengths = append(lengths, `"`+strconv.Itoa(len(v))+`"`)
+	}
+	encoded := base64.StdEncoding.EncodeToString([]byte(strings.Join(values, "")))
+	return `{"lengths":[` + strings.Join(lengths, ",") + `],"values":"` + encoded + `"}`
+}
+
+func TestDecodeRowLengthMismatch(t *testing.T) {
+	for name, row := range map[string]string{
+		"overrun":  `{"lengths":["2","5"],"values":"YWJj"}`,
+		"leftover": `{"lengths":["1"],"values":"YWJj"}`,
+	} {
+		var r encodedRow
+		if err := json.Unmarshal([]byte(row), &r); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := decodeRow(r, nil); err == nil {
+			t.Fatalf("%s: expected error for mismatched lengths", name)
+		}
+	}
+}
+
+func TestNextRejectsMismatchedColumns(t *testing.T) {
+	for name, tt := range map[string]struct {
+		fields string
+		dest   int
+		want   string
+	}{
+		"extra value":   {`[{"name":"a","type":"VARCHAR"}]`, 2, "row 0: 2 values for 1 columns"},
+		"missing value": {`[{"name":"a","type":"VARCHAR"},{"name":"b","type":"VARCHAR"},{"name":"c","type":"VARCHAR"}]`, 3, "row 0: 2 values for 3 columns"},
+		"short dest":    {`[{"name":"a","type":"VARCHAR"},{"name":"b","type":"VARCHAR"}]`, 1, "row 0: 2 columns don't fit in 1 destination values"},
+	} {
+		c := stubConn(func(endpoint string, body []byte) (int, string) {
+			return 200, `{"session":{},"result":{"fields":` + tt.fields + `,"rows":[` + rowJSON("x", "y") + `]}}`
+		})
+		rows, err := c.QueryContext(context.Background(), "SELECT a FROM t", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rows.Next(make([]driver.Value, tt.dest)); err == nil || err.Error() != tt.want {
+			t.Errorf("%s: expected %q, got %v", name, tt.want, err)
+		}
+		rows.Close()
+	}
+}
+
+func TestDecodeRowReusesValues(t *testing.T) {
+	var r encodedRow
+	if err := json.Unmarshal([]byte(`{"lengths":["1","-1","2"],"values":"YWJj"}`), &r); err != nil {
+		t.Fatal(err)
+	}
+
+	values := [][]byte{[]byte("stale"), []byte("stale"), []byte("stale")}
+	allocs := testing.AllocsPerRun(100, func() {
+		row, err := decodeRow(r, values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(row.Values[0]) != "a" || row.Values[1] != nil || string(row.Values[2]) != "bc" {
+			t.Fatalf("unexpected values %q", row.Values)
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("expected decoding into a large enough slice not to allocate, got %v allocations", allocs)
+	}
+}
+
+// largeResultConn returns a connection that answers every query with an
+// n-row result of two columns.
+func largeResultConn(n int) *PsConn {
+	rows := make([]string, n)
+	for i := range rows {
+		rows[i] = rowJSON(strconv.Itoa(i), "some moderately long value for row "+strconv.Itoa(i))
+	}
+	resp := `{"session":{"signature":"abc"},"result":{
+		"fields":[{"name":"id","type":"INT64"},{"name":"name","type":"VARCHAR"}],
+		"rows":[` + strings.Join(rows, ",") + `]}}`
+
+	return stubConn(func(endpoint string, body []byte) (int, string) {
+		return 200, resp
+	})
+}
+
+// BenchmarkQueryFirstRow fetches only the first row of a 5000 row result,
+// the way QueryRow does. Rows are decoded lazily so this doesn't pay for
+// decoding the rows that are never read; compare with BenchmarkQueryAllRows.
+func BenchmarkQueryFirstRow(b *testing.B) {
+	c := largeResultConn(5000)
+	dest := make([]driver.Value, 2)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		rows, err := c.QueryContext(context.Background(), "SELECT id, name FROM t", nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := rows.Next(dest); err != nil {
+			b.Fatal(err)
+		}
+		rows.Close()
+	}
+}
+
+func BenchmarkQueryAllRows(b *testing.B) {
+	c := largeResultConn(5000)
+	dest := make([]driver.Value, 2)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		rows, err := c.QueryContext(context.Background(), "SELECT id, name FROM t", nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for rows.Next(dest) == nil {
+		}
+		rows.Close()
+	}
+}
+
+func TestNoAutoRefresh(t *testing.T) {
+	var sessions int
+	var session []byte
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		if strings.HasSuffix(endpoint, sessionPath) {
+			sessions++
+			return 200, `{"session":{"signature":"abc"}}`
+		}
+		session = parseJSON(t, string(body)).Get("session").MarshalTo(nil)
+		return 200, `{"error":{"message":"invalid session"}}`
+	})
+	c.cfg.NoAutoRefresh = true
+
+	_, err := c.QueryContext(context.Background(), "SELECT 1", nil)
+	if err == nil || err.Error() != "invalid session" {
+		t.Fatalf("expected invalid session error, got %v", err)
+	}
+	if sessions != 0 {
+		t.Fatalf("expected no CreateSession calls, got %d", sessions)
+	}
+	if string(session) != "null" {
+		t.Fatalf("expected null session to be sent, got %s", session)
+	}
+}
+
+func TestCustomAPIPrefix(t *testing.T) {
+	cfg, err := ParseDSN("host=example.com&apiPrefix=/psdb.v1.Database")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var urls []string
+	c := newConn(*cfg)
+	c.send = func(ctx context.Context, req *fsthttp.Request, backend string) (*fsthttp.Response, error) {
+		urls = append(urls, req.URL.String())
+		return &fsthttp.Response{
+			StatusCode: 200,
+			Header:     fsthttp.NewHeader(),
+			Body:       io.NopCloser(strings.NewReader(`{"session":{},"result":{"fields":[],"rows":[]}}`)),
+		}, nil
+	}
+
+	if _, err := c.QueryContext(context.Background(), "SELECT 1", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"https://example.com/psdb.v1.Database/CreateSession",
+		"https://example.com/psdb.v1.Database/Execute",
+	}
+	if strings.Join(urls, " ") != strings.Join(want, " ") {
+		t.Fatalf("expected requests to %v, got %v", want, urls)
+	}
+}
+
+func TestSessionLifecycleCallbacks(t *testing.T) {
+	var sessions, queries int
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		if strings.HasSuffix(endpoint, sessionPath) {
+			sessions++
+			return 200, `{"session":{"vitessSession":{"SessionUUID":"s` + strconv.Itoa(sessions) + `"}}}`
+		}
+		queries++
+		if queries == 1 {
+			return 200, `{"error":{"message":"vtgate: session expired"}}`
+		}
+		return 200, `{"result":{"fields":[],"rows":[]}}`
+	})
+
+	var events []string
+	c.cfg.OnSessionCreated = func(ctx context.Context, id string) {
+		events = append(events, "created "+id)
+	}
+	c.cfg.OnSessionExpired = func(ctx context.Context, id string) {
+		events = append(events, "expired "+id)
+	}
+
+	// The query is replayed on a new session after the first is rejected.
+	if _, err := c.QueryContext(context.Background(), "SELECT 1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if queries != 2 {
+		t.Fatalf("expected the query to be replayed once, got %d attempts", queries)
+	}
+
+	want := "created s1, expired s1, created s2"
+	if got := strings.Join(events, ", "); got != want {
+		t.Fatalf("expected events %q, got %q", want, got)
+	}
+}
+
+// BenchmarkQuerySmall runs a tight loop of queries returning a single row,
+// where per-query overhead rather than row decoding dominates.
+func BenchmarkQuerySmall(b *testing.B) {
+	c := largeResultConn(1)
+	dest := make([]driver.Value, 2)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		rows, err := c.QueryContext(context.Background(), "SELECT id, name FROM t WHERE id = 1", nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for rows.Next(dest) == nil {
+		}
+		rows.Close()
+	}
+}
+
+// stubConnector hands out a single stubbed connection to database/sql.
+type stubConnector struct {
+	conn *PsConn
+}
+
+func (c stubConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.conn, nil
+}
+
+func (c stubConnector) Driver() driver.Driver {
+	return PsDriver{}
+}
+
+func TestNullValues(t *testing.T) {
+	// A NULL, "ab" and an empty string.
+	row := `{"lengths":["-1","2","0"],"values":"YWI="}`
+
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		return 200, `{"session":{},"result":{
+			"fields":[{"name":"a","type":"INT64"},{"name":"b","type":"VARCHAR"},{"name":"c","type":"VARCHAR"}],
+			"rows":[` + row + `]}}`
+	})
+	db := sql.OpenDB(stubConnector{c})
+	defer db.Close()
+
+	var a sql.NullInt64
+	var b, empty sql.NullString
+	if err := db.QueryRow("SELECT a, b, c FROM t").Scan(&a, &b, &empty); err != nil {
+		t.Fatal(err)
+	}
+	if a.Valid {
+		t.Fatalf("expected NULL, got %v", a.Int64)
+	}
+	if !b.Valid || b.String != "ab" {
+		t.Fatalf("expected ab, got %+v", b)
+	}
+	if !empty.Valid || empty.String != "" {
+		t.Fatalf("expected empty string, got %+v", empty)
+	}
+}
+
+func TestPing(t *testing.T) {
+	var queries []string
+	db := sql.OpenDB(stubConnector{recordingConn(t, &queries)})
+	defer db.Close()
+
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 1 || queries[0] != "SELECT 1" {
+		t.Fatalf("expected SELECT 1, got %v", queries)
+	}
+
+	failing := stubConn(func(endpoint string, body []byte) (int, string) {
+		return 401, "unauthorized"
+	})
+	db = sql.OpenDB(stubConnector{failing})
+	defer db.Close()
+
+	if err := db.Ping(); err == nil {
+		t.Fatal("expected ping to fail with bad credentials")
+	}
+}
+
+func TestInvalidAfterConnectionError(t *testing.T) {
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		return 200, `{"session":{},"result":{}}`
+	})
+	send := c.send
+
+	c.send = func(ctx context.Context, req *fsthttp.Request, backend string) (*fsthttp.Response, error) {
+		return nil, errors.New("connection reset")
+	}
+	if err := c.Ping(context.Background()); err == nil {
+		t.Fatal("expected ping to fail")
+	}
+	if c.IsValid() {
+		t.Fatal("expected connection to be invalid after a connection error")
+	}
+	if err := c.ResetSession(context.Background()); err != driver.ErrBadConn {
+		t.Fatalf("expected ErrBadConn, got %v", err)
+	}
+
+	c.send = send
+	if err := c.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !c.IsValid() {
+		t.Fatal("expected connection to be valid after a successful request")
+	}
+}
+
+func TestResetSessionDropsOpenTransaction(t *testing.T) {
+	var expired bool
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		return 200, `{"session":{},"result":{}}`
+	})
+	c.cfg.OnSessionExpired = func(ctx context.Context, id string) {
+		expired = true
+	}
+
+	if _, err := c.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ResetSession(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if c.inTx || c.session != nil || !expired {
+		t.Fatal("expected the transaction's session to be dropped")
+	}
+}
+
+func TestContextEndedBeforeRequest(t *testing.T) {
+	var sent bool
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		sent = true
+		return 200, `{"session":{}}`
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+
+	if _, err := c.QueryContext(ctx, "SELECT 1", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if sent {
+		t.Fatal("expected no request to be sent after the deadline")
+	}
+}
+
+func TestContextCanceledWhileReadingRows(t *testing.T) {
+	c := largeResultConn(5000)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rows, err := c.QueryContext(ctx, "SELECT id, name FROM t", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	dest := make([]driver.Value, 2)
+	if err := rows.Next(dest); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	for {
+		err = rows.Next(dest)
+		if err != nil {
+			break
+		}
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if c.bad {
+		t.Fatal("a canceled read should not mark the connection bad")
+	}
+}
+
+func TestCollationSetOnNewSession(t *testing.T) {
+	var queries []string
+	c := recordingConn(t, &queries)
+	c.cfg.Collation = "utf8mb4_unicode_ci"
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.ExecContext(context.Background(), "UPDATE t SET a = 1", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := "SET NAMES utf8mb4 COLLATE utf8mb4_unicode_ci; UPDATE t SET a = 1; UPDATE t SET a = 1"
+	if got := strings.Join(queries, "; "); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestInitStatementsRunOnEachNewSession(t *testing.T) {
+	var queries []string
+	c := recordingConn(t, &queries)
+	c.cfg.InitStatements = []string{"SET time_zone = '+00:00'", "SET @@sql_mode = 'ANSI'"}
+
+	if _, err := c.ExecContext(context.Background(), "UPDATE t SET a = 1", nil); err != nil {
+		t.Fatal(err)
+	}
+	c.expireSession(context.Background())
+	if _, err := c.ExecContext(context.Background(), "UPDATE t SET a = 1", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	init := "SET time_zone = '+00:00'; SET @@sql_mode = 'ANSI'; "
+	want := init + "UPDATE t SET a = 1; " + init + "UPDATE t SET a = 1"
+	if got := strings.Join(queries, "; "); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestInitStatementFailureDropsSession(t *testing.T) {
+	var queries []string
+	failed := false
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		if strings.HasSuffix(endpoint, sessionPath) {
+			return 200, `{"session":{"signature":"abc"}}`
+		}
+		query := string(parseJSON(t, string(body)).GetStringBytes("query"))
+		queries = append(queries, query)
+		if strings.HasPrefix(query, "SET time_zone") && !failed {
+			failed = true
+			return 200, `{"error":{"message":"Unknown or incorrect time zone (errno 1298) (sqlstate HY000)"}}`
+		}
+		return 200, `{"session":{"signature":"abc"},"result":{}}`
+	})
+	store := memSessions{}
+	c.cfg.SessionStore = store
+	c.cfg.InitStatements = []string{"SET time_zone = '+00:00'", "SET @@sql_mode = 'ANSI'"}
+	ctx := WithSessionKey(context.Background(), "carol")
+
+	if _, err := c.ExecContext(ctx, "UPDATE t SET a = 1", nil); err == nil {
+		t.Fatal("expected the init statement to fail the query")
+	}
+	if c.session != nil || store["carol"] != nil {
+		t.Fatal("expected the session without its settings to be dropped")
+	}
+	if _, err := c.ExecContext(ctx, "UPDATE t SET a = 1", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "SET time_zone = '+00:00'; SET time_zone = '+00:00'; SET @@sql_mode = 'ANSI'; UPDATE t SET a = 1"
+	if got := strings.Join(queries, "; "); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestSetStatementSessionIsKept(t *testing.T) {
+	var sent []string
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		v := parseJSON(t, string(body))
+		sent = append(sent, string(v.Get("session").MarshalTo(nil)))
+		if string(v.GetStringBytes("query")) == "SET time_zone = '+02:00'" {
+			return 200, `{"session":{"vitessSession":{"SystemVariables":{"time_zone":"'+02:00'"}}},"result":{}}`
+		}
+		return 200, `{"session":` + sent[len(sent)-1] + `,"result":{}}`
+	})
+	c.session = []byte(`{}`)
+
+	for _, q := range []string{"SET time_zone = '+02:00'", "UPDATE t SET a = NOW()"} {
+		if _, err := c.ExecContext(context.Background(), q, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := `{"vitessSession":{"SystemVariables":{"time_zone":"'+02:00'"}}}`; sent[1] != want {
+		t.Fatalf("expected the session from the SET to be sent with the next query, got %s", sent[1])
+	}
+}
+
+func TestConcurrentUseIsRejected(t *testing.T) {
+	started, unblock := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		once.Do(func() {
+			close(started)
+			<-unblock
+		})
+		return 200, `{"session":{},"result":{}}`
+	})
+	c.session = []byte(`{}`)
+
+	done := make(chan error)
+	go func() {
+		_, err := c.ExecContext(context.Background(), "UPDATE t SET a = 1", nil)
+		done <- err
+	}()
+
+	<-started
+	if _, err := c.QueryContext(context.Background(), "SELECT 1", nil); !errors.Is(err, ErrConcurrentUse) {
+		t.Fatalf("expected ErrConcurrentUse, got %v", err)
+	}
+	close(unblock)
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Ping(context.Background()); err != nil {
+		t.Fatalf("expected the connection to be usable again, got %v", err)
+	}
+}
+
+func TestCloseDropsSession(t *testing.T) {
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		return 200, `{"session":{},"result":{}}`
+	})
+	c.session, c.sessionID = []byte(`{}`), "uuid"
+
+	var conn driver.Conn = c
+	if err := conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if c.session != nil || c.sessionID != "" || c.IsValid() {
+		t.Fatal("expected the closed connection to drop its session and be invalid")
+	}
+	if err := c.Ping(context.Background()); !errors.Is(err, driver.ErrBadConn) {
+		t.Fatalf("expected driver.ErrBadConn after Close, got %v", err)
+	}
+}
+
+func TestExecuteBody(t *testing.T) {
+	c := newConn(Config{NoAutoRefresh: true})
+
+	body, err := c.executeBody(context.Background(), `SELECT "a\b"`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"query":"SELECT \"a\\b\"","session":null}`; string(body) != want {
+		t.Fatalf("expected %s, got %s", want, body)
+	}
+
+	c.session = []byte(`{"signature":"x"}`)
+	next, err := c.executeBody(context.Background(), "SELECT :v1", bindVars{"v1": {Type: "INT64", Value: []byte("1")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"query":"SELECT :v1","session":{"signature":"x"},"bindVariables":{"v1":{"type":"INT64","value":"MQ=="}}}`; string(next) != want {
+		t.Fatalf("expected %s, got %s", want, next)
+	}
+	if !strings.HasSuffix(string(body), `"session":null}`) {
+		t.Fatalf("expected the first body to be unaffected by the second, got %s", body)
+	}
+}
+
+func TestMaxResponseBytes(t *testing.T) {
+	c := largeResultConn(1000)
+	c.cfg.MaxResponseBytes = 4096
+	c.session = []byte(`{}`)
+
+	rows, err := c.QueryContext(context.Background(), "SELECT id, name FROM t", nil)
+	if err == nil {
+		defer rows.Close()
+		dest := make([]driver.Value, 2)
+		for err == nil {
+			err = rows.Next(dest)
+		}
+	}
+	if !errors.Is(err, ErrMaxResponseBytes) {
+		t.Fatalf("expected ErrMaxResponseBytes, got %v", err)
+	}
+
+	// A response within the limit, however close, is read in full.
+	small := stubConn(func(endpoint string, body []byte) (int, string) {
+		return 200, `{"session":{},"result":{}}`
+	})
+	small.cfg.MaxResponseBytes = len(`{"session":{},"result":{}}`)
+	small.session = []byte(`{}`)
+	if err := small.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,176 @@
+package planetscale
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/valyala/fastjson"
+)
+
+// Error is an error returned by PlanetScale for a query.
+type Error struct {
+	// Code is the MySQL error number, such as 1062 for a duplicate key, or 0
+	// if the error didn't include one.
+	Code int
+
+	// SQLState is the five character SQLSTATE of the error, if reported.
+	SQLState string
+
+	// VitessCode is the name of the Vitess RPC error code, such as
+	// "INVALID_ARGUMENT" or "ALREADY_EXISTS".
+	VitessCode string
+
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// ProtocolError is returned when a response from the API isn't shaped like
+// one, such as a result without fields or a row whose lengths don't add up
+// to its values. Err is the error that revealed it, if there was one.
+type ProtocolError struct {
+	Msg string
+	Err error
+}
+
+func (e *ProtocolError) Error() string {
+	if e.Err != nil {
+		return "planetscale: invalid response: " + e.Msg + ": " + e.Err.Error()
+	}
+	return "planetscale: invalid response: " + e.Msg
+}
+
+func (e *ProtocolError) Unwrap() error {
+	return e.Err
+}
+
+// protocolErrorf returns a *ProtocolError with the formatted message.
+func protocolErrorf(format string, args ...interface{}) error {
+	return &ProtocolError{Msg: fmt.Sprintf(format, args...)}
+}
+
+// readError reads an Execute response's error object. Vitess includes the
+// MySQL error number and SQLSTATE in the message, formatted as
+// "... (errno 1062) (sqlstate 23000) ...".
+func readError(v *fastjson.Value) *Error {
+	return newError(string(v.GetStringBytes("code")), string(v.GetStringBytes("message")))
+}
+
+// newError returns the Error for an error with the given Vitess code and
+// message.
+func newError(code, message string) *Error {
+	e := &Error{VitessCode: code, Message: message}
+
+	if e.Message == "" {
+		e.Message = "unknown error"
+	}
+
+	if s, ok := messageField(e.Message, "(errno "); ok {
+		e.Code, _ = strconv.Atoi(s)
+	}
+	if s, ok := messageField(e.Message, "(sqlstate "); ok && len(s) == 5 {
+		e.SQLState = s
+	}
+
+	return e
+}
+
+// messageField returns the text between prefix and the following ")" in msg.
+func messageField(msg, prefix string) (string, bool) {
+	i := strings.Index(msg, prefix)
+	if i < 0 {
+		return "", false
+	}
+
+	rest := msg[i+len(prefix):]
+	end := strings.IndexByte(rest, ')')
+	if end < 0 {
+		return "", false
+	}
+
+	return rest[:end], true
+}
+
+// redactErrorMessage masks the values in an error message from Vitess, which
+// can quote the statement that failed, its bind variables and the duplicate
+// value of a key, such as
+//
+//	Duplicate entry 'a@b.c' for key 'users.email' (errno 1062) (sqlstate 23000)
+//	(CallerID: u): Sql: "insert into users(email) values (:vtg1)", BindVars: {vtg1: "..."}
+//
+// The statement's literals are replaced with ?, and the bind variables and
+// duplicate value are dropped. The error number and SQLSTATE are kept.
+func redactErrorMessage(msg string) string {
+	if i := strings.Index(msg, "Duplicate entry '"); i >= 0 {
+		start := i + len("Duplicate entry '")
+		if end := strings.Index(msg[start:], "' for key"); end >= 0 {
+			msg = msg[:start] + "?" + msg[start+end:]
+		}
+	}
+
+	if i := strings.Index(msg, `Sql: "`); i >= 0 {
+		start := i + len(`Sql: "`)
+		end := start
+		for end < len(msg) && msg[end] != '"' {
+			if msg[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end > len(msg) {
+			end = len(msg)
+		}
+		msg = msg[:start] + redactStatement(msg[start:end]) + msg[end:]
+	}
+
+	if i := strings.Index(msg, "BindVars: {"); i >= 0 {
+		start := i + len("BindVars: {")
+		end, depth := start, 1
+		for ; end < len(msg) && depth > 0; end++ {
+			switch msg[end] {
+			case '{':
+				depth++
+			case '}':
+				depth--
+			}
+		}
+		if depth == 0 {
+			end--
+		}
+		msg = msg[:start] + "..." + msg[end:]
+	}
+
+	return msg
+}
+
+// redactError masks the values in the message of the *Error in err's chain,
+// if the connection redacts queries.
+func (c *PsConn) redactError(err error) error {
+	var e *Error
+	if c.cfg.RedactQueries && errors.As(err, &e) {
+		e.Message = redactErrorMessage(e.Message)
+	}
+	return err
+}
+
+// maxErrorBody is how much of an error response's body an httpError's
+// message includes.
+const maxErrorBody = 512
+
+// httpError is returned when the API responds with a status other than 200.
+type httpError struct {
+	status int
+	body   []byte
+}
+
+func (e *httpError) Error() string {
+	body := e.body
+	if len(body) > maxErrorBody {
+		return fmt.Sprintf("planetscale API error: %d\n%s... (%d more bytes)", e.status, body[:maxErrorBody], len(body)-maxErrorBody)
+	}
+	return fmt.Sprintf("planetscale API error: %d\n%s", e.status, body)
+}
@@ -0,0 +1,93 @@
+package planetscale
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+)
+
+func TestExecuteError(t *testing.T) {
+	const msg = "target: test.-.primary: vttablet: Duplicate entry '1' for key 'user.PRIMARY' (errno 1062) (sqlstate 23000) (CallerID: x)"
+
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		return 200, `{"session":{},"error":{"code":"ALREADY_EXISTS","message":"` + msg + `"}}`
+	})
+
+	_, err := c.ExecContext(context.Background(), "INSERT INTO user (id) VALUES (1)", nil)
+
+	var psErr *Error
+	if !errors.As(err, &psErr) {
+		t.Fatalf("expected *Error, got %T %v", err, err)
+	}
+	if psErr.Code != 1062 || psErr.SQLState != "23000" || psErr.VitessCode != "ALREADY_EXISTS" {
+		t.Fatalf("unexpected error fields %+v", psErr)
+	}
+	if psErr.Error() != msg {
+		t.Fatalf("expected message %q, got %q", msg, psErr.Error())
+	}
+}
+
+func TestExecuteErrorWithoutDetails(t *testing.T) {
+	e := readError(parseJSON(t, `{}`))
+	if e.Message != "unknown error" || e.Code != 0 || e.SQLState != "" {
+		t.Fatalf("unexpected error %+v", e)
+	}
+}
+
+func TestSessionConnectionErrorIsBadConn(t *testing.T) {
+	c := stubConn(nil)
+	c.send = func(ctx context.Context, req *fsthttp.Request, backend string) (*fsthttp.Response, error) {
+		return nil, errors.New("connection refused")
+	}
+
+	err := c.Ping(context.Background())
+	if !errors.Is(err, driver.ErrBadConn) {
+		t.Fatalf("expected ErrBadConn, got %v", err)
+	}
+}
+
+func TestRedactErrorMessage(t *testing.T) {
+	msg := `target: test.-.primary: vttablet: Duplicate entry 'a@b.c' for key 'users.email' (errno 1062) (sqlstate 23000) (CallerID: x): ` +
+		`Sql: "insert into users(email, age) values ('a@b.c', 42)", BindVars: {vtg1: "type:VARCHAR value:\"a@b.c\"", nested: {x: 1}}`
+	want := `target: test.-.primary: vttablet: Duplicate entry '?' for key 'users.email' (errno 1062) (sqlstate 23000) (CallerID: x): ` +
+		`Sql: "insert into users(email, age) values (?, ?)", BindVars: {...}`
+	if got := redactErrorMessage(msg); got != want {
+		t.Fatalf("expected\n%s\ngot\n%s", want, got)
+	}
+
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		return 200, `{"session":{},"error":{"code":"ALREADY_EXISTS","message":"Duplicate entry 'secret' for key 'PRIMARY' (errno 1062) (sqlstate 23000)"}}`
+	})
+	c.cfg.RedactQueries = true
+
+	_, err := c.ExecContext(context.Background(), "INSERT INTO t (k) VALUES ('secret')", nil)
+	var psErr *Error
+	if !errors.As(err, &psErr) || psErr.Code != 1062 {
+		t.Fatalf("expected *Error 1062, got %v", err)
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Fatalf("expected the duplicate value to be masked, got %q", err)
+	}
+}
+
+func TestHTTPErrorRedactsAuthorization(t *testing.T) {
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		return 400, "bad request: Authorization: Basic dXNlcjpwYXNz, token Bearer abc.DEF-123 " + strings.Repeat("x", 1000)
+	})
+
+	err := c.Ping(context.Background())
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	msg := err.Error()
+	if strings.Contains(msg, "dXNlcjpwYXNz") || strings.Contains(msg, "abc.DEF-123") {
+		t.Fatalf("expected credentials to be masked, got %q", msg)
+	}
+	if !strings.Contains(msg, "Basic ****, token Bearer ****") || !strings.HasSuffix(msg, "... (546 more bytes)") {
+		t.Fatalf("unexpected message %q", msg)
+	}
+}
@@ -0,0 +1,186 @@
+package planetscale
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Endpoint is a PlanetScale host and the backend requests to it are sent
+// through. An empty Backend uses the connection's BackendRegistrar, like
+// Config.Backend.
+type Endpoint struct {
+	Host    string
+	Backend string
+}
+
+// BreakerState is the state of an endpoint's circuit breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets requests through to the endpoint.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen sends requests to the next endpoint instead.
+	BreakerOpen
+	// BreakerHalfOpen lets a single request through to probe whether the
+	// endpoint has recovered.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// FailoverPolicy controls failing over from Config.Host to other endpoints.
+// Each endpoint has a circuit breaker that opens after Threshold consecutive
+// failed requests, meaning the request couldn't be sent, timed out or got a
+// 5xx response. Requests then go to the first endpoint, in order, whose
+// circuit is closed. After Cooldown, a single request probes an open
+// endpoint, closing its circuit again if it succeeds.
+//
+// Breakers are shared by all connections to an endpoint within a Compute
+// instance.
+type FailoverPolicy struct {
+	// Fallbacks are the endpoints failed over to, in order. Failover is
+	// disabled if there are none.
+	Fallbacks []Endpoint
+
+	// Threshold is how many consecutive failures open a circuit. It
+	// defaults to 3.
+	Threshold int
+
+	// Cooldown is how long a circuit stays open before the endpoint is
+	// probed. It defaults to 30 seconds.
+	Cooldown time.Duration
+
+	// OnStateChange, if set, is called when an endpoint's circuit changes
+	// state.
+	OnStateChange func(endpoint Endpoint, state BreakerState)
+}
+
+const (
+	defaultBreakerThreshold = 3
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+// ErrNoEndpoint is returned when the circuits of all of a connection's
+// endpoints are open.
+var ErrNoEndpoint = errors.New("planetscale: all endpoints are unavailable")
+
+type breaker struct {
+	state    BreakerState
+	failures int
+	openedAt time.Time
+}
+
+// breakers holds the circuit breakers of the endpoints that have been failed
+// over from.
+var breakers = struct {
+	sync.Mutex
+	endpoints map[Endpoint]*breaker
+}{endpoints: make(map[Endpoint]*breaker)}
+
+// currentEndpoint returns the endpoint the connection's requests are sent to.
+func (c *PsConn) currentEndpoint() Endpoint {
+	if c.endpoint.Host != "" {
+		return c.endpoint
+	}
+	return Endpoint{Host: c.cfg.Host, Backend: c.cfg.Backend}
+}
+
+// chooseEndpoint sets the endpoint the next request is sent to: the first
+// whose circuit lets it through.
+func (c *PsConn) chooseEndpoint() error {
+	primary := Endpoint{Host: c.cfg.Host, Backend: c.cfg.Backend}
+	p := c.cfg.Failover
+	if len(p.Fallbacks) == 0 {
+		c.endpoint = primary
+		return nil
+	}
+
+	cooldown := p.Cooldown
+	if cooldown <= 0 {
+		cooldown = defaultBreakerCooldown
+	}
+
+	breakers.Lock()
+	var chosen *Endpoint
+	probing := false
+	for _, ep := range append([]Endpoint{primary}, p.Fallbacks...) {
+		b := breakers.endpoints[ep]
+		if b == nil || b.state == BreakerClosed {
+			chosen = &ep
+			break
+		}
+		if b.state == BreakerOpen && time.Since(b.openedAt) >= cooldown {
+			b.state = BreakerHalfOpen
+			chosen, probing = &ep, true
+			break
+		}
+	}
+	breakers.Unlock()
+
+	if chosen == nil {
+		return ErrNoEndpoint
+	}
+	if probing && p.OnStateChange != nil {
+		p.OnStateChange(*chosen, BreakerHalfOpen)
+	}
+	c.endpoint = *chosen
+	return nil
+}
+
+// recordOutcome updates the circuit of the endpoint a request was sent to
+// with whether it failed. Requests that ended with their context or weren't
+// sent count as neither, but a probe that did is let through again.
+func (c *PsConn) recordOutcome(ep Endpoint, failed, ended bool) {
+	p := c.cfg.Failover
+	if len(p.Fallbacks) == 0 {
+		return
+	}
+
+	threshold := p.Threshold
+	if threshold <= 0 {
+		threshold = defaultBreakerThreshold
+	}
+
+	breakers.Lock()
+	b := breakers.endpoints[ep]
+	if b == nil {
+		if !failed {
+			breakers.Unlock()
+			return
+		}
+		b = &breaker{}
+		breakers.endpoints[ep] = b
+	}
+
+	prev := b.state
+	switch {
+	case ended:
+		if b.state == BreakerHalfOpen {
+			b.state = BreakerOpen
+		}
+	case !failed:
+		b.state, b.failures = BreakerClosed, 0
+	default:
+		b.failures++
+		if b.state == BreakerHalfOpen || b.failures >= threshold {
+			b.state, b.openedAt = BreakerOpen, time.Now()
+		}
+	}
+	state := b.state
+	breakers.Unlock()
+
+	if state != prev && p.OnStateChange != nil {
+		p.OnStateChange(ep, state)
+	}
+}
@@ -0,0 +1,152 @@
+package planetscale
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+)
+
+func TestFailover(t *testing.T) {
+	primaryUp := false
+	var hosts []string
+	var states []string
+
+	c := newConn(Config{Host: "primary.failover.test", Backend: "primary"})
+	c.cfg.Failover = FailoverPolicy{
+		Fallbacks: []Endpoint{{Host: "fallback.failover.test", Backend: "fallback"}},
+		Threshold: 2,
+		Cooldown:  10 * time.Millisecond,
+		OnStateChange: func(ep Endpoint, state BreakerState) {
+			states = append(states, ep.Backend+" "+state.String())
+		},
+	}
+	c.send = func(ctx context.Context, req *fsthttp.Request, backend string) (*fsthttp.Response, error) {
+		hosts = append(hosts, req.URL.Host)
+		status := 200
+		if backend == "primary" && !primaryUp {
+			status = 503
+		}
+		return &fsthttp.Response{
+			Request:    req,
+			StatusCode: status,
+			Header:     fsthttp.NewHeader(),
+			Body:       io.NopCloser(strings.NewReader("{}")),
+		}, nil
+	}
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		c.request(ctx, c.executorEndpoint, nil, false)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	primaryUp = true
+	for i := 0; i < 2; i++ {
+		if _, err := c.request(ctx, c.executorEndpoint, nil, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{
+		"primary.failover.test",
+		"primary.failover.test",
+		"fallback.failover.test",
+		"primary.failover.test", // the probe after the cooldown
+		"primary.failover.test",
+	}
+	if strings.Join(hosts, " ") != strings.Join(want, " ") {
+		t.Fatalf("expected requests to %q, got %q", want, hosts)
+	}
+
+	wantStates := []string{"primary open", "primary half-open", "primary closed"}
+	if strings.Join(states, ", ") != strings.Join(wantStates, ", ") {
+		t.Fatalf("expected state changes %q, got %q", wantStates, states)
+	}
+}
+
+func TestFailoverProbeNotSent(t *testing.T) {
+	primaryUp := false
+	var states []string
+
+	c := newConn(Config{Host: "primary.probe.test", Backend: "primary"})
+	c.cfg.Failover = FailoverPolicy{
+		Fallbacks: []Endpoint{{Host: "fallback.probe.test", Backend: "fallback"}},
+		Threshold: 1,
+		Cooldown:  time.Millisecond,
+		OnStateChange: func(ep Endpoint, state BreakerState) {
+			states = append(states, ep.Backend+" "+state.String())
+		},
+	}
+	c.send = func(ctx context.Context, req *fsthttp.Request, backend string) (*fsthttp.Response, error) {
+		status := 200
+		if backend == "primary" && !primaryUp {
+			status = 503
+		}
+		return &fsthttp.Response{
+			Request:    req,
+			StatusCode: status,
+			Header:     fsthttp.NewHeader(),
+			Body:       io.NopCloser(strings.NewReader("{}")),
+		}, nil
+	}
+
+	ctx := context.Background()
+	c.request(ctx, c.executorEndpoint, nil, false)
+	primaryUp = true
+
+	// A probe whose request couldn't be built is let through again.
+	time.Sleep(5 * time.Millisecond)
+	errToken := errors.New("no token")
+	c.cfg.TokenProvider = func(ctx context.Context) (string, error) { return "", errToken }
+	if _, err := c.request(ctx, c.executorEndpoint, nil, false); !errors.Is(err, errToken) {
+		t.Fatalf("expected the token error, got %v", err)
+	}
+	c.cfg.TokenProvider = nil
+
+	// A probe stopped by the concurrency limit doesn't close the circuit.
+	c.limiter = &limiter{slots: make(chan struct{}, 1), timeout: time.Millisecond}
+	c.limiter.slots <- struct{}{}
+	if _, err := c.request(ctx, c.executorEndpoint, nil, false); !errors.Is(err, ErrConcurrencyLimit) {
+		t.Fatalf("expected ErrConcurrencyLimit, got %v", err)
+	}
+	c.limiter = nil
+
+	if _, err := c.request(ctx, c.executorEndpoint, nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"primary open",
+		"primary half-open", "primary open", // the probe without a request
+		"primary half-open", "primary open", // the probe over the limit
+		"primary half-open", "primary closed",
+	}
+	if strings.Join(states, ", ") != strings.Join(want, ", ") {
+		t.Fatalf("expected state changes %q, got %q", want, states)
+	}
+}
+
+func TestFailoverAllOpen(t *testing.T) {
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		return 502, "bad gateway"
+	})
+	c.cfg.Host = "down.failover.test"
+	c.cfg.Failover = FailoverPolicy{
+		Fallbacks: []Endpoint{{Host: "also-down.failover.test", Backend: "planetscale"}},
+		Threshold: 1,
+	}
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		c.request(ctx, c.executorEndpoint, nil, false)
+	}
+
+	if _, err := c.request(ctx, c.executorEndpoint, nil, false); !errors.Is(err, ErrNoEndpoint) {
+		t.Fatalf("expected ErrNoEndpoint, got %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package planetscale
+
+import (
+	"context"
+	"time"
+)
+
+// QueryHook is called around each query a connection runs, for logging,
+// slow query detection or metrics. BeforeQuery may return a context derived
+// from ctx, which the query is run with and AfterQuery is called with.
+//
+// AfterQuery is called with how long the query took and the error it failed
+// with, if any. For a query that returns rows, that is the time until the
+// first row can be read; reading the rest is up to the caller.
+type QueryHook interface {
+	BeforeQuery(ctx context.Context, query string) context.Context
+	AfterQuery(ctx context.Context, query string, d time.Duration, err error)
+}
+
+// withHooks runs fn, which runs query, between the connection's hooks, and
+// reports the query to its MetricsCollector. Hooks are called in order
+// before the query and in reverse order after it. With RedactQueries set,
+// hooks see the query with its literals masked.
+func (c *PsConn) withHooks(ctx context.Context, query string, fn func(ctx context.Context) error) error {
+	hooks := c.cfg.Hooks
+	if len(hooks) > 0 && c.cfg.RedactQueries {
+		query = redactStatement(query)
+	}
+
+	ctxs := make([]context.Context, len(hooks))
+	for i, h := range hooks {
+		ctx = h.BeforeQuery(ctx, query)
+		ctxs[i] = ctx
+	}
+
+	start := time.Now()
+	err := c.redactError(fn(ctx))
+	d := time.Since(start)
+
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i].AfterQuery(ctxs[i], query, d, err)
+	}
+	c.metrics().ObserveQuery(d, c.errorClass(err))
+	return err
+}
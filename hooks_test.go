@@ -0,0 +1,78 @@
+package planetscale
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+type hookKey struct{}
+
+type recordingHook struct {
+	name  string
+	calls *[]string
+}
+
+func (h recordingHook) BeforeQuery(ctx context.Context, query string) context.Context {
+	*h.calls = append(*h.calls, h.name+" before "+query)
+	return context.WithValue(ctx, hookKey{}, h.name)
+}
+
+func (h recordingHook) AfterQuery(ctx context.Context, query string, d time.Duration, err error) {
+	msg := "ok"
+	if err != nil {
+		msg = err.Error()
+	}
+	*h.calls = append(*h.calls, h.name+" after "+query+" in "+ctx.Value(hookKey{}).(string)+": "+msg)
+}
+
+func TestQueryHooks(t *testing.T) {
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		if strings.Contains(string(body), "BROKEN") {
+			return 200, `{"session":{},"error":{"code":"INVALID_ARGUMENT","message":"syntax error"}}`
+		}
+		return 200, `{"session":{},"result":{"fields":[],"rows":[]}}`
+	})
+
+	var calls []string
+	c.cfg.Hooks = []QueryHook{recordingHook{"a", &calls}, recordingHook{"b", &calls}}
+
+	if _, err := c.QueryContext(context.Background(), "SELECT 1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ExecContext(context.Background(), "BROKEN", nil); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	want := []string{
+		"a before SELECT 1",
+		"b before SELECT 1",
+		"b after SELECT 1 in b: ok",
+		"a after SELECT 1 in a: ok",
+		"a before BROKEN",
+		"b before BROKEN",
+		"b after BROKEN in b: syntax error",
+		"a after BROKEN in a: syntax error",
+	}
+	if strings.Join(calls, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("expected calls:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(calls, "\n"))
+	}
+}
+
+func TestQueryHooksRedactQueries(t *testing.T) {
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		return 200, `{"session":{},"result":{"fields":[],"rows":[]}}`
+	})
+
+	var calls []string
+	c.cfg.Hooks = []QueryHook{recordingHook{"a", &calls}}
+	c.cfg.RedactQueries = true
+
+	if _, err := c.QueryContext(context.Background(), "SELECT * FROM t WHERE email = 'a@b.c' AND id = 7", nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := "a before SELECT * FROM t WHERE email = ? AND id = ?"; calls[0] != want {
+		t.Fatalf("expected %q, got %q", want, calls[0])
+	}
+}
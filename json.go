@@ -0,0 +1,62 @@
+package planetscale
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// JSON columns are returned by Next as their JSON text in a []byte, like
+// BLOB columns, so they scan into a json.RawMessage, a string or a []byte. ColumnTypeScanType reports json.RawMessage for them, or NullJSON if
+// the column is nullable, so scanning helpers that allocate destinations
+// from the scan type decode JSON without a custom type.
+//
+// json.RawMessage arguments are sent as text rather than binary, since MySQL
+// rejects binary strings as JSON values.
+
+// NullJSON is a JSON value that may be NULL. It implements sql.Scanner and
+// driver.Valuer.
+type NullJSON struct {
+	JSON  json.RawMessage
+	Valid bool
+}
+
+// Scan implements sql.Scanner.
+func (n *NullJSON) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		n.JSON, n.Valid = nil, false
+	case []byte:
+		n.JSON, n.Valid = append(json.RawMessage(nil), v...), true
+	case string:
+		n.JSON, n.Valid = json.RawMessage(v), true
+	default:
+		return fmt.Errorf("cannot scan %T into NullJSON", value)
+	}
+	return nil
+}
+
+// Value implements driver.Valuer.
+func (n NullJSON) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return string(n.JSON), nil
+}
+
+// validJSON reports an error if a JSON column's value isn't valid JSON.
+func validJSON(b []byte) error {
+	if !json.Valid(b) {
+		return fmt.Errorf("invalid JSON value %q", truncateForError(b))
+	}
+	return nil
+}
+
+// truncateForError shortens b for inclusion in an error message.
+func truncateForError(b []byte) []byte {
+	const max = 64
+	if len(b) > max {
+		return append(b[:max:max], "..."...)
+	}
+	return b
+}
@@ -0,0 +1,79 @@
+package planetscale
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScanJSONColumns(t *testing.T) {
+	var argType string
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		argType = string(parseJSON(t, string(body)).GetStringBytes("bindVariables", "v1", "type"))
+		return 200, `{"session":{},"result":{
+			"fields":[{"name":"doc","type":"JSON","flags":1},{"name":"extra","type":"JSON"}],
+			"rows":[{"lengths":["7","-1"],"values":"eyJhIjoxfQ=="}]}}`
+	})
+	db := sql.OpenDB(stubConnector{c})
+	defer db.Close()
+
+	rows, err := db.Query("SELECT doc, extra FROM t WHERE doc = ?", json.RawMessage(`{"a":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	if argType != "VARCHAR" {
+		t.Fatalf("expected json.RawMessage to be sent as VARCHAR, got %s", argType)
+	}
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := types[0].ScanType(); st != reflect.TypeOf(json.RawMessage{}) {
+		t.Fatalf("expected json.RawMessage scan type, got %v", st)
+	}
+	if st := types[1].ScanType(); st != reflect.TypeOf(NullJSON{}) {
+		t.Fatalf("expected NullJSON scan type for a nullable column, got %v", st)
+	}
+
+	if !rows.Next() {
+		t.Fatal(rows.Err())
+	}
+	var doc json.RawMessage
+	var extra NullJSON
+	if err := rows.Scan(&doc, &extra); err != nil {
+		t.Fatal(err)
+	}
+	if string(doc) != `{"a":1}` || extra.Valid {
+		t.Fatalf("unexpected values %s and %+v", doc, extra)
+	}
+}
+
+func TestValidateJSON(t *testing.T) {
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		return 200, `{"session":{},"result":{"fields":[{"name":"doc","type":"JSON"}],"rows":[` + rowJSON(`{"a":`) + `]}}`
+	})
+	c.cfg.ValidateJSON = true
+	db := sql.OpenDB(stubConnector{c})
+	defer db.Close()
+
+	var doc json.RawMessage
+	err := db.QueryRowContext(context.Background(), "SELECT doc FROM t").Scan(&doc)
+	if err == nil || !strings.Contains(err.Error(), "invalid JSON") {
+		t.Fatalf("expected an invalid JSON error, got %v", err)
+	}
+}
+
+func TestNullJSONValue(t *testing.T) {
+	if v, err := (NullJSON{}).Value(); v != nil || err != nil {
+		t.Fatalf("expected NULL, got %v, %v", v, err)
+	}
+	if v, err := (NullJSON{JSON: json.RawMessage(`[1]`), Valid: true}).Value(); v != "[1]" || err != nil {
+		t.Fatalf("expected the JSON text, got %v, %v", v, err)
+	}
+}
@@ -0,0 +1,64 @@
+package planetscale
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrConcurrencyLimit is returned when a request waited
+// Config.QueueTimeout for one of the Config.MaxConcurrentRequests in flight
+// to finish without any doing so.
+var ErrConcurrencyLimit = errors.New("planetscale: too many concurrent requests")
+
+// limiter limits the requests in flight from the connections of a connector,
+// or a Client and its batches. Requests over the limit wait for one to
+// finish, in no particular order.
+type limiter struct {
+	slots   chan struct{}
+	timeout time.Duration
+}
+
+// newLimiter returns the limiter cfg configures, or nil if it sets no limit.
+func newLimiter(cfg Config) *limiter {
+	if cfg.MaxConcurrentRequests <= 0 {
+		return nil
+	}
+	return &limiter{slots: make(chan struct{}, cfg.MaxConcurrentRequests), timeout: cfg.QueueTimeout}
+}
+
+// acquire waits for a request to be allowed, until ctx ends or the queue
+// timeout passes, and returns the function that releases it. A nil limiter
+// allows every request.
+func (l *limiter) acquire(ctx context.Context) (release func(), err error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return l.release, nil
+	default:
+	}
+
+	var timeout <-chan time.Time
+	if l.timeout > 0 {
+		t := time.NewTimer(l.timeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return l.release, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timeout:
+		return nil, fmt.Errorf("%w: waited %s for one of %d requests", ErrConcurrencyLimit, l.timeout, cap(l.slots))
+	}
+}
+
+func (l *limiter) release() {
+	<-l.slots
+}
@@ -0,0 +1,95 @@
+package planetscale
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+)
+
+func TestConcurrencyLimit(t *testing.T) {
+	handler := func(endpoint string, body []byte) (int, string) {
+		return 200, `{"session":{},"result":{"fields":[{"name":"n","type":"INT64"}],"rows":[` + rowJSON("1") + `]}}`
+	}
+	l := newLimiter(Config{MaxConcurrentRequests: 1, QueueTimeout: 10 * time.Millisecond})
+	a, b := stubConn(handler), stubConn(handler)
+	a.limiter, b.limiter = l, l
+
+	// A request waiting for its response holds the only slot.
+	a.session = []byte(`{}`)
+	waiting, respond := make(chan struct{}), make(chan struct{})
+	stub := a.send
+	a.send = func(ctx context.Context, req *fsthttp.Request, backend string) (*fsthttp.Response, error) {
+		close(waiting)
+		<-respond
+		return stub(ctx, req, backend)
+	}
+	done := make(chan error)
+	go func() {
+		rows, err := a.QueryContext(context.Background(), "SELECT n FROM t", nil)
+		if err == nil {
+			defer rows.Close()
+		}
+		done <- err
+	}()
+	<-waiting
+
+	if _, err := b.ExecContext(context.Background(), "SELECT 1", nil); !errors.Is(err, ErrConcurrencyLimit) {
+		t.Fatalf("expected ErrConcurrencyLimit, got %v", err)
+	}
+	if b.bad {
+		t.Fatal("expected a rejected request to leave the connection usable")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	l.timeout = 0
+	if _, err := b.ExecContext(ctx, "SELECT 1", nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	close(respond)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if len(l.slots) != 0 {
+		t.Fatalf("expected no requests in flight, got %d", len(l.slots))
+	}
+}
+
+func TestConcurrencyLimitNestedQueries(t *testing.T) {
+	handler := func(endpoint string, body []byte) (int, string) {
+		return 200, `{"session":{},"result":{"fields":[{"name":"n","type":"INT64"}],"rows":[` + rowJSON("1") + `]}}`
+	}
+	l := newLimiter(Config{MaxConcurrentRequests: 1})
+	a, b := stubConn(handler), stubConn(handler)
+	a.limiter, b.limiter = l, l
+
+	// Queries run while another's rows are open don't wait for them to be
+	// closed, which without a queue timeout would be forever.
+	rows, err := a.QueryContext(context.Background(), "SELECT n FROM t", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	inner, err := b.QueryContext(context.Background(), "SELECT n FROM t", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner.Close()
+}
+
+func TestConnectorSharesLimiter(t *testing.T) {
+	c := NewConnector(WithConcurrencyLimit(4, time.Second))
+	a, _ := c.Connect(context.Background())
+	b, _ := c.Connect(context.Background())
+	if l := a.(*PsConn).limiter; l == nil || l != b.(*PsConn).limiter || cap(l.slots) != 4 {
+		t.Fatalf("expected connections to share a limiter of 4, got %v and %v", l, b.(*PsConn).limiter)
+	}
+
+	if NewConnector().limiter != nil {
+		t.Fatal("expected no limiter by default")
+	}
+}
@@ -0,0 +1,102 @@
+package planetscale
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// MetricsCollector receives measurements of a connection's queries and API
+// requests, for counters and histograms in the service's telemetry. Methods
+// are called synchronously, from the goroutine using the connection.
+//
+// Embed NopMetrics to implement only some of the methods.
+type MetricsCollector interface {
+	// ObserveQuery is called after each query with how long it took, up to
+	// when its first row can be read, and the class of the error it failed
+	// with, or "" if it succeeded. Classes are:
+	//
+	//   - "query": PlanetScale returned an error for the query
+	//   - "session": the session expired or was rejected
+	//   - "http": the API responded with a status other than 200
+	//   - "transport": the request couldn't be sent or the response read
+	//   - "timeout" and "canceled": the query's context ended
+	//   - "client": the query couldn't be sent, such as for bad arguments
+	ObserveQuery(d time.Duration, errClass string)
+
+	// ObserveRequest is called for each API request once its response has
+	// been read, with the path of the endpoint, the bytes of request body
+	// sent and response body received, and how many times the request was
+	// retried.
+	ObserveRequest(endpoint string, sent, received int64, retries int)
+
+	// ObserveRows is called with the number of rows decoded from a result,
+	// once it is closed.
+	ObserveRows(n int)
+}
+
+// NopMetrics is a MetricsCollector that discards all measurements. It is
+// used when no collector is configured.
+type NopMetrics struct{}
+
+func (NopMetrics) ObserveQuery(time.Duration, string)       {}
+func (NopMetrics) ObserveRequest(string, int64, int64, int) {}
+func (NopMetrics) ObserveRows(int)                          {}
+
+// metrics returns the connection's MetricsCollector.
+func (c *PsConn) metrics() MetricsCollector {
+	if c.cfg.Metrics == nil {
+		return NopMetrics{}
+	}
+	return c.cfg.Metrics
+}
+
+// errorClass returns the class of err reported to ObserveQuery.
+func (c *PsConn) errorClass(err error) string {
+	var psErr *Error
+	var httpErr *httpError
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, errTxSessionExpired):
+		return "session"
+	case errors.As(err, &psErr):
+		if isSessionExpired(psErr.Message) {
+			return "session"
+		}
+		return "query"
+	case errors.As(err, &httpErr):
+		return "http"
+	case c.bad:
+		return "transport"
+	default:
+		return "client"
+	}
+}
+
+// countingBody is a response body that reports the request's measurements
+// when it is closed.
+type countingBody struct {
+	io.ReadCloser
+	received int64
+	done     func(received int64)
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.received += int64(n)
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	if b.done != nil {
+		b.done(b.received)
+		b.done = nil
+	}
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,79 @@
+package planetscale
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type recordingMetrics struct {
+	NopMetrics
+	queries  []string
+	requests int
+	received int64
+	retries  int
+	rows     []int
+}
+
+func (m *recordingMetrics) ObserveQuery(d time.Duration, errClass string) {
+	m.queries = append(m.queries, errClass)
+}
+
+func (m *recordingMetrics) ObserveRequest(endpoint string, sent, received int64, retries int) {
+	m.requests++
+	m.received += received
+	m.retries += retries
+}
+
+func (m *recordingMetrics) ObserveRows(n int) {
+	m.rows = append(m.rows, n)
+}
+
+func TestMetrics(t *testing.T) {
+	m := &recordingMetrics{}
+	c := threeRowsConn(Config{})
+	c.cfg.Metrics = m
+
+	rows, err := c.QueryContext(context.Background(), "SELECT n FROM t", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readValues(t, rows); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.queries) != 1 || m.queries[0] != "" {
+		t.Fatalf("expected a successful query, got %q", m.queries)
+	}
+	if m.requests != 2 || m.received == 0 || m.retries != 0 {
+		t.Fatalf("expected 2 requests without retries, got %d receiving %d bytes with %d retries", m.requests, m.received, m.retries)
+	}
+	if len(m.rows) != 1 || m.rows[0] != 3 {
+		t.Fatalf("expected 3 rows decoded, got %v", m.rows)
+	}
+}
+
+func TestMetricsErrorClass(t *testing.T) {
+	attempts := 0
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		attempts++
+		if attempts == 1 {
+			return 503, "unavailable"
+		}
+		return 200, `{"session":{},"error":{"code":"INVALID_ARGUMENT","message":"syntax error"}}`
+	})
+	m := &recordingMetrics{}
+	c.cfg.Metrics, c.cfg.Retry.MaxAttempts = m, 2
+
+	c.ExecContext(context.Background(), "BROKEN", nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.ExecContext(ctx, "SELECT 1", nil)
+
+	if len(m.queries) != 2 || m.queries[0] != "query" || m.queries[1] != "canceled" {
+		t.Fatalf("expected query and canceled errors, got %q", m.queries)
+	}
+	if m.retries != 1 {
+		t.Fatalf("expected the session to be created after a retry, got %d retries", m.retries)
+	}
+}
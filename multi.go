@@ -0,0 +1,143 @@
+package planetscale
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+)
+
+// The Execute API runs one statement per call, so with MultiStatements set a
+// query made of several statements is split and its statements are executed
+// in order on the connection's session. Each one is a separate result set of
+// the query's rows, and Exec combines their results.
+
+// multiResults is the rows of a multi-statement query. Each statement is
+// executed when its result set is reached, and the statements that are left
+// when the rows are closed are still executed so none are skipped.
+type multiResults struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	conn   *PsConn
+	binds  bindVars
+	cur    *PsResults
+	stmts  []string
+}
+
+var _ rowSource = (*multiResults)(nil)
+
+// statements splits query into statements if the connection allows more than
+// one per query.
+func (c *PsConn) statements(query string) []string {
+	if !c.cfg.MultiStatements {
+		return nil
+	}
+	return splitStatements(query)
+}
+
+// queryMulti runs a query made of several statements. Its rows are reported
+// to metrics and QueryStats once for the whole query, while the span of each
+// statement gets the rows of its own result set. If any statement is a
+// write, the query timeout of ctx is a deadline for all of them.
+func (c *PsConn) queryMulti(ctx context.Context, stmts []string, binds bindVars) (*PsResults, error) {
+	cancel := context.CancelFunc(func() {})
+	if d := queryTimeout(ctx); d > 0 && hasWrite(stmts) {
+		ctx, cancel = context.WithTimeout(ctx, d)
+	}
+
+	first, err := c.readResults(ctx, stmts[0], binds)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	m := &multiResults{ctx: ctx, cancel: cancel, conn: c, binds: binds, stmts: stmts[1:]}
+	m.setCurrent(first)
+	return &PsResults{
+		Fields:        first.Fields,
+		rows:          m,
+		maxRows:       first.maxRows,
+		truncate:      first.truncate,
+		validateJSON:  first.validateJSON,
+		decodeDecimal: first.decodeDecimal,
+		warnings:      first.warnings,
+		loc:           first.loc,
+		metrics:       c.metrics(),
+		stats:         queryStatsFrom(ctx),
+	}, nil
+}
+
+// setCurrent makes r the statement whose rows are read. The query's results
+// report the rows to metrics and QueryStats, so r doesn't.
+func (m *multiResults) setCurrent(r *PsResults) {
+	r.metrics, r.stats = nil, nil
+	m.cur = r
+}
+
+// execMulti runs a statement made of several statements, adding up the rows
+// they affected. The insert id is the last one generated.
+func (c *PsConn) execMulti(ctx context.Context, stmts []string, binds bindVars) (driver.Result, error) {
+	var total PsResult
+	for _, stmt := range stmts {
+		res, err := c.execOne(ctx, stmt, binds)
+		if err != nil {
+			return nil, err
+		}
+
+		total.rowsAffected += res.rowsAffected
+		if res.hasInsertID {
+			total.insertID, total.hasInsertID = res.insertID, true
+		}
+		total.info = res.info
+		total.warnings = append(total.warnings, res.warnings...)
+	}
+	return total, nil
+}
+
+func (m *multiResults) nextRow(row *encodedRow) (bool, error) {
+	ok, err := m.cur.rows.nextRow(row)
+	if ok {
+		m.cur.rowsRead++
+	}
+	return ok, err
+}
+
+func (m *multiResults) hasNextResultSet() bool {
+	return m.cur.rows.hasNextResultSet() || len(m.stmts) > 0
+}
+
+func (m *multiResults) nextResultSet() ([]PsField, []string, error) {
+	if m.cur.rows.hasNextResultSet() {
+		return m.cur.rows.nextResultSet()
+	}
+	if len(m.stmts) == 0 {
+		return nil, nil, io.EOF
+	}
+
+	if err := m.cur.Close(); err != nil {
+		return nil, nil, err
+	}
+
+	next, err := m.conn.readResults(m.ctx, m.stmts[0], m.binds)
+	if err != nil {
+		return nil, nil, err
+	}
+	m.setCurrent(next)
+	m.stmts = m.stmts[1:]
+
+	return next.Fields, next.warnings, nil
+}
+
+// close closes the current result set and runs the statements whose result
+// sets weren't reached.
+func (m *multiResults) close() error {
+	err := m.cur.Close()
+	for _, stmt := range m.stmts {
+		if err != nil {
+			break
+		}
+		_, err = m.conn.execOne(m.ctx, stmt, m.binds)
+	}
+	m.stmts = nil
+	m.cancel()
+	return err
+}
@@ -0,0 +1,174 @@
+package planetscale
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+)
+
+// multiConn returns a connection with MultiStatements set that records the
+// query of every Execute request. SELECTs return their own text as a single
+// row, and other statements affect one row and generate an insert id.
+func multiConn(t *testing.T, queries *[]string) *PsConn {
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		if strings.HasSuffix(endpoint, sessionPath) {
+			return 200, `{"session":{}}`
+		}
+		query := string(parseJSON(t, string(body)).GetStringBytes("query"))
+		*queries = append(*queries, query)
+		if strings.HasPrefix(query, "SELECT") {
+			return 200, `{"session":{},"result":{"fields":[{"name":"q","type":"VARCHAR"}],"rows":[` + rowJSON(query) + `]}}`
+		}
+		return 200, `{"session":{},"result":{"rowsAffected":"1","insertId":"` + strings.Repeat("7", len(*queries)) + `"}}`
+	})
+	c.cfg.MultiStatements = true
+	return c
+}
+
+func TestExecMultiStatements(t *testing.T) {
+	var queries []string
+	c := multiConn(t, &queries)
+
+	res, err := c.ExecContext(context.Background(), "INSERT INTO t VALUES (1); INSERT INTO t VALUES (2);", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 2 {
+		t.Fatalf("expected 2 rows affected, got %d", n)
+	}
+	if id, _ := res.LastInsertId(); id != 77 {
+		t.Fatalf("expected the last insert id 77, got %d", id)
+	}
+	if len(queries) != 2 {
+		t.Fatalf("expected 2 statements, got %q", queries)
+	}
+}
+
+func TestQueryMultiStatements(t *testing.T) {
+	var queries []string
+	db := sql.OpenDB(stubConnector{multiConn(t, &queries)})
+	defer db.Close()
+
+	rows, err := db.Query("SELECT 1; SELECT 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for {
+		for rows.Next() {
+			var s string
+			if err := rows.Scan(&s); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, s)
+		}
+		if !rows.NextResultSet() {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, ", ") != "SELECT 1, SELECT 2" {
+		t.Fatalf("unexpected result sets %q", got)
+	}
+}
+
+func TestMultiStatementsRunOnClose(t *testing.T) {
+	var queries []string
+	c := multiConn(t, &queries)
+
+	rows, err := c.QueryContext(context.Background(), "SELECT 1; UPDATE t SET a = 1; UPDATE t SET b = 1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "SELECT 1; UPDATE t SET a = 1; UPDATE t SET b = 1"
+	if got := strings.Join(queries, "; "); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestMultiStatementsDisabled(t *testing.T) {
+	var queries []string
+	c := multiConn(t, &queries)
+	c.cfg.MultiStatements = false
+
+	if _, err := c.ExecContext(context.Background(), "UPDATE t SET a = 1; UPDATE t SET b = 1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 1 {
+		t.Fatalf("expected the query to be sent as is, got %q", queries)
+	}
+}
+
+func TestQueryMultiStatementsRows(t *testing.T) {
+	var queries []string
+	c := multiConn(t, &queries)
+	m := &recordingMetrics{}
+	c.cfg.Metrics = m
+	db := sql.OpenDB(stubConnector{c})
+	defer db.Close()
+	ctx, stats := WithQueryStats(context.Background())
+
+	rows, err := db.QueryContext(ctx, "SELECT 1; SELECT 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	for {
+		for rows.Next() {
+			n++
+		}
+		if !rows.NextResultSet() {
+			break
+		}
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 2 {
+		t.Fatalf("expected 2 rows, got %d", n)
+	}
+	if len(m.rows) != 1 || m.rows[0] != 2 {
+		t.Fatalf("expected the query's 2 rows to be observed once, got %v", m.rows)
+	}
+	if stats.RowsReturned != 2 {
+		t.Fatalf("expected 2 rows returned, got %d", stats.RowsReturned)
+	}
+}
+
+func TestMultiStatementsWriteDeadline(t *testing.T) {
+	var queries []string
+	c := multiConn(t, &queries)
+	c.session = []byte(`{}`)
+	stub := c.send
+	c.send = func(ctx context.Context, req *fsthttp.Request, backend string) (*fsthttp.Response, error) {
+		if _, ok := ctx.Deadline(); ok {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return stub(ctx, req, backend)
+	}
+	ctx := WithQueryTimeout(context.Background(), 20*time.Millisecond)
+
+	if _, err := c.ExecContext(ctx, "SELECT 1; UPDATE t SET a = 1", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the exec to miss its deadline, got %v", err)
+	}
+	if _, err := c.QueryContext(ctx, "SELECT 1; UPDATE t SET a = 1", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the query to miss its deadline, got %v", err)
+	}
+	if _, err := c.QueryContext(ctx, "SELECT 1; SELECT 2", nil); err != nil {
+		t.Fatalf("expected SELECTs to run without a deadline, got %v", err)
+	}
+}
@@ -0,0 +1,376 @@
+// Package planetscaletest provides a fake PlanetScale API for testing code
+// that uses the planetscale driver, without credentials or network access.
+//
+// A Server is programmed with the result of each query it should expect,
+// and records the requests it receives so tests can assert on them:
+//
+//	s := planetscaletest.NewServer(t)
+//	s.On("SELECT name FROM user WHERE id = :v1").Return(planetscaletest.Result{
+//		Columns: []planetscaletest.Column{{Name: "name", Type: "VARCHAR"}},
+//		Rows:    [][]interface{}{{"alice"}},
+//	})
+//
+//	db := sql.OpenDB(s.Connector())
+//	defer db.Close()
+//
+// Queries are matched after their whitespace is collapsed. Query text is as
+// the driver sends it, with ? placeholders numbered as :v1, :v2 and so on.
+// A query the server wasn't programmed with fails the test.
+package planetscaletest
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+	"github.com/leedo/planetscale"
+)
+
+const (
+	// Host and Backend are the host and backend Connector configures.
+	Host    = "planetscaletest.invalid"
+	Backend = "planetscaletest"
+
+	// Username and Password are the credentials Connector configures.
+	Username = "planetscaletest"
+	Password = "planetscaletest"
+)
+
+// Column is a column of a programmed result.
+type Column struct {
+	Name string
+	// Type is the Vitess type of the column, such as "INT64" or "VARCHAR".
+	Type string
+}
+
+// Result is the result a query is answered with. Values in Rows are
+// formatted as MySQL would send them: nil is NULL, []byte and strings are
+// sent as is, time.Time is formatted as a DATETIME, and anything else is
+// formatted with fmt.
+type Result struct {
+	Columns      []Column
+	Rows         [][]interface{}
+	RowsAffected uint64
+	InsertID     uint64
+}
+
+// BindVariable is a bind variable sent with a query.
+type BindVariable struct {
+	Type  string
+	Value []byte
+}
+
+// Request is a query the server received.
+type Request struct {
+	Query         string
+	BindVariables map[string]BindVariable
+
+	// SessionID is the id of the session sent with the query, or "" if it
+	// was sent without one.
+	SessionID string
+}
+
+// Expectation answers a query, set up with Server.On.
+type Expectation struct {
+	result  *Result
+	code    string
+	message string
+}
+
+// Return answers the query with r.
+func (e *Expectation) Return(r Result) {
+	e.result = &r
+}
+
+// ReturnError answers the query with an error, such as
+// ReturnError("ALREADY_EXISTS", "Duplicate entry (errno 1062) (sqlstate 23000)").
+func (e *Expectation) ReturnError(code, message string) {
+	e.code, e.message = code, message
+}
+
+// Server is a fake PlanetScale API. It is a planetscale.Transport, so
+// connections send their requests to it directly. It is safe for concurrent
+// use.
+type Server struct {
+	tb testing.TB
+
+	mu           sync.Mutex
+	expectations map[string]*Expectation
+	requests     []Request
+	sessions     int
+}
+
+var _ planetscale.Transport = (*Server)(nil)
+
+// NewServer returns a Server that reports unexpected queries as errors of
+// tb.
+func NewServer(tb testing.TB) *Server {
+	return &Server{tb: tb, expectations: make(map[string]*Expectation)}
+}
+
+// On programs the server to expect query, which is answered with an empty
+// result unless the returned Expectation says otherwise.
+func (s *Server) On(query string) *Expectation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := &Expectation{result: &Result{}}
+	s.expectations[normalize(query)] = e
+	return e
+}
+
+// Requests returns the queries the server has received, in order.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Sessions returns how many sessions have been created.
+func (s *Server) Sessions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions
+}
+
+// Connector returns a connector whose connections send their requests to the
+// server, configured further by opts.
+func (s *Server) Connector(opts ...planetscale.Option) *planetscale.PsConnector {
+	return planetscale.NewConnector(append([]planetscale.Option{
+		planetscale.WithHost(Host),
+		planetscale.WithBackend(Backend),
+		planetscale.WithCredentials(Username, Password),
+		planetscale.WithTransport(s),
+	}, opts...)...)
+}
+
+// Send answers a request from the driver.
+func (s *Server) Send(ctx context.Context, req *fsthttp.Request, backend string) (*fsthttp.Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	status, contentType, resp := s.handle(req, body)
+	h := fsthttp.NewHeader()
+	h.Set("Content-Type", contentType)
+	return &fsthttp.Response{
+		Request:    req,
+		Backend:    backend,
+		StatusCode: status,
+		Header:     h,
+		Body:       io.NopCloser(bytes.NewReader(resp)),
+	}, nil
+}
+
+func (s *Server) handle(req *fsthttp.Request, body []byte) (int, string, []byte) {
+	if user, pass, ok := basicAuth(req.Header.Get("Authorization")); !ok || user != Username || pass != Password {
+		return fsthttp.StatusUnauthorized, "text/plain", []byte("invalid credentials")
+	}
+
+	contentType := req.Header.Get("Content-Type")
+	stream := strings.HasSuffix(req.URL.Path, "/StreamExecute")
+	switch {
+	case contentType == "application/json",
+		stream && contentType == "application/connect+json":
+	default:
+		return fsthttp.StatusUnsupportedMediaType, "text/plain", []byte("unsupported content type " + contentType)
+	}
+
+	if stream {
+		if len(body) < 5 {
+			return fsthttp.StatusBadRequest, "text/plain", []byte("missing envelope")
+		}
+		body = body[5:]
+	}
+
+	switch {
+	case strings.HasSuffix(req.URL.Path, "/CreateSession"):
+		return fsthttp.StatusOK, contentType, s.createSession()
+	case strings.HasSuffix(req.URL.Path, "/Execute"), stream:
+		resp, err := s.execute(body)
+		if err != nil {
+			return fsthttp.StatusBadRequest, "text/plain", []byte(err.Error())
+		}
+		if stream {
+			resp = append(envelope(0, resp), envelope(2, []byte("{}"))...)
+		}
+		return fsthttp.StatusOK, contentType, resp
+	default:
+		return fsthttp.StatusNotFound, "text/plain", []byte("not found")
+	}
+}
+
+func (s *Server) createSession() []byte {
+	s.mu.Lock()
+	s.sessions++
+	id := "planetscaletest-" + strconv.Itoa(s.sessions)
+	s.mu.Unlock()
+
+	resp, _ := json.Marshal(map[string]interface{}{"session": session(id)})
+	return resp
+}
+
+func session(id string) map[string]interface{} {
+	return map[string]interface{}{
+		"signature":     base64.StdEncoding.EncodeToString([]byte(id)),
+		"vitessSession": map[string]interface{}{"SessionUUID": id},
+	}
+}
+
+type executeRequest struct {
+	Query   string `json:"query"`
+	Session *struct {
+		VitessSession struct {
+			SessionUUID string
+		} `json:"vitessSession"`
+	} `json:"session"`
+	BindVariables map[string]struct {
+		Type  string `json:"type"`
+		Value []byte `json:"value"`
+	} `json:"bindVariables"`
+}
+
+func (s *Server) execute(body []byte) ([]byte, error) {
+	var req executeRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+
+	r := Request{Query: req.Query, BindVariables: make(map[string]BindVariable)}
+	if req.Session != nil {
+		r.SessionID = req.Session.VitessSession.SessionUUID
+	}
+	for name, bv := range req.BindVariables {
+		r.BindVariables[name] = BindVariable{Type: bv.Type, Value: bv.Value}
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, r)
+	e, ok := s.expectations[normalize(req.Query)]
+	s.mu.Unlock()
+
+	resp := map[string]interface{}{"session": session(r.SessionID)}
+	switch {
+	case !ok && isSessionStatement(req.Query):
+		resp["result"] = map[string]interface{}{}
+	case !ok:
+		s.tb.Errorf("planetscaletest: unexpected query %q", req.Query)
+		resp["error"] = map[string]string{"code": "INVALID_ARGUMENT", "message": "planetscaletest: unexpected query"}
+	case e.code != "" || e.message != "":
+		resp["error"] = map[string]string{"code": e.code, "message": e.message}
+	default:
+		resp["result"] = e.result.encode()
+	}
+	return json.Marshal(resp)
+}
+
+// isSessionStatement reports whether query is one the driver issues itself
+// to set up its session, which is expected without being programmed.
+func isSessionStatement(query string) bool {
+	switch query {
+	case "BEGIN", "START TRANSACTION READ ONLY", "COMMIT", "ROLLBACK", "SELECT 1":
+		return true
+	}
+	for _, prefix := range []string{"USE ", "SET ", "SAVEPOINT ", "ROLLBACK TO SAVEPOINT "} {
+		if strings.HasPrefix(query, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Result) encode() map[string]interface{} {
+	result := map[string]interface{}{
+		"rowsAffected": strconv.FormatUint(r.RowsAffected, 10),
+	}
+	if r.InsertID != 0 {
+		result["insertId"] = strconv.FormatUint(r.InsertID, 10)
+	}
+	if r.Columns == nil {
+		return result
+	}
+
+	fields := make([]map[string]string, len(r.Columns))
+	for i, c := range r.Columns {
+		fields[i] = map[string]string{"name": c.Name, "type": c.Type}
+	}
+
+	rows := make([]map[string]interface{}, len(r.Rows))
+	for i, row := range r.Rows {
+		var values []byte
+		lengths := make([]string, len(row))
+		for j, v := range row {
+			if v == nil {
+				lengths[j] = "-1"
+				continue
+			}
+			b := format(v)
+			lengths[j] = strconv.Itoa(len(b))
+			values = append(values, b...)
+		}
+		rows[i] = map[string]interface{}{"lengths": lengths, "values": values}
+	}
+
+	result["fields"] = fields
+	result["rows"] = rows
+	return result
+}
+
+func format(v interface{}) []byte {
+	switch v := v.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	case time.Time:
+		return []byte(v.Format("2006-01-02 15:04:05.999999"))
+	case bool:
+		if v {
+			return []byte("1")
+		}
+		return []byte("0")
+	default:
+		return []byte(fmt.Sprint(v))
+	}
+}
+
+func normalize(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
+
+func envelope(flags byte, msg []byte) []byte {
+	b := make([]byte, 5, 5+len(msg))
+	b[0] = flags
+	binary.BigEndian.PutUint32(b[1:], uint32(len(msg)))
+	return append(b, msg...)
+}
+
+func basicAuth(header string) (string, string, bool) {
+	if !strings.HasPrefix(header, "Basic ") {
+		return "", "", false
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(header, "Basic "))
+	if err != nil {
+		return "", "", false
+	}
+	user, pass, ok := strings.Cut(string(b), ":")
+	return user, pass, ok
+}
@@ -0,0 +1,107 @@
+package planetscaletest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/leedo/planetscale"
+)
+
+func TestServerAnswersQueries(t *testing.T) {
+	s := NewServer(t)
+	s.On("SELECT id, name FROM user WHERE id = :v1").Return(Result{
+		Columns: []Column{{Name: "id", Type: "INT64"}, {Name: "name", Type: "VARCHAR"}},
+		Rows:    [][]interface{}{{7, "alice"}, {8, nil}},
+	})
+
+	db := sql.OpenDB(s.Connector())
+	defer db.Close()
+
+	rows, err := db.Query("SELECT id, name FROM user WHERE id = ?", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var got []string
+	for rows.Next() {
+		var id int64
+		var name sql.NullString
+		if err := rows.Scan(&id, &name); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, name.String)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != "alice" || got[1] != "" {
+		t.Fatalf("unexpected rows %q", got)
+	}
+
+	var bound *Request
+	for _, r := range s.Requests() {
+		if r.Query == "SELECT id, name FROM user WHERE id = :v1" {
+			r := r
+			bound = &r
+		}
+	}
+	if bound == nil {
+		t.Fatal("query wasn't recorded")
+	}
+	if bv := bound.BindVariables["v1"]; bv.Type != "INT64" || string(bv.Value) != "7" {
+		t.Fatalf("unexpected bind variable %+v", bv)
+	}
+	if bound.SessionID == "" || s.Sessions() != 1 {
+		t.Fatalf("expected the query to be sent with the one session, got %q of %d", bound.SessionID, s.Sessions())
+	}
+}
+
+func TestServerExecAndErrors(t *testing.T) {
+	s := NewServer(t)
+	s.On("INSERT INTO user (name) VALUES (:v1)").Return(Result{RowsAffected: 1, InsertID: 42})
+	s.On("INSERT INTO user (id) VALUES (1)").ReturnError("ALREADY_EXISTS", "Duplicate entry '1' for key 'PRIMARY' (errno 1062) (sqlstate 23000)")
+
+	db := sql.OpenDB(s.Connector())
+	defer db.Close()
+
+	res, err := db.ExecContext(context.Background(), "INSERT INTO user (name) VALUES (?)", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := res.LastInsertId(); id != 42 {
+		t.Fatalf("expected insert id 42, got %d", id)
+	}
+
+	_, err = db.Exec("INSERT INTO user (id) VALUES (1)")
+	var psErr *planetscale.Error
+	if !errors.As(err, &psErr) || psErr.Code != 1062 {
+		t.Fatalf("expected a duplicate entry error, got %v", err)
+	}
+}
+
+func TestServerRejectsUnexpectedQueries(t *testing.T) {
+	ft := &fakeTB{TB: t}
+	s := NewServer(ft)
+
+	db := sql.OpenDB(s.Connector())
+	defer db.Close()
+
+	if _, err := db.Exec("DELETE FROM user"); err == nil {
+		t.Fatal("expected an error for an unexpected query")
+	}
+	if !ft.failed {
+		t.Fatal("expected the unexpected query to fail the test")
+	}
+}
+
+type fakeTB struct {
+	testing.TB
+	failed bool
+}
+
+func (f *fakeTB) Errorf(format string, args ...interface{}) {
+	f.failed = true
+}
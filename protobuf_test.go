@@ -0,0 +1,174 @@
+package planetscale
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+// protoSession encodes a psdb Session with the given id and a warning.
+func protoSession(id string) []byte {
+	warning := appendProtoVarint(nil, 1, 1265)
+	warning = appendProtoBytes(warning, 2, []byte("Data truncated"))
+
+	vs := appendProtoBytes(nil, 8, warning)
+	vs = appendProtoBytes(vs, 22, []byte(id))
+	return appendProtoBytes(appendProtoBytes(nil, 1, []byte("sig")), 2, vs)
+}
+
+// protoResult encodes an ExecuteResponse with a VARCHAR column n and a row
+// for each value, where nil is NULL.
+func protoResult(session []byte, values ...[]byte) []byte {
+	field := appendProtoBytes(nil, 1, []byte("n"))
+	field = appendProtoVarint(field, 2, 6165)
+
+	result := appendProtoBytes(nil, 1, field)
+	for _, v := range values {
+		length := uint64(len(v)) << 1
+		if v == nil {
+			length = 1 // zigzag -1
+		}
+		row := appendProtoBytes(nil, 1, binary.AppendUvarint(nil, length))
+		row = appendProtoBytes(row, 2, v)
+		result = appendProtoBytes(result, 4, row)
+	}
+
+	return appendProtoBytes(appendProtoBytes(nil, 1, session), 2, result)
+}
+
+func protoConn(t *testing.T, queries *[]string, resp []byte) *PsConn {
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		if endpoint == defaultAPIPrefix+sessionPath {
+			return 200, string(appendProtoBytes(nil, createSessionSessionField, protoSession("new")))
+		}
+
+		r := protoReader{body}
+		for r.more() {
+			field, wire, err := r.next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if field != 2 {
+				r.skip(wire)
+				continue
+			}
+			q, _ := r.bytes()
+			*queries = append(*queries, string(q))
+		}
+		return 200, string(resp)
+	})
+	c.cfg.Protobuf = true
+	return c
+}
+
+func TestProtobufQuery(t *testing.T) {
+	var queries []string
+	c := protoConn(t, &queries, protoResult(protoSession("next"), []byte("abc"), nil, []byte("")))
+
+	rows, err := c.QueryContext(context.Background(), "SELECT n FROM t WHERE id = ?", []driver.NamedValue{{Ordinal: 1, Value: int64(1)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := rows.(*PsResults)
+	if len(results.Fields) != 1 || results.Fields[0].Name != "n" || results.Fields[0].Type != "VARCHAR" {
+		t.Fatalf("unexpected fields %+v", results.Fields)
+	}
+	if w := results.Warnings(); len(w) != 1 || w[0] != "Warning 1265: Data truncated" {
+		t.Fatalf("unexpected warnings %q", w)
+	}
+
+	dest := make([]driver.Value, 1)
+	var got []driver.Value
+	for rows.Next(dest) == nil {
+		got = append(got, dest[0])
+	}
+	if len(got) != 3 || got[0] != "abc" || got[1] != nil || got[2] != "" {
+		t.Fatalf("unexpected values %q", got)
+	}
+
+	if c.sessionID != "next" {
+		t.Fatalf("expected session next, got %q", c.sessionID)
+	}
+	if len(queries) != 1 || queries[0] != "SELECT n FROM t WHERE id = :v1" {
+		t.Fatalf("unexpected queries %q", queries)
+	}
+}
+
+func TestProtobufRowsDecodedInNext(t *testing.T) {
+	field := appendProtoVarint(appendProtoBytes(nil, 1, []byte("n")), 2, 6165)
+	good := appendProtoBytes(appendProtoBytes(nil, 1, binary.AppendUvarint(nil, 6)), 2, []byte("abc"))
+	result := appendProtoBytes(nil, 1, field)
+	result = appendProtoBytes(result, 4, good)
+	result = appendProtoBytes(result, 4, []byte{0x0a, 0x05}) // lengths cut short
+
+	var queries []string
+	c := protoConn(t, &queries, appendProtoBytes(appendProtoBytes(nil, 1, protoSession("next")), 2, result))
+
+	rows, err := c.QueryContext(context.Background(), "SELECT n FROM t", nil)
+	if err != nil {
+		t.Fatalf("expected the malformed row to be left for Next, got %v", err)
+	}
+	defer rows.Close()
+
+	dest := make([]driver.Value, 1)
+	if err := rows.Next(dest); err != nil || dest[0] != "abc" {
+		t.Fatalf("unexpected first row %q, %v", dest[0], err)
+	}
+	if err := rows.Next(dest); err == nil || err == io.EOF {
+		t.Fatalf("expected an error decoding the second row, got %v", err)
+	}
+}
+
+func TestProtobufExecAndError(t *testing.T) {
+	var queries []string
+	result := appendProtoVarint(appendProtoVarint(nil, 2, 3), 3, 42)
+	result = appendProtoBytes(result, 6, []byte("Rows matched: 3  Changed: 3  Warnings: 1"))
+	c := protoConn(t, &queries, appendProtoBytes(appendProtoBytes(nil, 1, protoSession("next")), 2, result))
+
+	res, err := c.ExecContext(context.Background(), "UPDATE t SET n = 1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 3 {
+		t.Fatalf("expected 3 rows affected, got %d", n)
+	}
+	if id, _ := res.LastInsertId(); id != 42 {
+		t.Fatalf("expected insert id 42, got %d", id)
+	}
+	if r := res.(PsResult); r.Info() != "Rows matched: 3  Changed: 3  Warnings: 1" || len(r.Warnings()) != 1 {
+		t.Fatalf("unexpected info %q and warnings %q", r.Info(), r.Warnings())
+	}
+
+	rpcErr := appendProtoBytes(nil, 2, []byte("Duplicate entry (errno 1062) (sqlstate 23000)"))
+	rpcErr = appendProtoVarint(rpcErr, 3, 6)
+	c = protoConn(t, &queries, appendProtoBytes(appendProtoBytes(nil, 1, protoSession("next")), 3, rpcErr))
+
+	_, err = c.ExecContext(context.Background(), "INSERT INTO t VALUES (1)", nil)
+	var psErr *Error
+	if !errors.As(err, &psErr) || psErr.Code != 1062 || psErr.VitessCode != "ALREADY_EXISTS" {
+		t.Fatalf("expected a duplicate key error, got %v", err)
+	}
+}
+
+func TestProtobufFallsBackToJSON(t *testing.T) {
+	var jsonRequests int
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		if len(body) == 0 || body[0] != '{' {
+			return 415, "unsupported media type"
+		}
+		jsonRequests++
+		return 200, `{"session":{},"result":{"fields":[],"rows":[]}}`
+	})
+	c.cfg.Protobuf = true
+
+	if _, err := c.QueryContext(context.Background(), "SELECT 1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if c.useProtobuf() || jsonRequests != 2 {
+		t.Fatalf("expected to fall back to JSON, got %d JSON requests", jsonRequests)
+	}
+}
@@ -0,0 +1,140 @@
+package planetscale
+
+import (
+	"context"
+	"math"
+	"net"
+
+	"github.com/fastly/compute-sdk-go/geo"
+)
+
+// Region is a PlanetScale region with read replicas of the database, such as
+// a read-only region, reached through its own host.
+type Region struct {
+	Name    string
+	Host    string
+	Backend string
+
+	// Username and Password, if set, replace the connection's credentials
+	// in this region, for regions with their own passwords.
+	Username string
+	Password string
+
+	// Latitude and Longitude locate the region for NearestRegion.
+	Latitude  float64
+	Longitude float64
+}
+
+// RegionSelector chooses the region a query routed to a replica is sent to.
+// If it returns false, the query is sent to the connection's host.
+type RegionSelector func(ctx context.Context, regions []Region) (Region, bool)
+
+type clientIPKey struct{}
+
+// hostRegionKey carries the location of the connection's host to
+// NearestRegion.
+type hostRegionKey struct{}
+
+// WithClientIP returns a context carrying the IP address of the client the
+// queries run with it are made for, such as the downstream request's
+// RemoteAddr, which NearestRegion locates.
+func WithClientIP(ctx context.Context, ip net.IP) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// geoLookup locates an IP address. Tests replace it, since geolocation is
+// only available within Compute.
+var geoLookup = geo.Lookup
+
+// NearestRegion is the default RegionSelector. It chooses the region closest
+// to the client whose IP address ctx carries, located with Fastly's
+// geolocation data. It returns false if ctx has no client IP or it can't be
+// located, or if the connection's host is nearer than any of regions, as
+// located by Config.HostLatitude and Config.HostLongitude.
+func NearestRegion(ctx context.Context, regions []Region) (Region, bool) {
+	ip, _ := ctx.Value(clientIPKey{}).(net.IP)
+	if ip == nil || len(regions) == 0 {
+		return Region{}, false
+	}
+
+	g, err := geoLookup(ip)
+	if err != nil {
+		return Region{}, false
+	}
+
+	nearest, best := 0, math.Inf(1)
+	for i, r := range regions {
+		if d := distance(g.Latitude, g.Longitude, r.Latitude, r.Longitude); d < best {
+			nearest, best = i, d
+		}
+	}
+	if host, ok := ctx.Value(hostRegionKey{}).(Region); ok {
+		if distance(g.Latitude, g.Longitude, host.Latitude, host.Longitude) <= best {
+			return Region{}, false
+		}
+	}
+	return regions[nearest], true
+}
+
+// distance returns the great circle distance between two points in radians.
+func distance(lat1, lon1, lat2, lon2 float64) float64 {
+	const rad = math.Pi / 180
+	lat1, lon1, lat2, lon2 = lat1*rad, lon1*rad, lat2*rad, lon2*rad
+
+	a := math.Pow(math.Sin((lat2-lat1)/2), 2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin((lon2-lon1)/2), 2)
+	return 2 * math.Asin(math.Sqrt(a))
+}
+
+// regionConn returns the connection to the region a query with ctx is sent
+// to, or nil if it is sent to the connection's own host. Only reads routed to
+// a replica outside of a transaction go to another region. Each region has
+// its own session, kept on a connection created the first time the region
+// is used.
+func (c *PsConn) regionConn(ctx context.Context) *PsConn {
+	if len(c.cfg.Regions) == 0 || c.inTx {
+		return nil
+	}
+
+	r := routingFrom(ctx)
+	if r.tabletType == "" {
+		r.tabletType = c.cfg.Target
+	}
+	if r.tablet() == targetPrimary {
+		return nil
+	}
+
+	selectRegion := c.cfg.SelectRegion
+	if selectRegion == nil {
+		selectRegion = NearestRegion
+	}
+	if c.cfg.HostLatitude != 0 || c.cfg.HostLongitude != 0 {
+		host := Region{Host: c.cfg.Host, Backend: c.cfg.Backend, Latitude: c.cfg.HostLatitude, Longitude: c.cfg.HostLongitude}
+		ctx = context.WithValue(ctx, hostRegionKey{}, host)
+	}
+	region, ok := selectRegion(ctx, c.cfg.Regions)
+	if !ok {
+		return nil
+	}
+
+	if rc, ok := c.regions[region.Name]; ok {
+		return rc
+	}
+
+	cfg := c.cfg
+	cfg.Regions, cfg.SelectRegion = nil, nil
+	cfg.Failover, cfg.SessionStore = FailoverPolicy{}, nil
+	cfg.Host, cfg.Backend = region.Host, region.Backend
+	if region.Username != "" || region.Password != "" {
+		cfg.Username, cfg.Password, cfg.CredentialProvider = region.Username, region.Password, nil
+		cfg.BearerToken, cfg.TokenProvider = "", nil
+	}
+
+	rc := newConn(cfg)
+	rc.send, rc.limiter = c.send, c.limiter
+	if c.regions == nil {
+		c.regions = make(map[string]*PsConn)
+	}
+	c.regions[region.Name] = rc
+	return rc
+}
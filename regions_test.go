@@ -0,0 +1,98 @@
+package planetscale
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+	"github.com/fastly/compute-sdk-go/geo"
+)
+
+var testRegions = []Region{
+	{Name: "us-east", Host: "aws.connect.psdb.cloud", Backend: "us", Latitude: 38.9, Longitude: -77.0},
+	{Name: "eu-west", Host: "aws-eu-west-1.connect.psdb.cloud", Backend: "eu", Latitude: 53.3, Longitude: -6.3},
+}
+
+func TestNearestRegion(t *testing.T) {
+	defer func(lookup func(net.IP) (*geo.Geo, error)) { geoLookup = lookup }(geoLookup)
+	geoLookup = func(ip net.IP) (*geo.Geo, error) {
+		// Paris
+		return &geo.Geo{Latitude: 48.9, Longitude: 2.4}, nil
+	}
+
+	if _, ok := NearestRegion(context.Background(), testRegions); ok {
+		t.Fatal("expected no region without a client IP")
+	}
+
+	ctx := WithClientIP(context.Background(), net.ParseIP("192.0.2.1"))
+	r, ok := NearestRegion(ctx, testRegions)
+	if !ok || r.Name != "eu-west" {
+		t.Fatalf("expected eu-west, got %q", r.Name)
+	}
+}
+
+func TestNearestRegionHost(t *testing.T) {
+	defer func(lookup func(net.IP) (*geo.Geo, error)) { geoLookup = lookup }(geoLookup)
+	geoLookup = func(ip net.IP) (*geo.Geo, error) {
+		// Paris
+		return &geo.Geo{Latitude: 48.9, Longitude: 2.4}, nil
+	}
+
+	ctx := WithReplica(WithClientIP(context.Background(), net.ParseIP("192.0.2.1")))
+	c := newConn(Config{Host: "aws-eu-central-1.connect.psdb.cloud", Regions: testRegions})
+
+	// Frankfurt is nearer to Paris than either region.
+	c.cfg.HostLatitude, c.cfg.HostLongitude = 50.1, 8.7
+	if rc := c.regionConn(ctx); rc != nil {
+		t.Fatalf("expected the query to stay on the nearer host, got %s", rc.cfg.Host)
+	}
+
+	// Oregon isn't.
+	c.cfg.HostLatitude, c.cfg.HostLongitude = 45.8, -119.7
+	if rc := c.regionConn(ctx); rc == nil || rc.cfg.Host != "aws-eu-west-1.connect.psdb.cloud" {
+		t.Fatalf("expected the query to go to eu-west, got %v", rc)
+	}
+}
+
+func TestReplicaReadsGoToSelectedRegion(t *testing.T) {
+	var backends []string
+	c := newConn(Config{Host: "example.com", Backend: "planetscale"})
+	c.cfg.Regions = testRegions
+	c.cfg.SelectRegion = func(ctx context.Context, regions []Region) (Region, bool) {
+		return regions[1], true
+	}
+	c.send = func(ctx context.Context, req *fsthttp.Request, backend string) (*fsthttp.Response, error) {
+		backends = append(backends, backend+" "+req.URL.Host+req.URL.Path)
+		return &fsthttp.Response{
+			Request:    req,
+			StatusCode: 200,
+			Header:     fsthttp.NewHeader(),
+			Body:       io.NopCloser(strings.NewReader(`{"session":{},"result":{"fields":[],"rows":[]}}`)),
+		}, nil
+	}
+
+	ctx := context.Background()
+	if _, err := c.QueryContext(ctx, "SELECT 1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.QueryContext(WithReplica(ctx), "SELECT 1", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"planetscale example.com" + defaultAPIPrefix + sessionPath,
+		"planetscale example.com" + defaultAPIPrefix + executorPath,
+		"eu aws-eu-west-1.connect.psdb.cloud" + defaultAPIPrefix + sessionPath,
+		"eu aws-eu-west-1.connect.psdb.cloud" + defaultAPIPrefix + executorPath, // USE @replica
+		"eu aws-eu-west-1.connect.psdb.cloud" + defaultAPIPrefix + executorPath,
+	}
+	if strings.Join(backends, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("expected requests to %q, got %q", want, backends)
+	}
+	if c.routing.tablet() != targetPrimary {
+		t.Fatalf("expected the connection's own session to stay on the primary, got %q", c.routing.tablet())
+	}
+}
@@ -0,0 +1,96 @@
+package planetscale
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+)
+
+// RequestOptions are the Fastly options of the requests sent to the API.
+//
+// Connect and between-bytes timeouts belong to the backend rather than its
+// requests, so they are set on the service's backend, or by the
+// BackendRegistrar of a dynamic one.
+type RequestOptions struct {
+	// CacheOptions is the cache override of the requests. The API's
+	// responses are never worth caching, so requests pass the cache unless
+	// it is set, such as to make their handling PCI-compliant or tag them
+	// with a surrogate key.
+	CacheOptions fsthttp.CacheOptions
+
+	// FirstByteTimeout limits how long a request waits for the API to start
+	// responding. A request that times out fails and leaves its connection
+	// bad, since the query may still run. Zero waits as long as the
+	// request's context allows.
+	FirstByteTimeout time.Duration
+
+	// SendPollInterval is how often Compute checks whether a response has
+	// arrived, as described by fsthttp.Request. Zero uses the SDK's default.
+	SendPollInterval time.Duration
+}
+
+// ErrFirstByteTimeout is returned when the API didn't start responding to a
+// request within its RequestOptions.FirstByteTimeout.
+var ErrFirstByteTimeout = errors.New("planetscale: no response within the first-byte timeout")
+
+type requestOptionsKey struct{}
+
+// WithRequestOptions returns a context whose queries send their requests
+// with opts, in place of the connection's Config.RequestOptions where opts
+// sets a field.
+func WithRequestOptions(ctx context.Context, opts RequestOptions) context.Context {
+	return context.WithValue(ctx, requestOptionsKey{}, opts)
+}
+
+// requestOptions returns the options of the requests sent with ctx.
+func (c *PsConn) requestOptions(ctx context.Context) RequestOptions {
+	opts := c.cfg.RequestOptions
+	if o, ok := ctx.Value(requestOptionsKey{}).(RequestOptions); ok {
+		if o.CacheOptions != (fsthttp.CacheOptions{}) {
+			opts.CacheOptions = o.CacheOptions
+		}
+		if o.FirstByteTimeout != 0 {
+			opts.FirstByteTimeout = o.FirstByteTimeout
+		}
+		if o.SendPollInterval != 0 {
+			opts.SendPollInterval = o.SendPollInterval
+		}
+	}
+	if opts.CacheOptions == (fsthttp.CacheOptions{}) {
+		opts.CacheOptions.Pass = true
+	}
+	return opts
+}
+
+// firstByteTimeout returns the context a request is sent with to enforce
+// timeout, a function that stops the timeout once the response has arrived
+// and reports whether it had passed, and one that releases the context once
+// the response has been read. The context outlives the timeout's check since
+// bodies read with the request's context, as HTTPTransport's are, would fail
+// otherwise.
+func firstByteTimeout(ctx context.Context, timeout time.Duration) (context.Context, func() bool, func()) {
+	if timeout <= 0 {
+		return ctx, func() bool { return false }, func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	t := time.AfterFunc(timeout, cancel)
+	return ctx, func() bool { return !t.Stop() }, cancel
+}
+
+// releaseBody is a response body that calls release once it is closed, to
+// release the context its request was sent with.
+type releaseBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
@@ -0,0 +1,81 @@
+package planetscale
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+)
+
+func TestRequestOptions(t *testing.T) {
+	c := newConn(Config{Host: "example.com", Backend: "planetscale"})
+
+	req, err := c.buildRequest(context.Background(), c.executorEndpoint, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (fsthttp.CacheOptions{Pass: true}); req.CacheOptions != want {
+		t.Fatalf("expected requests to pass the cache by default, got %+v", req.CacheOptions)
+	}
+
+	c.cfg.RequestOptions = RequestOptions{
+		CacheOptions:     fsthttp.CacheOptions{PCI: true},
+		SendPollInterval: 5 * time.Millisecond,
+	}
+	ctx := WithRequestOptions(context.Background(), RequestOptions{
+		CacheOptions: fsthttp.CacheOptions{SurrogateKey: "planetscale"},
+	})
+	if req, err = c.buildRequest(ctx, c.executorEndpoint, nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := (fsthttp.CacheOptions{SurrogateKey: "planetscale"}); req.CacheOptions != want {
+		t.Fatalf("expected the context's cache options, got %+v", req.CacheOptions)
+	}
+	if req.SendPollInterval != 5*time.Millisecond {
+		t.Fatalf("expected the config's poll interval to be kept, got %s", req.SendPollInterval)
+	}
+}
+
+func TestFirstByteTimeout(t *testing.T) {
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		return 200, `{"session":{},"result":{"fields":[{"name":"n","type":"INT64"}],"rows":[` + rowJSON("1") + `]}}`
+	})
+	stub := c.send
+	var delay time.Duration
+	var sendCtx context.Context
+	c.send = func(ctx context.Context, req *fsthttp.Request, backend string) (*fsthttp.Response, error) {
+		sendCtx = ctx
+		select {
+		case <-time.After(delay):
+			return stub(ctx, req, backend)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	c.session = []byte(`{}`)
+	c.cfg.RequestOptions.FirstByteTimeout = 20 * time.Millisecond
+
+	delay = time.Second
+	if _, err := c.ExecContext(context.Background(), "SELECT 1", nil); !errors.Is(err, ErrFirstByteTimeout) {
+		t.Fatalf("expected ErrFirstByteTimeout, got %v", err)
+	}
+	if !c.bad {
+		t.Fatal("expected a timed out request to leave the connection bad")
+	}
+
+	delay = 0
+	ctx := WithRequestOptions(context.Background(), RequestOptions{FirstByteTimeout: time.Minute})
+	rows, err := c.QueryContext(ctx, "SELECT n FROM t", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sendCtx.Err() != nil {
+		t.Fatal("expected the request's context to last while its rows are open")
+	}
+	rows.Close()
+	if sendCtx.Err() == nil {
+		t.Fatal("expected the request's context to be released once its rows were closed")
+	}
+}
@@ -0,0 +1,155 @@
+package planetscale
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+
+	"github.com/valyala/fastjson"
+)
+
+// ErrNoInsertID is returned by PsResult.LastInsertId when the statement did
+// not generate an auto-increment id, as opposed to generating an id of 0.
+var ErrNoInsertID = fmt.Errorf("statement did not generate an insert id")
+
+// PsResult is the result of a statement run with ExecContext.
+type PsResult struct {
+	rowsAffected int64
+	insertID     int64
+	hasInsertID  bool
+	info         string
+	warnings     []string
+}
+
+var _ driver.Result = PsResult{}
+
+func (r PsResult) LastInsertId() (int64, error) {
+	if !r.hasInsertID {
+		return 0, ErrNoInsertID
+	}
+	return r.insertID, nil
+}
+
+func (r PsResult) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
+
+// Info returns the information MySQL reported about the statement, such as
+// "Rows matched: 3  Changed: 1  Warnings: 0" for an UPDATE or
+// "Records: 2  Duplicates: 1  Warnings: 0" for a multi-row INSERT, or "" if
+// there was none.
+func (r PsResult) Info() string {
+	return r.info
+}
+
+// Warnings returns the warnings MySQL raised while executing the statement,
+// such as for data truncated by an INSERT.
+func (r PsResult) Warnings() []string {
+	return r.warnings
+}
+
+// readUint reads an unsigned integer field of v. Vitess encodes 64-bit
+// integers as JSON strings, but plain numbers are accepted too. The second
+// return value is false if the field is absent.
+func readUint(v *fastjson.Value, key string) (uint64, bool, error) {
+	f := v.Get(key)
+	if f == nil {
+		return 0, false, nil
+	}
+
+	switch f.Type() {
+	case fastjson.TypeString:
+		n, err := strconv.ParseUint(string(f.GetStringBytes()), 10, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid %s: %w", key, err)
+		}
+		return n, true, nil
+	case fastjson.TypeNumber:
+		n, err := f.Uint64()
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid %s: %w", key, err)
+		}
+		return n, true, nil
+	default:
+		return 0, false, fmt.Errorf("invalid %s: unexpected %s", key, f.Type())
+	}
+}
+
+func (c *PsConn) readResult(v *fastjson.Value) (PsResult, error) {
+	var r PsResult
+
+	result := v.Get("result")
+	if result == nil {
+		return r, protocolErrorf("no result")
+	}
+
+	affected, _, err := readUint(result, "rowsAffected")
+	if err != nil {
+		return r, err
+	}
+	r.rowsAffected = int64(affected)
+
+	id, ok, err := readUint(result, "insertId")
+	if err != nil {
+		return r, err
+	}
+	r.insertID, r.hasInsertID = int64(id), ok
+	r.info = string(result.GetStringBytes("info"))
+
+	if r.warnings, err = c.sessionWarnings(); err != nil {
+		return r, err
+	}
+	return r, nil
+}
+
+func (c *PsConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	release, err := c.use()
+	defer release()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := withWriteDeadline(ctx, query)
+	defer cancel()
+
+	var res driver.Result
+	err = c.withHooks(ctx, query, func(ctx context.Context) error {
+		q, binds, err := c.bindArgs(query, args)
+		if err != nil {
+			return err
+		}
+		res, err = c.exec(ctx, q, binds)
+		return err
+	})
+	return res, err
+}
+
+func (c *PsConn) exec(ctx context.Context, query string, binds bindVars) (driver.Result, error) {
+	if err := c.route(ctx); err != nil {
+		return nil, err
+	}
+
+	if stmts := c.statements(query); len(stmts) > 1 {
+		return c.execMulti(ctx, stmts, binds)
+	}
+	return c.execOne(ctx, query, binds)
+}
+
+// execOne runs a single statement and reads its result.
+func (c *PsConn) execOne(ctx context.Context, query string, binds bindVars) (PsResult, error) {
+	p := parserPool.Get()
+	defer parserPool.Put(p)
+
+	v, err := c.execute(ctx, p, query, binds)
+	if err != nil {
+		return PsResult{}, err
+	}
+
+	res, err := c.readResult(v)
+	if err != nil {
+		return res, err
+	}
+	queryStatsFrom(ctx).addWarnings(len(res.warnings))
+	return res, nil
+}
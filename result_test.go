@@ -0,0 +1,84 @@
+package planetscale
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func execStub(t *testing.T, resp string) PsResult {
+	t.Helper()
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		return 200, resp
+	})
+
+	r, err := c.ExecContext(context.Background(), "UPDATE t SET x = 1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r.(PsResult)
+}
+
+func TestExecUpdateResult(t *testing.T) {
+	r := execStub(t, `{"session":{},"result":{"rowsAffected":"3"}}`)
+
+	if n, err := r.RowsAffected(); err != nil || n != 3 {
+		t.Fatalf("expected 3 rows affected, got %d (%v)", n, err)
+	}
+	if _, err := r.LastInsertId(); !errors.Is(err, ErrNoInsertID) {
+		t.Fatalf("expected ErrNoInsertID, got %v", err)
+	}
+}
+
+func TestExecInsertResult(t *testing.T) {
+	r := execStub(t, `{"session":{},"result":{"rowsAffected":"1","insertId":"42"}}`)
+
+	if n, err := r.RowsAffected(); err != nil || n != 1 {
+		t.Fatalf("expected 1 row affected, got %d (%v)", n, err)
+	}
+	if id, err := r.LastInsertId(); err != nil || id != 42 {
+		t.Fatalf("expected insert id 42, got %d (%v)", id, err)
+	}
+}
+
+func TestExecNumericResult(t *testing.T) {
+	r := execStub(t, `{"session":{},"result":{"rowsAffected":2,"insertId":0}}`)
+
+	if n, _ := r.RowsAffected(); n != 2 {
+		t.Fatalf("expected 2 rows affected, got %d", n)
+	}
+	if id, err := r.LastInsertId(); err != nil || id != 0 {
+		t.Fatalf("expected insert id 0, got %d (%v)", id, err)
+	}
+}
+
+func TestExecInfoAndWarnings(t *testing.T) {
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		return 200, `{"session":{"vitessSession":{"warnings":[{"code":1265,"message":"Data truncated for column 'a' at row 1"}]}},
+			"result":{"rowsAffected":"1","info":"Rows matched: 3  Changed: 1  Warnings: 1"}}`
+	})
+	ctx, stats := WithQueryStats(context.Background())
+
+	res, err := c.ExecContext(ctx, "UPDATE t SET a = 'toolong'", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := res.(PsResult)
+	if r.Info() != "Rows matched: 3  Changed: 1  Warnings: 1" {
+		t.Fatalf("unexpected info %q", r.Info())
+	}
+	if w := r.Warnings(); len(w) != 1 || w[0] != "Warning 1265: Data truncated for column 'a' at row 1" {
+		t.Fatalf("unexpected warnings %q", w)
+	}
+	if stats.Warnings != 1 {
+		t.Fatalf("expected 1 warning in the stats, got %d", stats.Warnings)
+	}
+
+	qr, err := (&Client{conn: c}).Execute(context.Background(), "UPDATE t SET a = 'toolong'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if qr.Info != r.Info() || len(qr.Warnings) != 1 {
+		t.Fatalf("unexpected client result %+v", qr)
+	}
+}
@@ -0,0 +1,207 @@
+package planetscale
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+)
+
+// RetryPolicy controls how requests that fail with transient errors, such as
+// a 503 from the gateway or a Fastly backend error, are retried. Only
+// requests that are safe to repeat are retried: creating a session and read
+// queries outside of a transaction.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	// Values below 2 disable retries.
+	MaxAttempts int
+
+	// Backoff is how long to wait before the first retry. The wait doubles
+	// after each attempt.
+	Backoff time.Duration
+
+	// MaxBackoff caps the wait between attempts. Zero means no cap.
+	MaxBackoff time.Duration
+
+	// Jitter randomizes each wait by up to this fraction of it, in [0, 1].
+	Jitter float64
+}
+
+// wait returns how long to wait before the given retry, counting from 1.
+func (p RetryPolicy) wait(retry int) time.Duration {
+	d := p.Backoff << (retry - 1)
+	if d < 0 || (p.MaxBackoff > 0 && d > p.MaxBackoff) {
+		d = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		d += time.Duration(p.Jitter * (2*rand.Float64() - 1) * float64(d))
+	}
+	return d
+}
+
+// isTransient reports whether a failed request is worth retrying.
+func (c *PsConn) isTransient(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if c.bad {
+		return true
+	}
+
+	var httpErr *httpError
+	if errors.As(err, &httpErr) {
+		switch httpErr.status {
+		case 502, 503, 504:
+			return true
+		}
+	}
+	return false
+}
+
+// isFailure reports whether a request failed in a way that counts against
+// its endpoint's circuit breaker.
+func (c *PsConn) isFailure(err error) bool {
+	if c.bad {
+		return true
+	}
+
+	var httpErr *httpError
+	return errors.As(err, &httpErr) && httpErr.status >= 500
+}
+
+// request sends body to endpoint and returns the whole response body.
+func (c *PsConn) request(ctx context.Context, endpoint string, body []byte, idempotent bool) ([]byte, error) {
+	resp, err := c.openRequest(ctx, endpoint, body, idempotent)
+	if err != nil {
+		return nil, err
+	}
+	return c.readBody(ctx, resp)
+}
+
+// openRequest sends body to endpoint and returns the response body, which the
+// caller must close. Transient failures are retried according to the retry
+// policy if the request is idempotent.
+//
+// Credentials from a CredentialProvider or TokenProvider may have been rotated
+// since they were cached, so if they are rejected the request is sent once
+// more with fresh ones. A rejected request wasn't executed, so this is safe
+// for any request.
+func (c *PsConn) openRequest(ctx context.Context, endpoint string, body []byte, idempotent bool) (io.ReadCloser, error) {
+	c.retries = 0
+	start := time.Now()
+	resp, err := c.sendWithRetries(ctx, endpoint, body, idempotent)
+
+	var httpErr *httpError
+	if errors.As(err, &httpErr) && httpErr.status == fsthttp.StatusUnauthorized && (c.cfg.CredentialProvider != nil || c.cfg.TokenProvider != nil) {
+		c.creds.header = ""
+		c.retries++
+		resp, err = c.sendWithRetries(ctx, endpoint, body, idempotent)
+	}
+
+	queryStatsFrom(ctx).addRequest(time.Since(start), c.retries)
+
+	metrics, sent, retries := c.metrics(), int64(len(body)), c.retries
+	if err != nil {
+		metrics.ObserveRequest(endpoint, sent, 0, retries)
+		return nil, err
+	}
+	return &countingBody{ReadCloser: resp, done: func(received int64) {
+		metrics.ObserveRequest(endpoint, sent, received, retries)
+	}}, nil
+}
+
+func (c *PsConn) sendWithRetries(ctx context.Context, endpoint string, body []byte, idempotent bool) (io.ReadCloser, error) {
+	attempts := 1
+	if idempotent && c.cfg.Retry.MaxAttempts > 1 {
+		attempts = c.cfg.Retry.MaxAttempts
+	}
+
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			c.retries++
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(c.cfg.Retry.wait(i)):
+			}
+		}
+
+		if err := c.chooseEndpoint(); err != nil {
+			return nil, err
+		}
+		req, buildErr := c.buildRequest(ctx, endpoint, body)
+		if buildErr != nil {
+			c.recordOutcome(c.endpoint, false, true)
+			return nil, buildErr
+		}
+
+		var resp io.ReadCloser
+		resp, err = c.sendRequest(ctx, req)
+
+		// Only a response, or a request that failed on its way to the
+		// endpoint, says anything about the endpoint's health. Requests
+		// stopped before they were sent, such as by the concurrency limit
+		// or a backend that couldn't be registered, count as neither.
+		failed := c.isFailure(err)
+		c.recordOutcome(c.endpoint, failed, ctx.Err() != nil || (!failed && c.status == 0))
+		if err == nil || !c.isTransient(ctx, err) {
+			return resp, err
+		}
+	}
+
+	if attempts > 1 {
+		return nil, fmt.Errorf("giving up after %d attempts: %w", attempts, err)
+	}
+	return nil, err
+}
+
+// readOnlyStatements are the statements isReadOnly considers safe to retry.
+var readOnlyStatements = []string{"SELECT", "SHOW", "DESCRIBE", "DESC", "EXPLAIN"}
+
+// isReadOnly reports whether query is a read that can be repeated without
+// side effects.
+func isReadOnly(query string) bool {
+	query = skipLeadingComments(query)
+
+	end := strings.IndexAny(query, " \t\r\n(")
+	if end < 0 {
+		end = len(query)
+	}
+	keyword := query[:end]
+
+	for _, s := range readOnlyStatements {
+		if strings.EqualFold(keyword, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// skipLeadingComments trims whitespace and comments from the start of query.
+func skipLeadingComments(query string) string {
+	for {
+		query = strings.TrimLeft(query, " \t\r\n")
+		switch {
+		case strings.HasPrefix(query, "/*"):
+			end := strings.Index(query, "*/")
+			if end < 0 {
+				return ""
+			}
+			query = query[end+2:]
+		case strings.HasPrefix(query, "#"), strings.HasPrefix(query, "-- "):
+			end := strings.IndexByte(query, '\n')
+			if end < 0 {
+				return ""
+			}
+			query = query[end+1:]
+		default:
+			return query
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package planetscale
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// flakyConn returns a connection whose Execute requests fail with a 503 the
+// first failures times. CreateSession always succeeds.
+func flakyConn(failures int, calls *int) *PsConn {
+	return stubConn(func(endpoint string, body []byte) (int, string) {
+		if strings.HasSuffix(endpoint, sessionPath) {
+			return 200, `{"session":{}}`
+		}
+		*calls++
+		if *calls <= failures {
+			return 503, "service unavailable"
+		}
+		return 200, `{"session":{},"result":{"fields":[],"rows":[],"rowsAffected":"1"}}`
+	})
+}
+
+func TestRetryReadQuery(t *testing.T) {
+	var calls int
+	c := flakyConn(2, &calls)
+	c.cfg.Retry = RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+
+	if _, err := c.QueryContext(context.Background(), "/* hi */ select 1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 attempts, got %d", calls)
+	}
+}
+
+func TestRetryExhausted(t *testing.T) {
+	var calls int
+	c := flakyConn(5, &calls)
+	c.cfg.Retry = RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond}
+
+	_, err := c.QueryContext(context.Background(), "SELECT 1", nil)
+	var httpErr *httpError
+	if !errors.As(err, &httpErr) || !strings.Contains(err.Error(), "giving up after 2 attempts") {
+		t.Fatalf("expected exhausted retries error, got %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("expected 2 attempts, got %d", calls)
+	}
+}
+
+func TestNoRetryForWrites(t *testing.T) {
+	var calls int
+	c := flakyConn(1, &calls)
+	c.cfg.Retry = RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+
+	if _, err := c.ExecContext(context.Background(), "UPDATE t SET x = 1", nil); err == nil {
+		t.Fatal("expected write to fail without being retried")
+	}
+	if calls != 1 {
+		t.Fatalf("expected 1 attempt, got %d", calls)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond}
+	for retry, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 300 * time.Millisecond} {
+		if got := p.wait(retry); got != want {
+			t.Errorf("retry %d: expected %v, got %v", retry, want, got)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := p.wait(1); d < 50*time.Millisecond || d > 150*time.Millisecond {
+			t.Fatalf("jittered wait %v out of range", d)
+		}
+	}
+}
+
+func TestIsReadOnly(t *testing.T) {
+	for query, want := range map[string]bool{
+		"SELECT 1":                    true,
+		"  -- note\n show tables":     true,
+		"select(1)":                   true,
+		"/* a */ /* b */ EXPLAIN x":   true,
+		"INSERT INTO t VALUES (1)":    false,
+		"/* SELECT */ DELETE FROM t":  false,
+		"SELECTION":                   false,
+		"/* unterminated SELECT 1":    false,
+		"WITH x AS (SELECT 1) DELETE": false,
+	} {
+		if got := isReadOnly(query); got != want {
+			t.Errorf("%q: expected %v, got %v", query, want, got)
+		}
+	}
+}
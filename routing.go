@@ -0,0 +1,211 @@
+package planetscale
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// routing is the query routing a session has been switched to. The zero
+// value is a new session's default: queries go to the primary of the default
+// keyspace without Boost.
+//
+// Three routing modes are supported, set for the connection or requested
+// per query with a context:
+//
+//   - WithReplica sends the query to a read replica, by switching the
+//     session with USE @replica. WithPrimary sends it to the primary on a
+//     connection whose target is a replica.
+//   - WithKeyspaceShard sends the query to a keyspace other than the
+//     connection's, or to one of its shards, by switching the session with
+//     USE keyspace:shard.
+//   - WithBoost lets the query be served by PlanetScale Boost, by setting
+//     @@boost_cached_queries on the session. WithoutBoost keeps it from
+//     being served by Boost on a connection that enables it for every query.
+//
+// The routing can't be sent with the query's Execute request. PlanetScale
+// signs the sessions it returns and rejects one whose target was changed,
+// Vitess has no comment directive that selects a tablet type or keyspace,
+// and Boost is only enabled by its session variable. So the session is
+// switched with its own statements, which vtgate records in the session.
+// A connection only issues them when a query's routing differs from the
+// previous query's, so consecutive queries with the same routing cost no
+// extra round trips.
+type routing struct {
+	keyspace string
+	// shard, if set, is the shard of the keyspace queries are sent to,
+	// such as "-80".
+	shard string
+	// targeted is set by WithKeyspaceShard, so the keyspace and shard
+	// replace the connection's Config.Database and Config.Shard.
+	targeted bool
+	// tabletType is the type of tablet queries are sent to, such as
+	// "replica". Empty means the primary.
+	tabletType string
+	boost      bool
+
+	// noBoost is set by WithoutBoost, so a query isn't served by Boost even
+	// if the connection's Config.Boost is.
+	noBoost bool
+}
+
+// Tablet types a session can be targeted at.
+const (
+	targetPrimary = "primary"
+	targetReplica = "replica"
+	targetRdonly  = "rdonly"
+)
+
+// validTarget reports an error if target isn't a tablet type queries can be
+// sent to.
+func validTarget(target string) error {
+	switch target {
+	case "", targetPrimary, targetReplica, targetRdonly:
+		return nil
+	}
+	return fmt.Errorf("invalid target %q", target)
+}
+
+type routingKey struct{}
+
+func routingFrom(ctx context.Context) routing {
+	r, _ := ctx.Value(routingKey{}).(routing)
+	return r
+}
+
+// WithReplica returns a context that routes queries run with it to a read
+// replica. Replicas may lag behind the primary.
+func WithReplica(ctx context.Context) context.Context {
+	r := routingFrom(ctx)
+	r.tabletType = targetReplica
+	return context.WithValue(ctx, routingKey{}, r)
+}
+
+// WithPrimary returns a context that routes queries run with it to the
+// primary, overriding a connection's replica target.
+func WithPrimary(ctx context.Context) context.Context {
+	r := routingFrom(ctx)
+	r.tabletType = targetPrimary
+	return context.WithValue(ctx, routingKey{}, r)
+}
+
+// WithKeyspaceShard returns a context that routes queries run with it to
+// shard of keyspace, overriding the connection's Config.Database and
+// Config.Shard. An empty keyspace is the connection's, and an empty shard
+// lets Vitess route the query to its shards as usual.
+func WithKeyspaceShard(ctx context.Context, keyspace, shard string) context.Context {
+	r := routingFrom(ctx)
+	r.keyspace, r.shard, r.targeted = keyspace, shard, true
+	return context.WithValue(ctx, routingKey{}, r)
+}
+
+// validShard reports an error if shard can't be part of a Vitess target.
+func validShard(keyspace, shard string) error {
+	if shard == "" {
+		return nil
+	}
+	if keyspace == "" {
+		return fmt.Errorf("shard %q needs a keyspace", shard)
+	}
+	if strings.ContainsAny(shard, ":@`") {
+		return fmt.Errorf("invalid shard %q", shard)
+	}
+	return nil
+}
+
+// WithBoost returns a context that allows queries run with it to be served by
+// PlanetScale Boost's query cache.
+func WithBoost(ctx context.Context) context.Context {
+	r := routingFrom(ctx)
+	r.boost, r.noBoost = true, false
+	return context.WithValue(ctx, routingKey{}, r)
+}
+
+// WithoutBoost returns a context that keeps queries run with it from being
+// served by PlanetScale Boost, overriding a connection's Config.Boost.
+func WithoutBoost(ctx context.Context) context.Context {
+	r := routingFrom(ctx)
+	r.boost, r.noBoost = false, true
+	return context.WithValue(ctx, routingKey{}, r)
+}
+
+// route switches the session to the routing requested by ctx, in the
+// connection's database and by default at its target, after restoring the
+// session ctx asks for from the SessionStore.
+func (c *PsConn) route(ctx context.Context) error {
+	if err := c.restoreSession(ctx); err != nil {
+		return err
+	}
+
+	want := c.routingFor(ctx)
+	if want.keyspace != c.routing.keyspace || want.shard != c.routing.shard || want.tablet() != c.routing.tablet() {
+		if err := validTarget(want.tabletType); err != nil {
+			return err
+		}
+		if err := validShard(want.keyspace, want.shard); err != nil {
+			return err
+		}
+		if err := c.run(ctx, "USE "+want.target()); err != nil {
+			return err
+		}
+		c.routing.keyspace = want.keyspace
+		c.routing.shard = want.shard
+		c.routing.tabletType = want.tabletType
+	}
+
+	if want.boost != c.routing.boost {
+		stmt := "SET @@boost_cached_queries = " + strconv.FormatBool(want.boost)
+		if err := c.run(ctx, stmt); err != nil {
+			return err
+		}
+		c.routing.boost = want.boost
+	}
+
+	return nil
+}
+
+// routingFor returns the routing ctx asks for, with the connection's
+// defaults for what it leaves out. Queries in a transaction always go to the
+// primary.
+func (c *PsConn) routingFor(ctx context.Context) routing {
+	want := routingFrom(ctx)
+	if !want.targeted {
+		want.shard = c.cfg.Shard
+	}
+	if want.keyspace == "" {
+		want.keyspace = c.cfg.Database
+	}
+	want.targeted = false
+	switch {
+	case c.inTx:
+		// The transaction's writes must reach the primary it was begun on.
+		want.tabletType = targetPrimary
+	case want.tabletType == "":
+		want.tabletType = c.cfg.Target
+	}
+	if !want.noBoost {
+		want.boost = want.boost || c.cfg.Boost
+	}
+	return want
+}
+
+// tablet returns the type of tablet r sends queries to.
+func (r routing) tablet() string {
+	if r.tabletType == "" {
+		return targetPrimary
+	}
+	return r.tabletType
+}
+
+// target is the Vitess target string for USE that selects r's keyspace,
+// shard and tablet type.
+func (r routing) target() string {
+	if r.keyspace == "" {
+		return "@" + r.tablet()
+	}
+	if r.shard != "" {
+		return quoteIdentifier(r.keyspace + ":" + r.shard + "@" + r.tablet())
+	}
+	return quoteIdentifier(r.keyspace + "@" + r.tablet())
+}
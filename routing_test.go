@@ -0,0 +1,139 @@
+package planetscale
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestQueryRouting(t *testing.T) {
+	var queries []string
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		if strings.HasSuffix(endpoint, sessionPath) {
+			return 200, `{"session":{"signature":"abc"}}`
+		}
+		queries = append(queries, string(parseJSON(t, string(body)).GetStringBytes("query")))
+		return 200, `{"session":{"signature":"abc"},"result":{"fields":[],"rows":[]}}`
+	})
+
+	ctx := context.Background()
+	for _, ctx := range []context.Context{
+		WithReplica(ctx),
+		WithReplica(ctx),
+		WithBoost(WithReplica(ctx)),
+		ctx,
+	} {
+		if _, err := c.QueryContext(ctx, "SELECT 1", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{
+		"USE @replica",
+		"SELECT 1",
+		"SELECT 1",
+		"SET @@boost_cached_queries = true",
+		"SELECT 1",
+		"USE @primary",
+		"SET @@boost_cached_queries = false",
+		"SELECT 1",
+	}
+	if strings.Join(queries, "; ") != strings.Join(want, "; ") {
+		t.Fatalf("expected queries:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(queries, "\n"))
+	}
+}
+
+func TestDatabaseRouting(t *testing.T) {
+	var queries []string
+	c := recordingConn(t, &queries)
+	c.cfg.Database = "my`db"
+
+	ctx := context.Background()
+	for _, ctx := range []context.Context{ctx, ctx, WithReplica(ctx)} {
+		if _, err := c.ExecContext(ctx, "UPDATE t SET a = 1", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := "USE `my``db@primary`; UPDATE t SET a = 1; UPDATE t SET a = 1; USE `my``db@replica`; UPDATE t SET a = 1"
+	if got := strings.Join(queries, "; "); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestKeyspaceShardRouting(t *testing.T) {
+	var queries []string
+	c := recordingConn(t, &queries)
+	c.cfg.Database = "main"
+	c.cfg.Shard = "-80"
+
+	ctx := context.Background()
+	for _, ctx := range []context.Context{
+		ctx,
+		WithKeyspaceShard(ctx, "lookup", ""),
+		WithReplica(WithKeyspaceShard(ctx, "", "80-")),
+		ctx,
+	} {
+		if _, err := c.ExecContext(ctx, "UPDATE t SET a = 1", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := "USE `main:-80@primary`; UPDATE t SET a = 1; USE `lookup@primary`; UPDATE t SET a = 1; " +
+		"USE `main:80-@replica`; UPDATE t SET a = 1; USE `main:-80@primary`; UPDATE t SET a = 1"
+	if got := strings.Join(queries, "; "); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	c.cfg.Database = ""
+	if _, err := c.ExecContext(ctx, "UPDATE t SET a = 1", nil); err == nil {
+		t.Fatal("expected a shard without a keyspace to be rejected")
+	}
+	if _, err := c.ExecContext(WithKeyspaceShard(ctx, "main", "-80@rdonly"), "UPDATE t SET a = 1", nil); err == nil {
+		t.Fatal("expected an invalid shard to be rejected")
+	}
+}
+
+func TestConnectionTarget(t *testing.T) {
+	var queries []string
+	c := recordingConn(t, &queries)
+	c.cfg.Target = "replica"
+
+	ctx := context.Background()
+	for _, ctx := range []context.Context{ctx, ctx, WithPrimary(ctx), ctx} {
+		if _, err := c.QueryContext(ctx, "SELECT 1", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := "USE @replica; SELECT 1; SELECT 1; USE @primary; SELECT 1; USE @replica; SELECT 1"
+	if got := strings.Join(queries, "; "); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	if _, err := ParseDSN("host=example.com&target=leader"); err == nil {
+		t.Fatal("expected error for an invalid target")
+	}
+	if cfg, err := ParseDSN("host=example.com&target=rdonly"); err != nil || cfg.Target != "rdonly" {
+		t.Fatalf("expected rdonly target, got %v", err)
+	}
+}
+
+func TestConnectionBoost(t *testing.T) {
+	var queries []string
+	c := recordingConn(t, &queries)
+	c.cfg.Boost = true
+
+	ctx := context.Background()
+	for _, ctx := range []context.Context{ctx, ctx, WithoutBoost(ctx), WithBoost(WithoutBoost(ctx))} {
+		if _, err := c.ExecContext(ctx, "SELECT 1", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := "SET @@boost_cached_queries = true; SELECT 1; SELECT 1; " +
+		"SET @@boost_cached_queries = false; SELECT 1; SET @@boost_cached_queries = true; SELECT 1"
+	if got := strings.Join(queries, "; "); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,125 @@
+package planetscale
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+)
+
+// quoteIdentifier quotes name for use as a MySQL identifier.
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// ShowCreateTable returns the CREATE TABLE statement for table, as reported
+// by SHOW CREATE TABLE.
+func (c *PsConn) ShowCreateTable(ctx context.Context, table string) (string, error) {
+	rows, err := c.QueryContext(ctx, "SHOW CREATE TABLE "+quoteIdentifier(table), nil)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	dest := make([]driver.Value, len(rows.Columns()))
+	if len(dest) < 2 {
+		return "", fmt.Errorf("unexpected SHOW CREATE TABLE columns: %v", rows.Columns())
+	}
+
+	if err := rows.Next(dest); err != nil {
+		return "", fmt.Errorf("no SHOW CREATE TABLE result for %s: %w", table, err)
+	}
+
+	switch ddl := dest[1].(type) {
+	case string:
+		return ddl, nil
+	case []byte:
+		return string(ddl), nil
+	default:
+		return "", fmt.Errorf("unexpected SHOW CREATE TABLE value %T", dest[1])
+	}
+}
+
+// ColumnInfo describes a column of a table, as information_schema.columns
+// reports it.
+type ColumnInfo struct {
+	Name string
+
+	// Type is the column's full type, such as "varchar(255)" or
+	// "bigint unsigned", and DataType its base type, such as "varchar".
+	Type     string
+	DataType string
+
+	Nullable bool
+
+	// Default is the column's default value, if HasDefault is set. A
+	// default of NULL isn't reported as one.
+	Default    string
+	HasDefault bool
+
+	// Key is "PRI", "UNI" or "MUL" for columns that are part of an index,
+	// and Extra holds attributes such as "auto_increment".
+	Key   string
+	Extra string
+
+	Collation string
+	Comment   string
+}
+
+const listTablesQuery = "SELECT table_name FROM information_schema.tables " +
+	"WHERE table_schema = DATABASE() AND table_type = 'BASE TABLE' ORDER BY table_name"
+
+const describeTableQuery = "SELECT column_name, column_type, data_type, is_nullable, column_default, " +
+	"column_key, extra, collation_name, column_comment FROM information_schema.columns " +
+	"WHERE table_schema = DATABASE() AND table_name = ? ORDER BY ordinal_position"
+
+// ListTables returns the names of the tables in the client's database,
+// sorted by name. Views aren't included.
+func (cl *Client) ListTables(ctx context.Context) ([]string, error) {
+	qr, err := cl.Execute(ctx, listTablesQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	tables := make([]string, 0, len(qr.Rows))
+	for _, row := range qr.Rows {
+		if len(row.Values) < 1 {
+			return nil, fmt.Errorf("unexpected information_schema.tables row with %d columns", len(row.Values))
+		}
+		tables = append(tables, string(row.Values[0]))
+	}
+	return tables, nil
+}
+
+// DescribeTable returns the columns of table in the client's database, in
+// the order they are defined.
+func (cl *Client) DescribeTable(ctx context.Context, table string) ([]ColumnInfo, error) {
+	qr, err := cl.Execute(ctx, describeTableQuery, table)
+	if err != nil {
+		return nil, err
+	}
+	if len(qr.Rows) == 0 {
+		return nil, fmt.Errorf("table %s does not exist", table)
+	}
+
+	columns := make([]ColumnInfo, 0, len(qr.Rows))
+	for _, row := range qr.Rows {
+		v := row.Values
+		if len(v) < 9 {
+			return nil, fmt.Errorf("unexpected information_schema.columns row with %d columns", len(v))
+		}
+		columns = append(columns, ColumnInfo{
+			Name:       string(v[0]),
+			Type:       string(v[1]),
+			DataType:   string(v[2]),
+			Nullable:   string(v[3]) == "YES",
+			Default:    string(v[4]),
+			HasDefault: v[4] != nil,
+			Key:        string(v[5]),
+			Extra:      string(v[6]),
+			Collation:  string(v[7]),
+			Comment:    string(v[8]),
+		})
+	}
+	return columns, nil
+}
@@ -0,0 +1,83 @@
+package planetscale
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestShowCreateTable(t *testing.T) {
+	const ddl = "CREATE TABLE `user` (\n  `id` bigint NOT NULL AUTO_INCREMENT,\n  `name` varchar(255) NOT NULL DEFAULT '',\n  PRIMARY KEY (`id`)\n)"
+
+	var query string
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		if strings.HasSuffix(endpoint, sessionPath) {
+			return 200, `{"session":{"signature":"abc"}}`
+		}
+		query = string(parseJSON(t, string(body)).GetStringBytes("query"))
+		return 200, `{"session":{"signature":"abc"},"result":{
+			"fields":[{"name":"Table","type":"VARCHAR"},{"name":"Create Table","type":"VARCHAR"}],
+			"rows":[` + rowJSON("user", ddl) + `]}}`
+	})
+
+	got, err := c.ShowCreateTable(context.Background(), "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query != "SHOW CREATE TABLE `user`" {
+		t.Fatalf("unexpected query %q", query)
+	}
+	if got != ddl {
+		t.Fatalf("expected %q, got %q", ddl, got)
+	}
+	if !strings.Contains(got, "NOT NULL DEFAULT ''") {
+		t.Fatalf("expected column defaults in DDL, got %q", got)
+	}
+}
+
+func TestListTablesAndDescribeTable(t *testing.T) {
+	var queries []string
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		if strings.HasSuffix(endpoint, sessionPath) {
+			return 200, `{"session":{}}`
+		}
+		v := parseJSON(t, string(body))
+		queries = append(queries, string(v.GetStringBytes("query")))
+		if strings.Contains(queries[len(queries)-1], "information_schema.tables") {
+			return 200, `{"session":{},"result":{"fields":[{"name":"TABLE_NAME","type":"VARCHAR"}],"rows":[` + rowJSON("posts") + `,` + rowJSON("users") + `]}}`
+		}
+		if string(v.GetStringBytes("bindVariables", "v1", "value")) != "dXNlcnM=" {
+			return 200, `{"session":{},"result":{"fields":[],"rows":[]}}`
+		}
+		return 200, `{"session":{},"result":{"fields":[],"rows":[{"lengths":["2","15","6","2","-1","3","14","-1","0"],"values":"aWRiaWdpbnQgdW5zaWduZWRiaWdpbnROT1BSSWF1dG9faW5jcmVtZW50"},{"lengths":["5","12","7","3","0","3","0","18","5"],"values":"ZW1haWx2YXJjaGFyKDI1NSl2YXJjaGFyWUVTVU5JdXRmOG1iNF8wOTAwX2FpX2NpbG9naW4="}]}}`
+	})
+	cl := &Client{conn: c}
+
+	tables, err := cl.ListTables(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(tables, ",") != "posts,users" {
+		t.Fatalf("unexpected tables %q", tables)
+	}
+
+	columns, err := cl.DescribeTable(context.Background(), "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ColumnInfo{
+		{Name: "id", Type: "bigint unsigned", DataType: "bigint", Key: "PRI", Extra: "auto_increment"},
+		{Name: "email", Type: "varchar(255)", DataType: "varchar", Nullable: true, HasDefault: true, Key: "UNI", Collation: "utf8mb4_0900_ai_ci", Comment: "login"},
+	}
+	if !reflect.DeepEqual(columns, want) {
+		t.Fatalf("expected %+v, got %+v", want, columns)
+	}
+	if !strings.HasSuffix(queries[1], "WHERE table_schema = DATABASE() AND table_name = :v1 ORDER BY ordinal_position") {
+		t.Fatalf("unexpected query %q", queries[1])
+	}
+
+	if _, err := cl.DescribeTable(context.Background(), "missing"); err == nil || err.Error() != "table missing does not exist" {
+		t.Fatalf("expected a missing table error, got %v", err)
+	}
+}
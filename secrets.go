@@ -0,0 +1,49 @@
+package planetscale
+
+import (
+	"context"
+	"fmt"
+)
+
+// SecretStore is a store of secrets, such as a Fastly Secret Store opened
+// with secretstore.Open. Plaintext returns the decrypted value of the secret
+// named key.
+//
+// The Fastly store's Get returns a *Secret, so it is adapted with a small
+// wrapper:
+//
+//	type fastlySecrets struct{ *secretstore.Store }
+//
+//	func (s fastlySecrets) Plaintext(key string) ([]byte, error) {
+//		secret, err := s.Get(key)
+//		if err != nil {
+//			return nil, err
+//		}
+//		return secret.Plaintext()
+//	}
+type SecretStore interface {
+	Plaintext(key string) ([]byte, error)
+}
+
+// WithSecretStore authenticates with the username and password stored in
+// store under usernameKey and passwordKey, instead of credentials compiled
+// into the service. They are read when the first request is made and read
+// again if PlanetScale rejects them, so rotated passwords are picked up
+// without redeploying.
+func WithSecretStore(store SecretStore, usernameKey, passwordKey string) Option {
+	return WithCredentialProvider(secretStoreCredentials(store, usernameKey, passwordKey), -1)
+}
+
+func secretStoreCredentials(store SecretStore, usernameKey, passwordKey string) CredentialProvider {
+	return func(ctx context.Context) (string, string, error) {
+		username, err := store.Plaintext(usernameKey)
+		if err != nil {
+			return "", "", fmt.Errorf("secret %s: %w", usernameKey, err)
+		}
+		password, err := store.Plaintext(passwordKey)
+		if err != nil {
+			return "", "", fmt.Errorf("secret %s: %w", passwordKey, err)
+		}
+		return string(username), string(password), nil
+	}
+}
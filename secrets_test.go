@@ -0,0 +1,72 @@
+package planetscale
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+)
+
+// mapSecrets is a SecretStore that counts how often it is read.
+type mapSecrets struct {
+	secrets map[string]string
+	reads   int
+}
+
+func (s *mapSecrets) Plaintext(key string) ([]byte, error) {
+	s.reads++
+	v, ok := s.secrets[key]
+	if !ok {
+		return nil, fmt.Errorf("no secret %s", key)
+	}
+	return []byte(v), nil
+}
+
+func TestSecretStoreCredentials(t *testing.T) {
+	store := &mapSecrets{secrets: map[string]string{"ps_user": "alice", "ps_pass": "first"}}
+	password := "first"
+
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		return 200, `{"session":{},"result":{}}`
+	})
+	send := c.send
+	c.send = func(ctx context.Context, req *fsthttp.Request, backend string) (*fsthttp.Response, error) {
+		want := "Basic " + base64.StdEncoding.EncodeToString([]byte("alice:"+password))
+		if req.Header.Get("Authorization") != want {
+			resp, err := send(ctx, req, backend)
+			if err == nil {
+				resp.StatusCode = fsthttp.StatusUnauthorized
+			}
+			return resp, err
+		}
+		return send(ctx, req, backend)
+	}
+
+	var cfg Config
+	WithSecretStore(store, "ps_user", "ps_pass")(&cfg)
+	c.cfg.CredentialProvider, c.cfg.CredentialTTL = cfg.CredentialProvider, cfg.CredentialTTL
+
+	exec := func() {
+		t.Helper()
+		if _, err := c.ExecContext(context.Background(), "UPDATE t SET a = 1", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	exec()
+	exec()
+	if store.reads != 2 {
+		t.Fatalf("expected credentials to be read once, got %d reads", store.reads)
+	}
+
+	// After the password is rotated, the cached one is rejected and the
+	// request is sent again with the new one.
+	password = "second"
+	store.secrets["ps_pass"] = "second"
+	exec()
+	if store.reads != 4 {
+		t.Fatalf("expected credentials to be read again after rejection, got %d reads", store.reads)
+	}
+}
@@ -0,0 +1,150 @@
+package planetscale
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// SessionStore saves Vitess sessions so a session can be picked up again by
+// a later Compute invocation, keeping read-your-writes consistency between
+// requests from the same user. Sessions are saved under a key chosen by the
+// caller with WithSessionKey, such as a user id or session cookie.
+//
+// Load returns nil and no error if nothing is stored under key. Save is
+// called whenever a response changes the session.
+//
+// A Fastly KV Store is a natural fit. With an SDK that supports KV Stores, a
+// store can be:
+//
+//	type kvSessions struct{ *kvstore.Store }
+//
+//	func (s kvSessions) Load(ctx context.Context, key string) ([]byte, error) {
+//		e, err := s.Lookup(key)
+//		if errors.Is(err, kvstore.ErrKeyNotFound) {
+//			return nil, nil
+//		} else if err != nil {
+//			return nil, err
+//		}
+//		return io.ReadAll(e)
+//	}
+//
+//	func (s kvSessions) Save(ctx context.Context, key string, session []byte) error {
+//		return s.Insert(key, bytes.NewReader(session))
+//	}
+type SessionStore interface {
+	Load(ctx context.Context, key string) ([]byte, error)
+	Save(ctx context.Context, key string, session []byte) error
+}
+
+type sessionKeyKey struct{}
+
+// WithSessionKey returns a context that makes queries run with it use the
+// session saved under key in the connection's SessionStore, and save the
+// session there as it changes.
+func WithSessionKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, sessionKeyKey{}, key)
+}
+
+// storedSession is a session as it is saved in a SessionStore, along with the
+// routing it was switched to. A session from a protobuf response is saved
+// in its encoded form as Proto.
+type storedSession struct {
+	Session    json.RawMessage `json:"session,omitempty"`
+	Proto      []byte          `json:"proto,omitempty"`
+	Keyspace   string          `json:"keyspace,omitempty"`
+	Shard      string          `json:"shard,omitempty"`
+	TabletType string          `json:"tabletType,omitempty"`
+	Boost      bool            `json:"boost,omitempty"`
+}
+
+// restoreSession switches the connection to the session saved under the
+// session key of ctx, if it differs from the one the connection is using. A
+// connection in a transaction keeps its session.
+func (c *PsConn) restoreSession(ctx context.Context) error {
+	if c.cfg.SessionStore == nil || c.inTx {
+		return nil
+	}
+
+	key, _ := ctx.Value(sessionKeyKey{}).(string)
+	if key == c.sessionKey {
+		return nil
+	}
+
+	c.sessionKey, c.savedSession = key, nil
+	c.session, c.sessionID, c.routing = nil, "", routing{}
+	if key == "" {
+		return nil
+	}
+
+	b, err := c.cfg.SessionStore.Load(ctx, key)
+	if err != nil {
+		return fmt.Errorf("error loading session: %w", err)
+	}
+	if b == nil {
+		return nil
+	}
+
+	var stored storedSession
+	if err := json.Unmarshal(b, &stored); err != nil {
+		return fmt.Errorf("error loading session: %w", err)
+	}
+
+	// A session saved in the other encoding can't be sent back, so a new
+	// one is started instead.
+	switch {
+	case c.useProtobuf() && stored.Proto != nil:
+		id, _, err := decodeSession(stored.Proto)
+		if err != nil {
+			return fmt.Errorf("error loading session: %w", err)
+		}
+		c.session, c.sessionID = stored.Proto, id
+	case !c.useProtobuf() && stored.Session != nil:
+		p := parserPool.Get()
+		defer parserPool.Put(p)
+
+		v, err := p.ParseBytes(stored.Session)
+		if err != nil {
+			return fmt.Errorf("error loading session: %w", err)
+		}
+		c.session = c.marshalSession(v)
+		c.sessionID = string(v.GetStringBytes("vitessSession", "SessionUUID"))
+	default:
+		return nil
+	}
+	c.routing = routing{keyspace: stored.Keyspace, shard: stored.Shard, tabletType: stored.TabletType, boost: stored.Boost}
+	c.savedSession = b
+	return nil
+}
+
+// saveSession saves the connection's session under its session key, if it
+// has changed since it was last saved. Errors are ignored, since the query
+// that changed the session has already succeeded, and the next invocation
+// simply starts a new session.
+func (c *PsConn) saveSession(ctx context.Context) {
+	if c.cfg.SessionStore == nil || c.sessionKey == "" || c.session == nil || c.settingUp {
+		return
+	}
+
+	stored := storedSession{
+		Keyspace:   c.routing.keyspace,
+		Shard:      c.routing.shard,
+		TabletType: c.routing.tabletType,
+		Boost:      c.routing.boost,
+	}
+	if c.useProtobuf() {
+		stored.Proto = c.session
+	} else {
+		stored.Session = c.session
+	}
+
+	b, err := json.Marshal(stored)
+	if err != nil || bytes.Equal(b, c.savedSession) {
+		return
+	}
+
+	if c.cfg.SessionStore.Save(ctx, c.sessionKey, b) == nil {
+		c.savedSession = b
+	}
+}
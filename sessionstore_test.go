@@ -0,0 +1,89 @@
+package planetscale
+
+import (
+	"context"
+	"testing"
+)
+
+type memSessions map[string][]byte
+
+func (m memSessions) Load(ctx context.Context, key string) ([]byte, error) {
+	return m[key], nil
+}
+
+func (m memSessions) Save(ctx context.Context, key string, session []byte) error {
+	m[key] = session
+	return nil
+}
+
+func TestSessionStoreResumesSession(t *testing.T) {
+	store := memSessions{}
+	var paths, sessions []string
+
+	newStoreConn := func() *PsConn {
+		c := stubConn(func(endpoint string, body []byte) (int, string) {
+			paths = append(paths, endpoint)
+			if endpoint == defaultAPIPrefix+sessionPath {
+				return 200, `{"session":{"vitessSession":{"SessionUUID":"fresh"}}}`
+			}
+			sessions = append(sessions, string(parseJSON(t, string(body)).GetStringBytes("session", "vitessSession", "SessionUUID")))
+			return 200, `{"session":{"vitessSession":{"SessionUUID":"written"}},"result":{"fields":[],"rows":[]}}`
+		})
+		c.cfg.SessionStore = store
+		return c
+	}
+
+	ctx := WithSessionKey(context.Background(), "alice")
+	if _, err := newStoreConn().ExecContext(ctx, "INSERT INTO t VALUES (1)", nil); err != nil {
+		t.Fatal(err)
+	}
+	if store["alice"] == nil {
+		t.Fatal("expected the session to be saved")
+	}
+
+	// A connection in a later invocation picks up the saved session instead
+	// of creating one.
+	paths = nil
+	if _, err := newStoreConn().QueryContext(ctx, "SELECT * FROM t", nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || paths[0] != defaultAPIPrefix+executorPath {
+		t.Fatalf("expected a single Execute request, got %q", paths)
+	}
+	if want := []string{"fresh", "written"}; len(sessions) != 2 || sessions[0] != want[0] || sessions[1] != want[1] {
+		t.Fatalf("expected queries with sessions %q, got %q", want, sessions)
+	}
+}
+
+func TestSessionStoreRestoresRouting(t *testing.T) {
+	store := memSessions{}
+	var queries []string
+	newStoreConn := func() *PsConn {
+		c := stubConn(func(endpoint string, body []byte) (int, string) {
+			if endpoint == defaultAPIPrefix+executorPath {
+				queries = append(queries, string(parseJSON(t, string(body)).GetStringBytes("query")))
+			}
+			return 200, `{"session":{},"result":{"fields":[],"rows":[]}}`
+		})
+		c.cfg.SessionStore = store
+		return c
+	}
+
+	ctx := WithReplica(WithSessionKey(context.Background(), "bob"))
+	if _, err := newStoreConn().QueryContext(ctx, "SELECT 1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newStoreConn().QueryContext(ctx, "SELECT 2", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"USE @replica", "SELECT 1", "SELECT 2"}
+	if len(queries) != len(want) {
+		t.Fatalf("expected queries %q, got %q", want, queries)
+	}
+	for i := range want {
+		if queries[i] != want[i] {
+			t.Fatalf("expected queries %q, got %q", want, queries)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package planetscale
+
+import (
+	"context"
+	"time"
+)
+
+// QueryStats are statistics of the queries run with a context from
+// WithQueryStats, added up over all of them. Comparing ServerTime with
+// RequestTime attributes a query's latency between PlanetScale and the
+// network between it and Fastly.
+type QueryStats struct {
+	// Queries is how many statements were executed, including those the
+	// driver runs itself, such as setting up a new session.
+	Queries int
+
+	// ServerTime is how long PlanetScale spent executing the statements, as
+	// reported by the API.
+	ServerTime time.Duration
+
+	// RequestTime is how long requests to the API took until their
+	// responses arrived, including retries and creating sessions.
+	RequestTime time.Duration
+
+	// Retries is how many times requests were retried.
+	Retries int
+
+	// RowsReturned is how many rows were read from results, and
+	// RowsAffected how many rows statements changed.
+	RowsReturned int
+	RowsAffected uint64
+
+	// Warnings is how many warnings MySQL raised for the statements, such
+	// as for data truncated by an INSERT.
+	Warnings int
+}
+
+type queryStatsKey struct{}
+
+// WithQueryStats returns a context whose queries record their statistics in
+// the returned QueryStats. It is only safe to read once the queries have
+// finished and their rows have been closed.
+//
+//	ctx, stats := planetscale.WithQueryStats(ctx)
+//	rows, err := db.QueryContext(ctx, query)
+//	...
+//	rows.Close()
+//	if stats.ServerTime > time.Second {
+//		log.Printf("slow query (%s on the server, %s total)", stats.ServerTime, stats.RequestTime)
+//	}
+func WithQueryStats(ctx context.Context) (context.Context, *QueryStats) {
+	s := &QueryStats{}
+	return context.WithValue(ctx, queryStatsKey{}, s), s
+}
+
+// queryStatsFrom returns the QueryStats of ctx, which is nil if it has none.
+// The methods of a nil QueryStats do nothing.
+func queryStatsFrom(ctx context.Context) *QueryStats {
+	s, _ := ctx.Value(queryStatsKey{}).(*QueryStats)
+	return s
+}
+
+// addQuery records an executed statement and its server-side timing, in
+// seconds as the API reports it.
+func (s *QueryStats) addQuery(timing float64, rowsAffected uint64) {
+	if s == nil {
+		return
+	}
+	s.Queries++
+	s.ServerTime += time.Duration(timing * float64(time.Second))
+	s.RowsAffected += rowsAffected
+}
+
+func (s *QueryStats) addRequest(d time.Duration, retries int) {
+	if s == nil {
+		return
+	}
+	s.RequestTime += d
+	s.Retries += retries
+}
+
+func (s *QueryStats) addWarnings(n int) {
+	if s == nil {
+		return
+	}
+	s.Warnings += n
+}
+
+func (s *QueryStats) addRows(n int) {
+	if s == nil {
+		return
+	}
+	s.RowsReturned += n
+}
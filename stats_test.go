@@ -0,0 +1,52 @@
+package planetscale
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+)
+
+func TestQueryStats(t *testing.T) {
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		if string(parseJSON(t, string(body)).GetStringBytes("query")) == "UPDATE t SET a = 1" {
+			return 200, `{"session":{},"result":{"rowsAffected":"3"},"timing":0.5}`
+		}
+		return 200, `{"session":{},"result":{"fields":[{"name":"a","type":"VARCHAR"}],"rows":[` +
+			rowJSON("x") + `,` + rowJSON("y") + `]},"timing":0.25}`
+	})
+	c.session = []byte(`{}`)
+
+	ctx, stats := WithQueryStats(context.Background())
+
+	rows, err := c.QueryContext(ctx, "SELECT a FROM t", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := make([]driver.Value, 1)
+	for rows.Next(dest) == nil {
+	}
+	rows.Close()
+
+	if _, err := c.ExecContext(ctx, "UPDATE t SET a = 1", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Queries != 2 || stats.ServerTime != 750*time.Millisecond {
+		t.Fatalf("expected 2 queries taking 750ms, got %d taking %s", stats.Queries, stats.ServerTime)
+	}
+	if stats.RowsReturned != 2 || stats.RowsAffected != 3 {
+		t.Fatalf("expected 2 rows returned and 3 affected, got %d and %d", stats.RowsReturned, stats.RowsAffected)
+	}
+	if stats.RequestTime <= 0 {
+		t.Fatalf("expected the request time to be recorded, got %s", stats.RequestTime)
+	}
+
+	// Queries without stats in their context don't record any.
+	if _, err := c.ExecContext(context.Background(), "UPDATE t SET a = 1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Queries != 2 {
+		t.Fatalf("expected stats to be unchanged, got %d queries", stats.Queries)
+	}
+}
@@ -0,0 +1,176 @@
+package planetscale
+
+import (
+	"container/list"
+	"context"
+	"database/sql/driver"
+)
+
+// defaultStmtCacheSize is the number of parsed statements a connection caches
+// when Config.StmtCacheSize is zero.
+const defaultStmtCacheSize = 64
+
+// stmtCache is a least recently used cache of parsed queries, so statements
+// that are prepared or run with arguments over and over are only scanned for
+// placeholders once.
+type stmtCache struct {
+	size  int
+	order *list.List
+	items map[string]*list.Element
+}
+
+type stmtCacheEntry struct {
+	key   string
+	query parsedQuery
+}
+
+func newStmtCache(size int) *stmtCache {
+	if size == 0 {
+		size = defaultStmtCacheSize
+	}
+
+	return &stmtCache{
+		size:  size,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (c *stmtCache) get(query string) parsedQuery {
+	if e, ok := c.items[query]; ok {
+		c.order.MoveToFront(e)
+		return e.Value.(stmtCacheEntry).query
+	}
+
+	q := parseQuery(query)
+	c.items[query] = c.order.PushFront(stmtCacheEntry{key: query, query: q})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(stmtCacheEntry).key)
+	}
+
+	return q
+}
+
+// parseQuery parses query using the connection's statement cache.
+func (c *PsConn) parseQuery(query string) parsedQuery {
+	if c.stmts == nil {
+		return parseQuery(query)
+	}
+	return c.stmts.get(query)
+}
+
+// bindArgs returns query with its placeholders rewritten and args converted
+// to bind variables. Queries without arguments are sent as is.
+func (c *PsConn) bindArgs(query string, args []driver.NamedValue) (string, bindVars, error) {
+	if len(args) == 0 {
+		return query, nil, nil
+	}
+	return c.bindParsed(c.parseQuery(query), args)
+}
+
+// bindParsed binds args to q. With InterpolateParams set, the arguments are
+// inlined into the query and no bind variables are sent.
+func (c *PsConn) bindParsed(q parsedQuery, args []driver.NamedValue) (string, bindVars, error) {
+	binds, err := q.bind(args, c.cfg.location())
+	if err != nil {
+		return "", nil, err
+	}
+
+	if c.cfg.InterpolateParams {
+		return interpolate(q.query, binds), nil, nil
+	}
+	return q.query, binds, nil
+}
+
+// PsStmt is a prepared statement. The Execute API has no server-side
+// prepared statements, so preparing a query only parses its placeholders
+// ahead of time; each execution sends the query with bind variables.
+type PsStmt struct {
+	conn  *PsConn
+	query parsedQuery
+}
+
+var (
+	_ driver.Stmt             = (*PsStmt)(nil)
+	_ driver.StmtQueryContext = (*PsStmt)(nil)
+	_ driver.StmtExecContext  = (*PsStmt)(nil)
+)
+
+func (c *PsConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *PsConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return &PsStmt{conn: c, query: c.parseQuery(query)}, nil
+}
+
+func (s *PsStmt) Close() error {
+	return nil
+}
+
+// NumInput returns -1 since named arguments can be used alongside the
+// statement's ? placeholders. Argument counts are checked when binding.
+func (s *PsStmt) NumInput() int {
+	return -1
+}
+
+func (s *PsStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+func (s *PsStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+func (s *PsStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	release, err := s.conn.use()
+	defer release()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := withWriteDeadline(ctx, s.query.query)
+	defer cancel()
+
+	var res driver.Result
+	err = s.conn.withHooks(ctx, s.query.query, func(ctx context.Context) error {
+		q, binds, err := s.conn.bindParsed(s.query, args)
+		if err != nil {
+			return err
+		}
+		res, err = s.conn.exec(ctx, q, binds)
+		return err
+	})
+	return res, err
+}
+
+func (s *PsStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	release, err := s.conn.use()
+	defer release()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows driver.Rows
+	err = s.conn.withHooks(ctx, s.query.query, func(ctx context.Context) error {
+		q, binds, err := s.conn.bindParsed(s.query, args)
+		if err != nil {
+			return err
+		}
+		rows, err = s.conn.query(ctx, q, binds)
+		return err
+	})
+	return rows, err
+}
+
+// namedValues converts positional arguments from the legacy driver
+// interfaces.
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return named
+}
@@ -0,0 +1,59 @@
+package planetscale
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+)
+
+func TestStmtCacheEviction(t *testing.T) {
+	c := newStmtCache(2)
+	c.get("SELECT ?")
+	c.get("SELECT ?, ?")
+	c.get("SELECT ?")
+	c.get("SELECT ?, ?, ?")
+
+	if _, ok := c.items["SELECT ?, ?"]; ok {
+		t.Fatal("expected least recently used statement to be evicted")
+	}
+	for _, q := range []string{"SELECT ?", "SELECT ?, ?, ?"} {
+		if _, ok := c.items[q]; !ok {
+			t.Fatalf("expected %q to be cached", q)
+		}
+	}
+}
+
+func TestPreparedStatement(t *testing.T) {
+	var queries []string
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		v := parseJSON(t, string(body))
+		queries = append(queries, string(v.GetStringBytes("query"))+" "+string(v.GetStringBytes("bindVariables", "v1", "type")))
+		return 200, `{"session":{},"result":{"rowsAffected":"1"}}`
+	})
+
+	stmt, err := c.PrepareContext(context.Background(), "UPDATE t SET x = ? WHERE id = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+
+	for _, v := range []driver.Value{"a", int64(1)} {
+		res, err := stmt.(driver.StmtExecContext).ExecContext(context.Background(), []driver.NamedValue{{Ordinal: 1, Value: v}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, _ := res.RowsAffected(); n != 1 {
+			t.Fatalf("expected 1 row affected, got %d", n)
+		}
+	}
+
+	// The first request creates the session.
+	want := []string{"UPDATE t SET x = :v1 WHERE id = 1 VARCHAR", "UPDATE t SET x = :v1 WHERE id = 1 INT64"}
+	if got := queries[1:]; len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	if _, ok := c.stmts.items["UPDATE t SET x = ? WHERE id = 1"]; !ok {
+		t.Fatal("expected prepared statement to be cached")
+	}
+}
@@ -0,0 +1,360 @@
+package planetscale
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// encodedRow is a row as the Execute API encodes it: the values of all
+// columns concatenated, and the length of each.
+type encodedRow struct {
+	Lengths []json.Number `json:"lengths"`
+	Values  []byte        `json:"values"`
+}
+
+// jsonRow is an encodedRow as JSON encodes it, with the values still base64
+// encoded, so they can be decoded into the buffer of the previous row for
+// Config.ZeroCopyRows.
+type jsonRow struct {
+	Lengths []json.Number   `json:"lengths"`
+	Values  json.RawMessage `json:"values"`
+}
+
+// decode decodes the row into row, overwriting the values of the row that
+// was previously decoded into it.
+func (j *jsonRow) decode(row *encodedRow) error {
+	row.Lengths = append(row.Lengths[:0], j.Lengths...)
+
+	src := j.Values
+	if len(src) == 0 || string(src) == "null" {
+		row.Values = row.Values[:0]
+		return nil
+	}
+	if len(src) < 2 || src[0] != '"' || src[len(src)-1] != '"' || bytes.IndexByte(src, '\\') >= 0 {
+		// Escaped base64 is left to encoding/json.
+		return json.Unmarshal(src, &row.Values)
+	}
+	src = src[1 : len(src)-1]
+
+	n := base64.StdEncoding.DecodedLen(len(src))
+	if cap(row.Values) < n {
+		row.Values = make([]byte, n)
+	}
+	n, err := base64.StdEncoding.Decode(row.Values[:n], src)
+	if err != nil {
+		return &ProtocolError{Msg: "invalid row values", Err: err}
+	}
+	row.Values = row.Values[:n]
+	return nil
+}
+
+// rowSource reads the rows of a result from a response as they are needed.
+type rowSource interface {
+	// nextRow decodes the next row into row and reports whether there was
+	// one.
+	nextRow(row *encodedRow) (bool, error)
+
+	// hasNextResultSet reports whether another result set follows the
+	// current one, once its rows have been read.
+	hasNextResultSet() bool
+
+	// nextResultSet discards the rest of the current result set and returns
+	// the fields and warnings of the next one, or io.EOF if there is none.
+	nextResultSet() ([]PsField, []string, error)
+
+	close() error
+}
+
+var _ rowSource = (*responseStream)(nil)
+
+// responseStream decodes an Execute response as it is read from the body, so
+// a result's rows never have to be held in memory all at once.
+//
+// Reading stops at the start of the result's rows, which are then read one at
+// a time with nextRow. Everything after the rows is read once they run out.
+// Responses list the session before the result, so the connection's session
+// is up to date by the time the rows are reached.
+type responseStream struct {
+	ctx  context.Context
+	conn *PsConn
+	body io.ReadCloser
+	dec  *json.Decoder
+
+	fields     []PsField
+	jsonRow    jsonRow
+	hasFields  bool
+	hasSession bool
+	warnings   []string
+	inResult   bool
+	inRows     bool
+	sawResult  bool
+	done       bool
+
+	// cached is set for a result from the ResultCache, which is stored
+	// without its session, so StrictResponses doesn't require one.
+	cached bool
+
+	// timing and rowsAffected are read from the response for its
+	// QueryStats, which are recorded once it has been read to the end.
+	timing       float64
+	rowsAffected uint64
+}
+
+func newResponseStream(ctx context.Context, c *PsConn, body io.ReadCloser) *responseStream {
+	return &responseStream{ctx: ctx, conn: c, body: body, dec: json.NewDecoder(body)}
+}
+
+// start reads the response up to the start of its rows, or to its end if the
+// result has none. An error in the response is returned as an *Error.
+func (s *responseStream) start() error {
+	tok, err := s.dec.Token()
+	if err != nil {
+		return s.readErr(err)
+	}
+	if tok != json.Delim('{') {
+		return protocolErrorf("unexpected response: %v", tok)
+	}
+
+	if err := s.scan(); err != nil {
+		return err
+	}
+	if !s.sawResult {
+		return protocolErrorf("no result")
+	}
+	if s.conn.cfg.StrictResponses && !s.hasSession && !s.cached {
+		return protocolErrorf("no session")
+	}
+	return nil
+}
+
+// scan reads object members until it reaches the start of the rows or the
+// end of the response.
+func (s *responseStream) scan() error {
+	for !s.inRows && !s.done {
+		if !s.dec.More() {
+			// Consume the closing brace of the result or the response.
+			if _, err := s.dec.Token(); err != nil {
+				return s.readErr(err)
+			}
+			if s.inResult {
+				s.inResult = false
+			} else {
+				s.done = true
+				if !s.cached {
+					queryStatsFrom(s.ctx).addQuery(s.timing, s.rowsAffected)
+				}
+			}
+			continue
+		}
+
+		tok, err := s.dec.Token()
+		if err != nil {
+			return s.readErr(err)
+		}
+		key, _ := tok.(string)
+
+		if s.inResult {
+			err = s.resultMember(key)
+		} else {
+			err = s.responseMember(key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// responseMember reads the value of a top level member of the response.
+func (s *responseStream) responseMember(key string) error {
+	switch key {
+	case "result":
+		tok, err := s.dec.Token()
+		if err != nil {
+			return s.readErr(err)
+		}
+		if tok == nil {
+			return nil
+		}
+		if tok != json.Delim('{') {
+			return protocolErrorf("unexpected result: %v", tok)
+		}
+		s.inResult = true
+		s.sawResult = true
+		return nil
+	case "timing":
+		if err := s.dec.Decode(&s.timing); err != nil {
+			return s.readErr(err)
+		}
+		return nil
+	case "session", "error":
+		raw, err := s.raw()
+		if err != nil {
+			return err
+		}
+
+		p := parserPool.Get()
+		defer parserPool.Put(p)
+
+		v, err := p.ParseBytes(raw)
+		if err != nil {
+			return err
+		}
+		if key == "error" {
+			if v.GetObject() != nil {
+				return readError(v)
+			}
+			return nil
+		}
+		if v.GetObject() != nil {
+			s.conn.setSession(s.ctx, v)
+			s.warnings = readWarnings(v)
+			s.hasSession = true
+		}
+		return nil
+	default:
+		_, err := s.raw()
+		return err
+	}
+}
+
+// resultMember reads the value of a member of the response's result.
+func (s *responseStream) resultMember(key string) error {
+	switch key {
+	case "fields":
+		raw, err := s.raw()
+		if err != nil {
+			return err
+		}
+
+		p := parserPool.Get()
+		defer parserPool.Put(p)
+
+		v, err := p.ParseBytes(raw)
+		if err != nil {
+			return err
+		}
+		s.fields, err = s.conn.readFields(v)
+		if err != nil {
+			return err
+		}
+		s.hasFields = true
+		return nil
+	case "rowsAffected":
+		raw, err := s.raw()
+		if err != nil {
+			return err
+		}
+		s.rowsAffected, _ = strconv.ParseUint(strings.Trim(string(raw), `"`), 10, 64)
+		return nil
+	case "rows":
+		if !s.hasFields {
+			return protocolErrorf("missing fields")
+		}
+		tok, err := s.dec.Token()
+		if err != nil {
+			return s.readErr(err)
+		}
+		if tok == nil {
+			return nil
+		}
+		if tok != json.Delim('[') {
+			return protocolErrorf("unexpected rows: %v", tok)
+		}
+		s.inRows = true
+		return nil
+	default:
+		_, err := s.raw()
+		return err
+	}
+}
+
+// nextRow decodes the next row into row and reports whether there was one.
+// When the rows run out, the rest of the response is read, and an error that
+// follows the rows is returned.
+func (s *responseStream) nextRow(row *encodedRow) (bool, error) {
+	if !s.inRows {
+		return false, nil
+	}
+
+	if s.dec.More() {
+		if !s.conn.cfg.ZeroCopyRows {
+			*row = encodedRow{Lengths: row.Lengths[:0]}
+			if err := s.dec.Decode(row); err != nil {
+				return false, s.readErr(err)
+			}
+			return true, nil
+		}
+		s.jsonRow = jsonRow{Lengths: s.jsonRow.Lengths[:0], Values: s.jsonRow.Values[:0]}
+		if err := s.dec.Decode(&s.jsonRow); err != nil {
+			return false, s.readErr(err)
+		}
+		return true, s.jsonRow.decode(row)
+	}
+
+	// Consume the closing bracket of the rows.
+	if _, err := s.dec.Token(); err != nil {
+		return false, s.readErr(err)
+	}
+	s.inRows = false
+	return false, s.scan()
+}
+
+// hasNextResultSet reports false since an Execute response has a single
+// result.
+func (s *responseStream) hasNextResultSet() bool {
+	return false
+}
+
+func (s *responseStream) nextResultSet() ([]PsField, []string, error) {
+	return nil, nil, io.EOF
+}
+
+// close closes the response body. If the session hasn't been read yet, the
+// rest of the response is read first so the connection doesn't lose it.
+func (s *responseStream) close() error {
+	if !s.hasSession && !s.done {
+		var row encodedRow
+		for {
+			more, err := s.nextRow(&row)
+			if err != nil || !more {
+				break
+			}
+		}
+		if !s.done {
+			s.scan()
+		}
+	}
+	return s.body.Close()
+}
+
+// raw reads the next value as is.
+func (s *responseStream) raw() (json.RawMessage, error) {
+	var raw json.RawMessage
+	if err := s.dec.Decode(&raw); err != nil {
+		return nil, s.readErr(err)
+	}
+	return raw, nil
+}
+
+// readErr describes an error reading the response. A response that can't be
+// read to the end leaves the connection in an unknown state, unless it
+// failed because the context ended.
+func (s *responseStream) readErr(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	switch err.(type) {
+	case *json.SyntaxError, *json.UnmarshalTypeError:
+		return &ProtocolError{Msg: "malformed JSON", Err: err}
+	}
+	s.conn.bad = s.ctx.Err() == nil
+	return fmt.Errorf("planetscale API error reading response body: %w", err)
+}
@@ -0,0 +1,177 @@
+package planetscale
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+)
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+func TestRowsAreReadIncrementally(t *testing.T) {
+	c := largeResultConn(5000)
+	var body *countingReader
+	send := c.send
+	c.send = func(ctx context.Context, req *fsthttp.Request, backend string) (*fsthttp.Response, error) {
+		resp, err := send(ctx, req, backend)
+		if err != nil {
+			return nil, err
+		}
+		body = &countingReader{r: resp.Body}
+		resp.Body = io.NopCloser(body)
+		return resp, nil
+	}
+
+	rows, err := c.QueryContext(context.Background(), "SELECT id, name FROM t", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	dest := make([]driver.Value, 2)
+	if err := rows.Next(dest); err != nil {
+		t.Fatal(err)
+	}
+	if dest[1] != "some moderately long value for row 0" {
+		t.Fatalf("unexpected first row %q", dest[1])
+	}
+	if body.n > 64*1024 {
+		t.Fatalf("expected only the start of the response to be read, read %d bytes", body.n)
+	}
+
+	n := 1
+	for rows.Next(dest) == nil {
+		n++
+	}
+	if n != 5000 {
+		t.Fatalf("expected 5000 rows, got %d", n)
+	}
+}
+
+func TestSessionAfterRows(t *testing.T) {
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		return 200, `{"result":{"fields":[{"name":"n","type":"VARCHAR"}],"rows":` + threeRows + `},
+			"session":{"vitessSession":{"SessionUUID":"s2"}}}`
+	})
+	c.session = []byte(`{"vitessSession":{"SessionUUID":"s1"}}`)
+
+	rows, err := c.QueryContext(context.Background(), "SELECT n FROM t", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if c.sessionID != "s2" {
+		t.Fatalf("expected the session after the rows to be kept, got %q", c.sessionID)
+	}
+}
+
+func TestTruncatedResponse(t *testing.T) {
+	resp := `{"session":{},"result":{"fields":[{"name":"n","type":"VARCHAR"}],"rows":` + threeRows + `}}`
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		if strings.HasSuffix(endpoint, sessionPath) {
+			return 200, `{"session":{}}`
+		}
+		return 200, resp[:strings.Index(resp, "Mw==")]
+	})
+
+	rows, err := c.QueryContext(context.Background(), "SELECT n FROM t", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := readValues(t, rows)
+	if err == nil {
+		t.Fatal("expected error reading a truncated response")
+	}
+	if len(values) != 2 {
+		t.Fatalf("expected the 2 complete rows before the error, got %d", len(values))
+	}
+	if !c.bad {
+		t.Fatal("expected connection to be marked bad")
+	}
+}
+
+func TestRowValueLifetime(t *testing.T) {
+	rows := `{"fields":[{"name":"b","type":"VARBINARY","charset":63}],"rows":[` +
+		rowJSON("aa") + `,` + rowJSON("bb") + `,` + rowJSON("cc") + `]}`
+	for _, stream := range []bool{false, true} {
+		for _, zeroCopy := range []bool{false, true} {
+			c := stubConn(func(endpoint string, body []byte) (int, string) {
+				if stream {
+					return 200, streamJSON(`{"result":`+rows+`}`, `{"session":{}}`)
+				}
+				return 200, `{"session":{},"result":` + rows + `}`
+			})
+			c.session = []byte(`{}`)
+			c.cfg.StreamExecute = stream
+			c.cfg.ZeroCopyRows = zeroCopy
+
+			results, err := c.QueryContext(context.Background(), "SELECT b FROM t", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var held [][]byte
+			dest := make([]driver.Value, 1)
+			for results.Next(dest) == nil {
+				held = append(held, dest[0].([]byte))
+			}
+			results.Close()
+
+			if string(held[len(held)-1]) != "cc" {
+				t.Errorf("stream %v zero copy %v: expected Close to leave the last row alone, got %q", stream, zeroCopy, held[len(held)-1])
+			}
+			got := string(bytes.Join(held, []byte(",")))
+			switch {
+			case !zeroCopy && got != "aa,bb,cc":
+				t.Errorf("stream %v: expected values to outlive their row, got %s", stream, got)
+			case zeroCopy && got != "cc,cc,cc":
+				t.Errorf("stream %v: expected rows to share a buffer, got %s", stream, got)
+			}
+		}
+	}
+}
+
+func TestZeroCopyRowsScan(t *testing.T) {
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		return 200, `{"session":{},"result":{"fields":[{"name":"b","type":"VARBINARY","charset":63}],"rows":[` +
+			rowJSON("aa") + `,` + rowJSON("bb") + `]}}`
+	})
+	c.cfg.ZeroCopyRows = true
+	db := sql.OpenDB(stubConnector{c})
+	defer db.Close()
+
+	rows, err := db.Query("SELECT b FROM t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var scanned [][]byte
+	for rows.Next() {
+		var b []byte
+		if err := rows.Scan(&b); err != nil {
+			t.Fatal(err)
+		}
+		scanned = append(scanned, b)
+	}
+	if got := string(bytes.Join(scanned, []byte(","))); got != "aa,bb" {
+		t.Fatalf("expected scanned values to be copies, got %s", got)
+	}
+}
@@ -0,0 +1,307 @@
+package planetscale
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+const (
+	streamExecutorPath       = "/StreamExecute"
+	connectStreamContentType = "application/connect+json"
+
+	// endStreamFlag marks the last message of a streaming response, which
+	// carries the stream's error, if any, instead of a result.
+	endStreamFlag = 0x02
+
+	// maxStreamMessage caps the length of a stream message when
+	// MaxResponseBytes isn't set, so a corrupt header can't make the driver
+	// allocate gigabytes before reading any of it.
+	maxStreamMessage = 64 << 20
+)
+
+// streamMessage is one message of a StreamExecute response. The first holds
+// the result's fields and the rest hold chunks of its rows. A message with
+// fields after that starts another result set, such as the next one returned
+// by a stored procedure.
+type streamMessage struct {
+	Session json.RawMessage `json:"session"`
+	Result  *struct {
+		Fields json.RawMessage   `json:"fields"`
+		Rows   []json.RawMessage `json:"rows"`
+	} `json:"result"`
+	Error  json.RawMessage `json:"error"`
+	Timing float64         `json:"timing"`
+}
+
+// chunkStream reads the rows of a StreamExecute response one message at a
+// time, so only a single chunk of rows is held in memory.
+//
+// Messages use the Connect protocol's envelope: a flags byte and a big
+// endian 32-bit length, followed by that many bytes of JSON.
+type chunkStream struct {
+	ctx  context.Context
+	conn *PsConn
+	body io.ReadCloser
+
+	fields     []PsField
+	hasFields  bool
+	nextFields []PsField
+	hasNext    bool
+	hasSession bool
+	warnings   []string
+	done       bool
+
+	// rows are the current chunk's rows as they appear in the message, JSON
+	// or protobuf query.Row messages, which nextRow decodes as it reaches
+	// them.
+	rows    [][]byte
+	proto   bool
+	pos     int
+	jsonRow jsonRow
+
+	// timing is the server-side timing of the messages so far.
+	timing float64
+}
+
+var _ rowSource = (*chunkStream)(nil)
+
+// envelope wraps a request body in the Connect protocol's envelope.
+func envelope(msg []byte) []byte {
+	b := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(b[1:], uint32(len(msg)))
+	return append(b, msg...)
+}
+
+func newChunkStream(ctx context.Context, c *PsConn, body io.ReadCloser) *chunkStream {
+	return &chunkStream{ctx: ctx, conn: c, body: body}
+}
+
+// start reads messages until the result's fields arrive or the stream ends.
+// A stream that ends without fields is an empty result.
+func (s *chunkStream) start() error {
+	for !s.hasFields && !s.done {
+		if err := s.readMessage(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readMessage reads the next message of the stream.
+func (s *chunkStream) readMessage() error {
+	var header [5]byte
+	if _, err := io.ReadFull(s.body, header[:]); err != nil {
+		return s.readErr(err)
+	}
+
+	n := int64(binary.BigEndian.Uint32(header[1:]))
+	if err := s.checkLength(n); err != nil {
+		s.conn.bad = true
+		return err
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(s.body, payload); err != nil {
+		return s.readErr(err)
+	}
+
+	// The end of a stream is always JSON, whatever the messages are.
+	if s.conn.useProtobuf() && header[0]&endStreamFlag == 0 {
+		return s.readProtoMessage(payload)
+	}
+
+	var msg streamMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return &ProtocolError{Msg: "malformed stream message", Err: err}
+	}
+
+	s.timing += msg.Timing
+	if header[0]&endStreamFlag != 0 {
+		s.done = true
+		queryStatsFrom(s.ctx).addQuery(s.timing, 0)
+	}
+
+	p := parserPool.Get()
+	defer parserPool.Put(p)
+
+	if len(msg.Session) > 0 {
+		v, err := p.ParseBytes(msg.Session)
+		if err != nil {
+			return err
+		}
+		if v.GetObject() != nil {
+			s.conn.setSession(s.ctx, v)
+			s.warnings = readWarnings(v)
+			s.hasSession = true
+		}
+	}
+
+	if len(msg.Error) > 0 {
+		v, err := p.ParseBytes(msg.Error)
+		if err != nil {
+			return err
+		}
+		if v.GetObject() != nil {
+			return readError(v)
+		}
+	}
+
+	if msg.Result != nil {
+		if len(msg.Result.Fields) > 0 {
+			v, err := p.ParseBytes(msg.Result.Fields)
+			if err != nil {
+				return err
+			}
+			fields, err := s.conn.readFields(v)
+			if err != nil {
+				return err
+			}
+			if s.hasFields {
+				s.nextFields, s.hasNext = fields, true
+			} else {
+				s.fields, s.hasFields = fields, true
+			}
+		}
+		s.rows, s.proto, s.pos = make([][]byte, len(msg.Result.Rows)), false, 0
+		for i, row := range msg.Result.Rows {
+			s.rows[i] = row
+		}
+	}
+
+	return nil
+}
+
+// readProtoMessage reads a message of a protobuf stream.
+func (s *chunkStream) readProtoMessage(payload []byte) error {
+	resp, err := decodeExecuteResponse(payload)
+	if err != nil {
+		return err
+	}
+	s.timing += resp.timing
+
+	if len(resp.session) > 0 {
+		if s.warnings, err = s.conn.setProtoSession(s.ctx, resp.session); err != nil {
+			return err
+		}
+		s.hasSession = true
+	}
+	if resp.err != nil {
+		return resp.err
+	}
+
+	if resp.hasResult {
+		if resp.hasFields {
+			if s.hasFields {
+				s.nextFields, s.hasNext = resp.fields, true
+			} else {
+				s.fields, s.hasFields = resp.fields, true
+			}
+		}
+		s.rows, s.proto, s.pos = resp.rows, true, 0
+	}
+	return nil
+}
+
+func (s *chunkStream) nextRow(row *encodedRow) (bool, error) {
+	for {
+		// The rows of the next result set wait for nextResultSet.
+		if s.hasNext {
+			return false, nil
+		}
+		if s.pos < len(s.rows) {
+			break
+		}
+		if s.done {
+			return false, nil
+		}
+
+		s.rows, s.pos = nil, 0
+		if err := s.readMessage(); err != nil {
+			return false, err
+		}
+	}
+
+	if s.proto {
+		if err := decodeProtoRow(s.rows[s.pos], row); err != nil {
+			return false, err
+		}
+	} else if s.conn.cfg.ZeroCopyRows {
+		s.jsonRow = jsonRow{Lengths: s.jsonRow.Lengths[:0], Values: s.jsonRow.Values[:0]}
+		if err := json.Unmarshal(s.rows[s.pos], &s.jsonRow); err != nil {
+			return false, err
+		}
+		if err := s.jsonRow.decode(row); err != nil {
+			return false, err
+		}
+	} else {
+		*row = encodedRow{Lengths: row.Lengths[:0]}
+		if err := json.Unmarshal(s.rows[s.pos], row); err != nil {
+			return false, err
+		}
+	}
+	s.pos++
+	return true, nil
+}
+
+func (s *chunkStream) hasNextResultSet() bool {
+	return s.hasNext
+}
+
+func (s *chunkStream) nextResultSet() ([]PsField, []string, error) {
+	var row encodedRow
+	for {
+		more, err := s.nextRow(&row)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !more {
+			break
+		}
+	}
+
+	if !s.hasNext {
+		return nil, nil, io.EOF
+	}
+	s.fields, s.nextFields, s.hasNext = s.nextFields, nil, false
+	return s.fields, s.warnings, nil
+}
+
+// close closes the response body. If no message has carried the session
+// yet, the rest of the stream is read first so the connection doesn't lose
+// it.
+func (s *chunkStream) close() error {
+	for !s.hasSession && !s.done {
+		if err := s.readMessage(); err != nil {
+			break
+		}
+	}
+	return s.body.Close()
+}
+
+// readErr describes an error reading the stream. A stream that can't be
+// read to the end leaves the connection in an unknown state, unless it
+// failed because the context ended.
+// checkLength reports an error if a message of n bytes is larger than the
+// response may be, before its payload is allocated.
+func (s *chunkStream) checkLength(n int64) error {
+	if limit := s.conn.cfg.MaxResponseBytes; limit > 0 {
+		if n > int64(limit) {
+			return fmt.Errorf("%w: limit is %d bytes, stream message is %d", ErrMaxResponseBytes, limit, n)
+		}
+		return nil
+	}
+	if n > maxStreamMessage {
+		return protocolErrorf("stream message of %d bytes exceeds the %d byte maximum", n, maxStreamMessage)
+	}
+	return nil
+}
+
+func (s *chunkStream) readErr(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	s.conn.bad = s.ctx.Err() == nil
+	return fmt.Errorf("planetscale API error reading response body: %w", err)
+}
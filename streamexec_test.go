@@ -0,0 +1,180 @@
+package planetscale
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// streamJSON encodes msgs as a StreamExecute response, the last one marked as
+// the end of the stream.
+func streamJSON(msgs ...string) string {
+	var b []byte
+	for i, msg := range msgs {
+		b = append(b, envelope([]byte(msg))...)
+		if i == len(msgs)-1 {
+			b[len(b)-len(msg)-5] = endStreamFlag
+		}
+	}
+	return string(b)
+}
+
+func TestStreamExecute(t *testing.T) {
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		if strings.HasSuffix(endpoint, sessionPath) {
+			return 200, `{"session":{"vitessSession":{"SessionUUID":"s1"}}}`
+		}
+		if !strings.HasSuffix(endpoint, streamExecutorPath) {
+			t.Errorf("unexpected endpoint %s", endpoint)
+		}
+		if n := binary.BigEndian.Uint32(body[1:5]); int(n) != len(body)-5 || body[0] != 0 {
+			t.Errorf("request body not enveloped: % x", body[:5])
+		}
+		if !bytes.Contains(body, []byte(`"query":"SELECT n FROM t"`)) {
+			t.Errorf("unexpected request body %s", body)
+		}
+		return 200, streamJSON(
+			`{"result":{"fields":[{"name":"n","type":"VARCHAR"}]}}`,
+			`{"result":{"rows":[`+rowJSON("1")+`,`+rowJSON("2")+`]}}`,
+			`{"result":{"rows":[`+rowJSON("3")+`]}}`,
+			`{"session":{"vitessSession":{"SessionUUID":"s2"}}}`,
+		)
+	})
+	c.cfg.StreamExecute = true
+
+	rows, err := c.QueryContext(context.Background(), "SELECT n FROM t", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := readValues(t, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(values, ","); got != "1,2,3" {
+		t.Fatalf("expected rows 1,2,3, got %s", got)
+	}
+	if c.sessionID != "s2" {
+		t.Fatalf("expected the session from the end of the stream, got %q", c.sessionID)
+	}
+}
+
+func TestStreamExecuteError(t *testing.T) {
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		if strings.HasSuffix(endpoint, sessionPath) {
+			return 200, `{"session":{}}`
+		}
+		return 200, streamJSON(
+			`{"result":{"fields":[{"name":"n","type":"VARCHAR"}],"rows":[`+rowJSON("1")+`]}}`,
+			`{"error":{"message":"Query execution was interrupted (errno 1317) (sqlstate 70100)"}}`,
+		)
+	})
+	c.cfg.StreamExecute = true
+
+	rows, err := c.QueryContext(context.Background(), "SELECT n FROM t", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := readValues(t, rows)
+	var psErr *Error
+	if !errors.As(err, &psErr) || psErr.Code != 1317 {
+		t.Fatalf("expected error 1317 after the first chunk, got %v", err)
+	}
+	if len(values) != 1 {
+		t.Fatalf("expected 1 row before the error, got %d", len(values))
+	}
+}
+
+func TestStreamExecuteOversizedMessage(t *testing.T) {
+	for _, limit := range []int{0, 1 << 20} {
+		c := stubConn(func(endpoint string, body []byte) (int, string) {
+			if strings.HasSuffix(endpoint, sessionPath) {
+				return 200, `{"session":{}}`
+			}
+			// A header claiming a 4 GiB message, without the message.
+			return 200, "\x00\xff\xff\xff\xff"
+		})
+		c.cfg.StreamExecute = true
+		c.cfg.MaxResponseBytes = limit
+
+		_, err := c.QueryContext(context.Background(), "SELECT n FROM t", nil)
+		var protoErr *ProtocolError
+		switch {
+		case limit > 0 && !errors.Is(err, ErrMaxResponseBytes):
+			t.Fatalf("expected ErrMaxResponseBytes, got %v", err)
+		case limit == 0 && !errors.As(err, &protoErr):
+			t.Fatalf("expected a ProtocolError, got %v", err)
+		}
+		if !c.bad {
+			t.Fatal("expected the connection to be marked bad")
+		}
+	}
+}
+
+func TestParseDSNStreamExecute(t *testing.T) {
+	cfg, err := ParseDSN("host=example.com&streamExecute=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.StreamExecute {
+		t.Fatal("expected StreamExecute to be set")
+	}
+}
+
+func TestStreamExecuteResultSets(t *testing.T) {
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		if strings.HasSuffix(endpoint, sessionPath) {
+			return 200, `{"session":{}}`
+		}
+		return 200, streamJSON(
+			`{"result":{"fields":[{"name":"a","type":"VARCHAR"}],"rows":[`+rowJSON("1")+`,`+rowJSON("2")+`]}}`,
+			`{"result":{"fields":[{"name":"b","type":"VARCHAR"}],"rows":[`+rowJSON("3")+`]}}`,
+			`{"result":{"rows":[`+rowJSON("4")+`]}}`,
+			`{"result":{"fields":[{"name":"c","type":"VARCHAR"}]}}`,
+			`{"session":{}}`,
+		)
+	})
+	c.cfg.StreamExecute = true
+
+	rows, err := c.QueryContext(context.Background(), "CALL p()", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := rows.(*PsResults)
+
+	var sets []string
+	for {
+		values, err := readValues(t, nopCloser{r})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sets = append(sets, r.Columns()[0]+"="+strings.Join(values, ","))
+
+		if !r.HasNextResultSet() {
+			break
+		}
+		if err := r.NextResultSet(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.NextResultSet(); err != io.EOF {
+		t.Fatalf("expected io.EOF after the last result set, got %v", err)
+	}
+
+	if got, want := strings.Join(sets, "; "), "a=1,2; b=3,4; c="; got != want {
+		t.Fatalf("expected result sets %q, got %q", want, got)
+	}
+}
+
+// nopCloser keeps readValues from closing rows between result sets.
+type nopCloser struct {
+	driver.Rows
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
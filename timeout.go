@@ -0,0 +1,88 @@
+package planetscale
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type queryTimeoutKey struct{}
+
+// WithQueryTimeout returns a context that limits the queries run with it to
+// d, so a single slow query can't outlast the Compute instance's execution
+// limit. SELECT statements are sent with a MAX_EXECUTION_TIME optimizer hint
+// of d, unless they have one, so MySQL aborts them once it passes. Other
+// statements run with ExecContext or Client.Execute, and multi-statement
+// queries that include one, get a deadline of d instead, since MySQL can't
+// interrupt them; a write that misses it may still complete.
+func WithQueryTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, queryTimeoutKey{}, d)
+}
+
+// queryTimeout returns the query timeout of ctx, or zero if it has none.
+func queryTimeout(ctx context.Context) time.Duration {
+	d, _ := ctx.Value(queryTimeoutKey{}).(time.Duration)
+	return d
+}
+
+// withWriteDeadline returns a context that ends once the query timeout of
+// ctx passes if any of query's statements isn't a SELECT, which would be
+// given an execution time hint instead, and the function that releases it.
+func withWriteDeadline(ctx context.Context, query string) (context.Context, context.CancelFunc) {
+	d := queryTimeout(ctx)
+	if d <= 0 || !hasWrite(splitStatements(query)) {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// hasWrite reports whether any of stmts isn't a SELECT.
+func hasWrite(stmts []string) bool {
+	for _, stmt := range stmts {
+		if selectKeyword(stmt) < 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// selectKeyword returns the offset of the SELECT keyword query starts with,
+// after any leading comments, or -1 if it isn't a SELECT.
+func selectKeyword(query string) int {
+	rest := skipLeadingComments(query)
+	if len(rest) < 6 || !strings.EqualFold(rest[:6], "SELECT") {
+		return -1
+	}
+	if len(rest) > 6 && isIdentByte(rest[6]) {
+		return -1
+	}
+	return len(query) - len(rest)
+}
+
+// addExecutionTime adds a MAX_EXECUTION_TIME hint of d to query if it is a
+// SELECT without one. MySQL only reads a single hint comment per statement,
+// so the hint joins one that directly follows SELECT.
+func addExecutionTime(query string, d time.Duration) string {
+	if d <= 0 {
+		return query
+	}
+	i := selectKeyword(query)
+	if i < 0 || strings.Contains(strings.ToUpper(query), "MAX_EXECUTION_TIME") {
+		return query
+	}
+
+	ms := d.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	hint := "MAX_EXECUTION_TIME(" + strconv.FormatInt(ms, 10) + ")"
+
+	i += len("SELECT")
+	rest := strings.TrimLeft(query[i:], " \t\r\n")
+	if strings.HasPrefix(rest, "/*+") {
+		j := len(query) - len(rest) + len("/*+")
+		return query[:j] + " " + hint + query[j:]
+	}
+	return query[:i] + " /*+ " + hint + " */" + query[i:]
+}
@@ -0,0 +1,77 @@
+package planetscale
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+)
+
+func TestAddExecutionTime(t *testing.T) {
+	for query, want := range map[string]string{
+		"SELECT 1":                               "SELECT /*+ MAX_EXECUTION_TIME(1500) */ 1",
+		"select * from t":                        "select /*+ MAX_EXECUTION_TIME(1500) */ * from t",
+		"/* app */ SELECT 1":                     "/* app */ SELECT /*+ MAX_EXECUTION_TIME(1500) */ 1",
+		"SELECT /*+ BKA(t) */ * FROM t":          "SELECT /*+ MAX_EXECUTION_TIME(1500) BKA(t) */ * FROM t",
+		"SELECT /*+ MAX_EXECUTION_TIME(10) */ 1": "SELECT /*+ MAX_EXECUTION_TIME(10) */ 1",
+		"SELECTED":                               "SELECTED",
+		"UPDATE t SET n = 1":                     "UPDATE t SET n = 1",
+		"SHOW TABLES":                            "SHOW TABLES",
+	} {
+		if got := addExecutionTime(query, 1500*time.Millisecond); got != want {
+			t.Errorf("%q: expected %q, got %q", query, want, got)
+		}
+	}
+
+	if got := addExecutionTime("SELECT 1", 0); got != "SELECT 1" {
+		t.Errorf("expected no hint without a timeout, got %q", got)
+	}
+	if got := addExecutionTime("SELECT 1", time.Microsecond); got != "SELECT /*+ MAX_EXECUTION_TIME(1) */ 1" {
+		t.Errorf("expected a timeout under a millisecond to round up, got %q", got)
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	var queries []string
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		queries = append(queries, parseJSON(t, string(body)).Get("query").String())
+		return 200, `{"session":{},"result":{"rowsAffected":"1"}}`
+	})
+	c.session = []byte(`{}`)
+	stub := c.send
+	c.send = func(ctx context.Context, req *fsthttp.Request, backend string) (*fsthttp.Response, error) {
+		if _, ok := ctx.Deadline(); ok {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return stub(ctx, req, backend)
+	}
+
+	ctx := WithQueryTimeout(context.Background(), 20*time.Millisecond)
+	if _, err := c.ExecContext(ctx, "SELECT 1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := `"SELECT /*+ MAX_EXECUTION_TIME(20) */ 1"`; len(queries) != 1 || queries[0] != want {
+		t.Fatalf("expected %s, got %v", want, queries)
+	}
+
+	if _, err := c.ExecContext(ctx, "UPDATE t SET n = 1", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the write to miss its deadline, got %v", err)
+	}
+	if _, err := c.ExecContext(ctx, "SELECT 1; UPDATE t SET n = 1", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a write after a SELECT to miss its deadline, got %v", err)
+	}
+
+	stmt, err := c.PrepareContext(ctx, "UPDATE t SET n = ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+	args := []driver.NamedValue{{Ordinal: 1, Value: int64(1)}}
+	if _, err := stmt.(driver.StmtExecContext).ExecContext(ctx, args); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the prepared write to miss its deadline, got %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package planetscale
+
+import (
+	"context"
+	"strings"
+)
+
+// Tracer starts spans around the driver's API calls: one named
+// "planetscale.CreateSession" for each session created and one named
+// "planetscale.Execute" for each query. Spans are annotated with
+// db.system, db.statement, server.address, http.status_code and, for
+// queries, db.rows_returned once the rows are closed.
+//
+// The interface is small so the driver doesn't depend on OpenTelemetry. An
+// OpenTelemetry adapter is:
+//
+//	type otelTracer struct{ trace.Tracer }
+//
+//	func (t otelTracer) Start(ctx context.Context, name string, attrs ...planetscale.Attribute) (context.Context, planetscale.Span) {
+//		ctx, span := t.Tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+//		s := otelSpan{span}
+//		s.SetAttributes(attrs...)
+//		return ctx, s
+//	}
+//
+//	type otelSpan struct{ trace.Span }
+//
+//	func (s otelSpan) SetAttributes(attrs ...planetscale.Attribute) {
+//		for _, a := range attrs {
+//			s.Span.SetAttributes(attribute.String(a.Key, fmt.Sprint(a.Value)))
+//		}
+//	}
+//
+//	func (s otelSpan) RecordError(err error) {
+//		s.Span.RecordError(err)
+//		s.Span.SetStatus(codes.Error, err.Error())
+//	}
+//
+//	func (s otelSpan) End() { s.Span.End() }
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// Attribute is a key and value annotating a span. Values are strings or
+// ints.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...Attribute) {}
+func (noopSpan) RecordError(error)          {}
+func (noopSpan) End()                       {}
+
+// startSpan starts a span for an API call, running query if it isn't empty.
+// Without a Tracer it returns a span that does nothing.
+func (c *PsConn) startSpan(ctx context.Context, name, query string) (context.Context, Span) {
+	if c.cfg.Tracer == nil {
+		return ctx, noopSpan{}
+	}
+
+	attrs := []Attribute{
+		{Key: "db.system", Value: "mysql"},
+		{Key: "server.address", Value: c.currentEndpoint().Host},
+	}
+	if c.cfg.Database != "" {
+		attrs = append(attrs, Attribute{Key: "db.name", Value: c.cfg.Database})
+	}
+	if query != "" {
+		if c.cfg.RedactStatements || c.cfg.RedactQueries {
+			query = redactStatement(query)
+		}
+		attrs = append(attrs, Attribute{Key: "db.statement", Value: query})
+	}
+	return c.cfg.Tracer.Start(ctx, name, attrs...)
+}
+
+// annotateSpan records the HTTP status of the connection's last response on
+// span, and err if it isn't nil.
+func (c *PsConn) annotateSpan(span Span, err error) {
+	if c.status != 0 {
+		span.SetAttributes(Attribute{Key: "http.status_code", Value: c.status})
+	}
+	if err != nil {
+		span.RecordError(c.redactError(err))
+	}
+}
+
+// endSpan annotates span and ends it.
+func (c *PsConn) endSpan(span Span, err error) {
+	c.annotateSpan(span, err)
+	span.End()
+}
+
+// redactStatement replaces the string and number literals in query with ?,
+// so a statement can be traced without the values in it.
+func redactStatement(query string) string {
+	var b strings.Builder
+	b.Grow(len(query))
+
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		if end := skipLiteral(query, i); end > i {
+			if ch == '\'' || ch == '"' {
+				b.WriteByte('?')
+			} else {
+				b.WriteString(query[i:end])
+			}
+			i = end - 1
+			continue
+		}
+
+		// A number not preceded by part of an identifier, such as t1.
+		if ch >= '0' && ch <= '9' && (i == 0 || !isIdentByte(query[i-1])) {
+			for i+1 < len(query) && (isIdentByte(query[i+1]) || query[i+1] == '.') {
+				i++
+			}
+			b.WriteByte('?')
+			continue
+		}
+		b.WriteByte(ch)
+	}
+
+	return b.String()
+}
+
+func isIdentByte(ch byte) bool {
+	return ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' || ch == '_' || ch == '$'
+}
@@ -0,0 +1,79 @@
+package planetscale
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+type recordedSpan struct {
+	name  string
+	attrs map[string]interface{}
+	err   error
+	ended bool
+}
+
+type recordingTracer struct {
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	s := &recordedSpan{name: name, attrs: make(map[string]interface{})}
+	s.SetAttributes(attrs...)
+	t.spans = append(t.spans, s)
+	return ctx, s
+}
+
+func (s *recordedSpan) SetAttributes(attrs ...Attribute) {
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *recordedSpan) RecordError(err error) { s.err = err }
+func (s *recordedSpan) End()                  { s.ended = true }
+
+func TestTracing(t *testing.T) {
+	tracer := &recordingTracer{}
+	c := threeRowsConn(Config{})
+	c.cfg.Tracer, c.cfg.RedactStatements = tracer, true
+
+	rows, err := c.QueryContext(context.Background(), "SELECT n FROM t WHERE name = 'bob' AND id > 10", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readValues(t, rows); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tracer.spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(tracer.spans))
+	}
+	// The session is created within the query's span.
+	query, session := tracer.spans[0], tracer.spans[1]
+	if session.name != "planetscale.CreateSession" || !session.ended {
+		t.Fatalf("unexpected session span %+v", session)
+	}
+
+	if query.name != "planetscale.Execute" || !query.ended {
+		t.Fatalf("unexpected query span %+v", query)
+	}
+	for key, want := range map[string]interface{}{
+		"db.system":        "mysql",
+		"db.statement":     "SELECT n FROM t WHERE name = ? AND id > ?",
+		"server.address":   "example.com",
+		"http.status_code": 200,
+		"db.rows_returned": 3,
+	} {
+		if got := query.attrs[key]; fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("expected %s %v, got %v", key, want, got)
+		}
+	}
+}
+
+func TestRedactStatement(t *testing.T) {
+	got := redactStatement("SELECT `col1`, t2.a FROM t2 WHERE x = \"s\" AND y IN (1, 2.5) /* 3 */")
+	if want := "SELECT `col1`, t2.a FROM t2 WHERE x = ? AND y IN (?, ?) /* 3 */"; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
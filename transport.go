@@ -0,0 +1,43 @@
+package planetscale
+
+import (
+	"context"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+)
+
+// Transport sends the driver's requests to the API. Requests are built as
+// fsthttp requests, which can be used outside Compute, and sent to the named
+// Fastly backend by FastlyTransport, the default. HTTPTransport sends them
+// with net/http instead, so code using the driver can run in local
+// development and tests.
+type Transport interface {
+	Send(ctx context.Context, req *fsthttp.Request, backend string) (*fsthttp.Response, error)
+}
+
+// TransportFunc is a function that is a Transport.
+type TransportFunc func(ctx context.Context, req *fsthttp.Request, backend string) (*fsthttp.Response, error)
+
+func (f TransportFunc) Send(ctx context.Context, req *fsthttp.Request, backend string) (*fsthttp.Response, error) {
+	return f(ctx, req, backend)
+}
+
+// FastlyTransport sends requests through Fastly backends from within
+// Compute.
+type FastlyTransport struct{}
+
+func (FastlyTransport) Send(ctx context.Context, req *fsthttp.Request, backend string) (*fsthttp.Response, error) {
+	return req.Send(ctx, backend)
+}
+
+// transport returns the function the connection sends requests with.
+func (c *PsConn) transport() sendFunc {
+	switch {
+	case c.send != nil:
+		return c.send
+	case c.cfg.Transport != nil:
+		return c.cfg.Transport.Send
+	default:
+		return FastlyTransport{}.Send
+	}
+}
@@ -0,0 +1,116 @@
+//go:build !tinygo
+
+package planetscale
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+)
+
+// HTTPTransport sends requests with net/http, ignoring their backend, for
+// running the driver outside Compute. It isn't available when building with
+// TinyGo.
+type HTTPTransport struct {
+	// Client sends the requests. It defaults to http.DefaultClient.
+	Client *http.Client
+
+	// BaseURL, if set, replaces the scheme and host requests are sent to,
+	// such as with the URL of a local test server.
+	BaseURL *url.URL
+}
+
+func (t HTTPTransport) Send(ctx context.Context, req *fsthttp.Request, backend string) (*fsthttp.Response, error) {
+	u := *req.URL
+	if t.BaseURL != nil {
+		u.Scheme, u.Host = t.BaseURL.Scheme, t.BaseURL.Host
+	}
+
+	hreq, err := http.NewRequestWithContext(ctx, req.Method, u.String(), req.Body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range req.Header {
+		if key == "Host" {
+			continue
+		}
+		for _, v := range values {
+			hreq.Header.Add(key, v)
+		}
+	}
+	if host := req.Header.Get("Host"); host != "" && t.BaseURL == nil {
+		hreq.Host = host
+	}
+
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	hresp, err := client.Do(hreq)
+	if err != nil {
+		return nil, err
+	}
+
+	header := fsthttp.NewHeader()
+	for key, values := range hresp.Header {
+		for _, v := range values {
+			header.Add(key, v)
+		}
+	}
+	return &fsthttp.Response{
+		Request:    req,
+		Backend:    backend,
+		StatusCode: hresp.StatusCode,
+		Header:     header,
+		Body:       hresp.Body,
+	}, nil
+}
+
+// tlsVersions maps TLSOptions.MinVersion to the crypto/tls versions.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSConfig returns a crypto/tls configuration that applies the options,
+// for the Client of an HTTPTransport to connect like a backend registered
+// with them would.
+func (o TLSOptions) TLSConfig() (*tls.Config, error) {
+	if err := validTLSVersion(o.MinVersion); err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{MinVersion: tlsVersions[o.MinVersion], ServerName: o.SNIHostname}
+
+	if o.CACertificate != "" {
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM([]byte(o.CACertificate)) {
+			return nil, errors.New("invalid CA certificate")
+		}
+	}
+
+	if o.CertHostname != "" {
+		// The certificate is verified against CertHostname rather than the
+		// server name.
+		roots := cfg.RootCAs
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("no server certificate")
+			}
+			opts := x509.VerifyOptions{DNSName: o.CertHostname, Roots: roots, Intermediates: x509.NewCertPool()}
+			for _, cert := range cs.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			_, err := cs.PeerCertificates[0].Verify(opts)
+			return err
+		}
+	}
+	return cfg, nil
+}
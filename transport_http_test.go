@@ -0,0 +1,89 @@
+//go:build !tinygo
+
+package planetscale
+
+import (
+	"context"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestHTTPTransport(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if _, _, ok := r.BasicAuth(); !ok || r.Header.Get("Content-Type") != jsonContentType {
+			t.Errorf("unexpected headers %v", r.Header)
+		}
+		io.Copy(io.Discard, r.Body)
+		io.WriteString(w, `{"session":{},"result":{"fields":[{"name":"n","type":"VARCHAR"}],"rows":`+threeRows+`}}`)
+	}))
+	defer srv.Close()
+
+	base, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newConn(Config{
+		Username:  "user",
+		Password:  "pass",
+		Host:      "aws.connect.psdb.cloud",
+		Transport: HTTPTransport{Client: srv.Client(), BaseURL: base},
+	})
+
+	rows, err := c.QueryContext(context.Background(), "SELECT n FROM t", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := readValues(t, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(values) != 3 {
+		t.Fatalf("expected 3 rows, got %q", values)
+	}
+	if len(paths) != 2 || paths[1] != defaultAPIPrefix+executorPath {
+		t.Fatalf("unexpected requests %q", paths)
+	}
+}
+
+func TestTLSOptionsConfig(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	ca := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+	get := func(opts TLSOptions) error {
+		cfg, err := opts.TLSConfig()
+		if err != nil {
+			return err
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+		resp, err := client.Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	if err := get(TLSOptions{}); err == nil {
+		t.Fatal("expected the test server's certificate to be untrusted by default")
+	}
+	if err := get(TLSOptions{CACertificate: ca, MinVersion: "1.3"}); err != nil {
+		t.Fatalf("expected the pinned CA to be trusted, got %v", err)
+	}
+	if err := get(TLSOptions{CACertificate: ca, CertHostname: "example.com"}); err != nil {
+		t.Fatalf("expected the certificate to be valid for example.com, got %v", err)
+	}
+	if err := get(TLSOptions{CACertificate: ca, CertHostname: "planetscale.com"}); err == nil {
+		t.Fatal("expected the certificate to be rejected for another host")
+	}
+
+	if _, err := (TLSOptions{CACertificate: "nope"}).TLSConfig(); err == nil {
+		t.Fatal("expected an invalid CA certificate to be rejected")
+	}
+}
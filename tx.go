@@ -0,0 +1,158 @@
+package planetscale
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+)
+
+// PsTx is a transaction on a connection's session. Vitess keeps the
+// transaction open on the session, so BEGIN, COMMIT and ROLLBACK are plain
+// statements executed like any other.
+type PsTx struct {
+	conn *PsConn
+}
+
+var (
+	_ driver.Tx          = (*PsTx)(nil)
+	_ driver.ConnBeginTx = (*PsConn)(nil)
+)
+
+// errTxSessionExpired is returned for statements in a transaction whose
+// session expired, which rolled the transaction back.
+var errTxSessionExpired = fmt.Errorf("transaction aborted: session expired")
+
+var isolationLevels = map[sql.IsolationLevel]string{
+	sql.LevelReadUncommitted: "READ UNCOMMITTED",
+	sql.LevelReadCommitted:   "READ COMMITTED",
+	sql.LevelRepeatableRead:  "REPEATABLE READ",
+	sql.LevelSerializable:    "SERIALIZABLE",
+}
+
+func (c *PsConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+// BeginTx starts a transaction. A non-default isolation level is set with
+// SET TRANSACTION ISOLATION LEVEL, which applies to the next transaction
+// only, and read-only transactions are started with START TRANSACTION READ
+// ONLY. Transactions run on the primary, since vtgate doesn't let one switch
+// to another tablet type, so the session is switched to it first on a
+// connection whose target is a replica.
+func (c *PsConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	release, err := c.use()
+	defer release()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.inTx {
+		return nil, fmt.Errorf("transaction already in progress")
+	}
+
+	if err := c.route(WithPrimary(ctx)); err != nil {
+		return nil, err
+	}
+
+	if level := sql.IsolationLevel(opts.Isolation); level != sql.LevelDefault {
+		name, ok := isolationLevels[level]
+		if !ok {
+			return nil, fmt.Errorf("unsupported isolation level %s", level)
+		}
+		if err := c.run(ctx, "SET TRANSACTION ISOLATION LEVEL "+name); err != nil {
+			return nil, err
+		}
+	}
+
+	begin := "BEGIN"
+	if opts.ReadOnly {
+		begin = "START TRANSACTION READ ONLY"
+	}
+	if err := c.run(ctx, begin); err != nil {
+		return nil, err
+	}
+
+	c.inTx = true
+	return &PsTx{conn: c}, nil
+}
+
+func (tx *PsTx) Commit() error {
+	return tx.end("COMMIT")
+}
+
+func (tx *PsTx) Rollback() error {
+	return tx.end("ROLLBACK")
+}
+
+func (tx *PsTx) end(stmt string) error {
+	release, err := tx.conn.use()
+	defer release()
+	if err != nil {
+		return err
+	}
+
+	if !tx.conn.inTx {
+		return fmt.Errorf("transaction already finished")
+	}
+
+	tx.conn.inTx = false
+	if tx.conn.session == nil {
+		return errTxSessionExpired
+	}
+	return tx.conn.run(context.Background(), stmt)
+}
+
+// Savepoint creates a savepoint named name in the transaction.
+func (tx *PsTx) Savepoint(ctx context.Context, name string) error {
+	return tx.savepoint(ctx, "SAVEPOINT ", name)
+}
+
+// RollbackTo rolls the transaction back to the savepoint named name, leaving
+// the transaction open.
+func (tx *PsTx) RollbackTo(ctx context.Context, name string) error {
+	return tx.savepoint(ctx, "ROLLBACK TO SAVEPOINT ", name)
+}
+
+// ReleaseSavepoint removes the savepoint named name without rolling back.
+func (tx *PsTx) ReleaseSavepoint(ctx context.Context, name string) error {
+	return tx.savepoint(ctx, "RELEASE SAVEPOINT ", name)
+}
+
+func (tx *PsTx) savepoint(ctx context.Context, stmt, name string) error {
+	release, err := tx.conn.use()
+	defer release()
+	if err != nil {
+		return err
+	}
+
+	if !tx.conn.inTx {
+		return fmt.Errorf("transaction already finished")
+	}
+	return tx.conn.run(ctx, stmt+quoteIdentifier(name))
+}
+
+// Execer is implemented by *sql.Tx.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// Savepoint creates a savepoint in a transaction started with database/sql,
+// which doesn't expose the underlying PsTx. Savepoints are session state, so
+// running the statements through tx works the same as the PsTx methods.
+func Savepoint(ctx context.Context, tx Execer, name string) error {
+	_, err := tx.ExecContext(ctx, "SAVEPOINT "+quoteIdentifier(name))
+	return err
+}
+
+// RollbackToSavepoint is the database/sql counterpart of PsTx.RollbackTo.
+func RollbackToSavepoint(ctx context.Context, tx Execer, name string) error {
+	_, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+quoteIdentifier(name))
+	return err
+}
+
+// ReleaseSavepoint is the database/sql counterpart of PsTx.ReleaseSavepoint.
+func ReleaseSavepoint(ctx context.Context, tx Execer, name string) error {
+	_, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT "+quoteIdentifier(name))
+	return err
+}
@@ -0,0 +1,203 @@
+package planetscale
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"testing"
+)
+
+// recordingConn returns a connection that records the query of every
+// Execute request and answers it with an empty result.
+func recordingConn(t *testing.T, queries *[]string) *PsConn {
+	return stubConn(func(endpoint string, body []byte) (int, string) {
+		if strings.HasSuffix(endpoint, sessionPath) {
+			return 200, `{"session":{"signature":"abc"}}`
+		}
+		*queries = append(*queries, string(parseJSON(t, string(body)).GetStringBytes("query")))
+		return 200, `{"session":{"signature":"abc"},"result":{}}`
+	})
+}
+
+func TestTransactionCommit(t *testing.T) {
+	var queries []string
+	c := recordingConn(t, &queries)
+
+	tx, err := c.BeginTx(context.Background(), driver.TxOptions{
+		Isolation: driver.IsolationLevel(sql.LevelSerializable),
+		ReadOnly:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.BeginTx(context.Background(), driver.TxOptions{}); err == nil {
+		t.Fatal("expected error starting a nested transaction")
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(); err == nil {
+		t.Fatal("expected error rolling back a committed transaction")
+	}
+
+	want := "SET TRANSACTION ISOLATION LEVEL SERIALIZABLE; START TRANSACTION READ ONLY; COMMIT"
+	if got := strings.Join(queries, "; "); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestTransactionRollback(t *testing.T) {
+	var queries []string
+	c := recordingConn(t, &queries)
+
+	tx, err := c.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(queries, "; "); got != "BEGIN; ROLLBACK" {
+		t.Fatalf("unexpected queries %q", got)
+	}
+}
+
+func TestUnsupportedIsolationLevel(t *testing.T) {
+	var queries []string
+	c := recordingConn(t, &queries)
+
+	_, err := c.BeginTx(context.Background(), driver.TxOptions{Isolation: driver.IsolationLevel(sql.LevelLinearizable)})
+	if err == nil {
+		t.Fatal("expected error for unsupported isolation level")
+	}
+	if len(queries) != 0 {
+		t.Fatalf("expected no queries, got %v", queries)
+	}
+}
+
+func TestSavepoints(t *testing.T) {
+	var queries []string
+	c := recordingConn(t, &queries)
+	ctx := context.Background()
+
+	tx, err := c.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ptx := tx.(*PsTx)
+	if err := ptx.Savepoint(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ptx.RollbackTo(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ptx.ReleaseSavepoint(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ptx.Savepoint(ctx, "b"); err == nil {
+		t.Fatal("expected error creating a savepoint after commit")
+	}
+
+	want := "BEGIN; SAVEPOINT `a`; ROLLBACK TO SAVEPOINT `a`; RELEASE SAVEPOINT `a`; COMMIT"
+	if got := strings.Join(queries, "; "); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestSQLTxSavepoints(t *testing.T) {
+	var queries []string
+	db := sql.OpenDB(stubConnector{recordingConn(t, &queries)})
+	defer db.Close()
+	ctx := context.Background()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Savepoint(ctx, tx, "step`1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RollbackToSavepoint(ctx, tx, "step`1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReleaseSavepoint(ctx, tx, "step`1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "BEGIN; SAVEPOINT `step``1`; ROLLBACK TO SAVEPOINT `step``1`; RELEASE SAVEPOINT `step``1`; ROLLBACK"
+	if got := strings.Join(queries, "; "); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestTransactionSessionExpired(t *testing.T) {
+	var queries []string
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		if strings.HasSuffix(endpoint, sessionPath) {
+			return 200, `{"session":{"signature":"abc"}}`
+		}
+		query := string(parseJSON(t, string(body)).GetStringBytes("query"))
+		queries = append(queries, query)
+		if query == "UPDATE t SET a = 1" {
+			return 200, `{"error":{"message":"vtgate: session expired"}}`
+		}
+		return 200, `{"session":{"signature":"abc"},"result":{}}`
+	})
+
+	tx, err := c.BeginTx(context.Background(), driver.TxOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ExecContext(context.Background(), "UPDATE t SET a = 1", nil); err == nil {
+		t.Fatal("expected session expired error")
+	}
+	if _, err := c.ExecContext(context.Background(), "UPDATE t SET b = 1", nil); err != errTxSessionExpired {
+		t.Fatalf("expected errTxSessionExpired, got %v", err)
+	}
+	if err := tx.Commit(); err != errTxSessionExpired {
+		t.Fatalf("expected errTxSessionExpired, got %v", err)
+	}
+
+	// Nothing is replayed or committed on a new session.
+	want := "BEGIN; UPDATE t SET a = 1"
+	if got := strings.Join(queries, "; "); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestTransactionOnReplicaTarget(t *testing.T) {
+	var queries []string
+	c := recordingConn(t, &queries)
+	c.cfg.Target = "replica"
+
+	ctx := context.Background()
+	if _, err := c.QueryContext(ctx, "SELECT 1", nil); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := c.BeginTx(ctx, driver.TxOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ExecContext(WithReplica(ctx), "UPDATE t SET a = 1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.QueryContext(ctx, "SELECT 1", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "USE @replica; SELECT 1; USE @primary; BEGIN; UPDATE t SET a = 1; COMMIT; USE @replica; SELECT 1"
+	if got := strings.Join(queries, "; "); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
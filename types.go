@@ -0,0 +1,298 @@
+package planetscale
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// mysqlDateFormat is the layout of MySQL DATE values. DATETIME and
+// TIMESTAMP values use mysqlDatetimeFormat.
+const mysqlDateFormat = "2006-01-02"
+
+// convert turns the raw text of a value into the Go type database/sql
+// scanning expects for the column's type: int64 for integers, uint64 for
+// unsigned BIGINT, whose values don't all fit in an int64, float64 for
+// floating point, time.Time in loc for dates and timestamps, bool for BIT(1)
+// and string for text. go-sql-driver/mysql returns []byte for text columns
+// instead, which shows when scanning into an interface{} or a sql.Scanner.
+// DECIMAL values are strings too, since they can't be represented exactly as
+// a float64, unless decodeDecimal is set, which converts them instead.
+// Everything else, including binary, JSON and TIME columns, is returned as
+// the raw bytes, as are dates and timestamps if loc is nil.
+func (f PsField) convert(b []byte, loc *time.Location, decodeDecimal DecimalDecoder) (driver.Value, error) {
+	if f.text() {
+		return string(b), nil
+	}
+
+	switch f.Type {
+	case "INT8", "INT16", "INT24", "INT32", "INT64", "YEAR",
+		"UINT8", "UINT16", "UINT24", "UINT32":
+		return strconv.ParseInt(string(b), 10, 64)
+	case "UINT64":
+		return strconv.ParseUint(string(b), 10, 64)
+	case "DECIMAL":
+		if decodeDecimal != nil {
+			return decodeDecimal(string(b))
+		}
+		return string(b), nil
+	case "FLOAT32", "FLOAT64":
+		return strconv.ParseFloat(string(b), 64)
+	case "DATE", "DATETIME", "TIMESTAMP":
+		if loc != nil {
+			return parseDatetime(b, loc)
+		}
+	case "BIT":
+		if f.ColumnLength == 1 && len(b) == 1 {
+			return b[0] == 1, nil
+		}
+	}
+	return b, nil
+}
+
+// DecimalDecoder converts the text of a DECIMAL value, such as "-12.50", to
+// the value Next returns for it, such as a decimal type. Values of a type
+// that implements sql.Scanner, or that database/sql can assign to the scan
+// destination, can be scanned directly.
+type DecimalDecoder func(text string) (driver.Value, error)
+
+// NullUint64 is a uint64 that may be NULL, which is the scan type of
+// nullable unsigned BIGINT columns. It implements sql.Scanner and
+// driver.Valuer.
+type NullUint64 struct {
+	Uint64 uint64
+	Valid  bool
+}
+
+// Scan implements sql.Scanner.
+func (n *NullUint64) Scan(value interface{}) error {
+	var err error
+	switch v := value.(type) {
+	case nil:
+		n.Uint64, n.Valid = 0, false
+		return nil
+	case uint64:
+		n.Uint64 = v
+	case int64:
+		if v < 0 {
+			return fmt.Errorf("cannot scan negative value %d into NullUint64", v)
+		}
+		n.Uint64 = uint64(v)
+	case []byte:
+		n.Uint64, err = strconv.ParseUint(string(v), 10, 64)
+	case string:
+		n.Uint64, err = strconv.ParseUint(v, 10, 64)
+	default:
+		return fmt.Errorf("cannot scan %T into NullUint64", value)
+	}
+	n.Valid = err == nil
+	return err
+}
+
+// Value implements driver.Valuer.
+func (n NullUint64) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return n.Uint64, nil
+}
+
+// parseDatetime parses a DATE, DATETIME or TIMESTAMP value in loc. MySQL's
+// zero dates can't be represented as a time.Time and are returned as the raw
+// bytes.
+func parseDatetime(b []byte, loc *time.Location) (driver.Value, error) {
+	s := string(b)
+	if len(s) >= len(mysqlDateFormat) && s[:4] == "0000" {
+		return b, nil
+	}
+
+	layout := mysqlDatetimeFormat
+	if len(s) == len(mysqlDateFormat) {
+		layout = mysqlDateFormat
+	}
+
+	return time.ParseInLocation(layout, s, loc)
+}
+
+// MySQL column flags reported in PsField.Flags.
+const (
+	flagNotNull  = 1
+	flagUnsigned = 32
+	flagBinary   = 128
+)
+
+// binaryCharset is the id of MySQL's binary character set, which columns of
+// bytes rather than characters have.
+const binaryCharset = 63
+
+// text reports whether the field holds characters rather than bytes. Vitess
+// gives binary strings their own types, such as VARBINARY, but the charset of
+// a text type is checked too, falling back to the binary flag if it isn't
+// reported, since an expression's result can be binary.
+func (f PsField) text() bool {
+	switch f.Type {
+	case "VARCHAR", "CHAR", "TEXT", "ENUM", "SET":
+	default:
+		return false
+	}
+	if f.Charset == 0 {
+		return f.Flags&flagBinary == 0
+	}
+	return f.Charset != binaryCharset
+}
+
+var (
+	_ driver.RowsColumnTypeDatabaseTypeName = (*PsResults)(nil)
+	_ driver.RowsColumnTypeScanType         = (*PsResults)(nil)
+	_ driver.RowsColumnTypeNullable         = (*PsResults)(nil)
+	_ driver.RowsColumnTypeLength           = (*PsResults)(nil)
+	_ driver.RowsColumnTypePrecisionScale   = (*PsResults)(nil)
+)
+
+// databaseTypeNames maps Vitess types to MySQL type names where they differ.
+var databaseTypeNames = map[string]string{
+	"INT8":    "TINYINT",
+	"UINT8":   "UNSIGNED TINYINT",
+	"INT16":   "SMALLINT",
+	"UINT16":  "UNSIGNED SMALLINT",
+	"INT24":   "MEDIUMINT",
+	"UINT24":  "UNSIGNED MEDIUMINT",
+	"INT32":   "INT",
+	"UINT32":  "UNSIGNED INT",
+	"INT64":   "BIGINT",
+	"UINT64":  "UNSIGNED BIGINT",
+	"FLOAT32": "FLOAT",
+	"FLOAT64": "DOUBLE",
+}
+
+var (
+	scanTypeInt64     = reflect.TypeOf(int64(0))
+	scanTypeUint64    = reflect.TypeOf(uint64(0))
+	scanTypeString    = reflect.TypeOf("")
+	scanTypeFloat64   = reflect.TypeOf(float64(0))
+	scanTypeTime      = reflect.TypeOf(time.Time{})
+	scanTypeBool      = reflect.TypeOf(false)
+	scanTypeNullInt   = reflect.TypeOf(sql.NullInt64{})
+	scanTypeNullUint  = reflect.TypeOf(NullUint64{})
+	scanTypeNullStr   = reflect.TypeOf(sql.NullString{})
+	scanTypeNullFloat = reflect.TypeOf(sql.NullFloat64{})
+	scanTypeNullTime  = reflect.TypeOf(sql.NullTime{})
+	scanTypeNullBool  = reflect.TypeOf(sql.NullBool{})
+	scanTypeRawBytes  = reflect.TypeOf(sql.RawBytes{})
+	scanTypeJSON      = reflect.TypeOf(json.RawMessage{})
+	scanTypeNullJSON  = reflect.TypeOf(NullJSON{})
+)
+
+func (f PsField) nullable() bool {
+	return f.Flags&flagNotNull == 0
+}
+
+// ColumnTypeDatabaseTypeName returns the MySQL name of the column's type,
+// such as "BIGINT" or "VARCHAR".
+func (r *PsResults) ColumnTypeDatabaseTypeName(index int) string {
+	t := r.Fields[index].Type
+	if name, ok := databaseTypeNames[t]; ok {
+		return name
+	}
+	return t
+}
+
+// ColumnTypeScanType returns the type Next produces for the column, or its
+// sql.Null counterpart if the column is nullable.
+func (r *PsResults) ColumnTypeScanType(index int) reflect.Type {
+	f := r.Fields[index]
+	null := f.nullable()
+
+	if f.text() {
+		if null {
+			return scanTypeNullStr
+		}
+		return scanTypeString
+	}
+
+	switch f.Type {
+	case "INT8", "INT16", "INT24", "INT32", "INT64", "YEAR",
+		"UINT8", "UINT16", "UINT24", "UINT32":
+		if null {
+			return scanTypeNullInt
+		}
+		return scanTypeInt64
+	case "UINT64":
+		if null {
+			return scanTypeNullUint
+		}
+		return scanTypeUint64
+	case "DECIMAL":
+		if r.decodeDecimal != nil {
+			break
+		}
+		if null {
+			return scanTypeNullStr
+		}
+		return scanTypeString
+	case "FLOAT32", "FLOAT64":
+		if null {
+			return scanTypeNullFloat
+		}
+		return scanTypeFloat64
+	case "DATE", "DATETIME", "TIMESTAMP":
+		if r.loc == nil {
+			break
+		}
+		if null {
+			return scanTypeNullTime
+		}
+		return scanTypeTime
+	case "BIT":
+		if f.ColumnLength == 1 {
+			if null {
+				return scanTypeNullBool
+			}
+			return scanTypeBool
+		}
+	case "JSON":
+		if null {
+			return scanTypeNullJSON
+		}
+		return scanTypeJSON
+	}
+	return scanTypeRawBytes
+}
+
+func (r *PsResults) ColumnTypeNullable(index int) (nullable, ok bool) {
+	return r.Fields[index].nullable(), true
+}
+
+// ColumnTypeLength returns the maximum length in bytes of variable length
+// text and binary columns.
+func (r *PsResults) ColumnTypeLength(index int) (length int64, ok bool) {
+	f := r.Fields[index]
+	switch f.Type {
+	case "VARCHAR", "VARBINARY", "CHAR", "BINARY", "TEXT", "BLOB", "JSON":
+		return int64(f.ColumnLength), true
+	}
+	return 0, false
+}
+
+// ColumnTypePrecisionScale returns the precision and scale of DECIMAL
+// columns. MySQL reports a DECIMAL(M,D) column's length as M plus one for the
+// decimal point when D > 0 and one for the sign when the column is signed.
+func (r *PsResults) ColumnTypePrecisionScale(index int) (precision, scale int64, ok bool) {
+	f := r.Fields[index]
+	if f.Type != "DECIMAL" {
+		return 0, 0, false
+	}
+
+	precision = int64(f.ColumnLength)
+	if f.Decimals > 0 {
+		precision--
+	}
+	if f.Flags&flagUnsigned == 0 {
+		precision--
+	}
+	return precision, int64(f.Decimals), true
+}
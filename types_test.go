@@ -0,0 +1,286 @@
+package planetscale
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJSONAndBlobValuesUntouched(t *testing.T) {
+	doc := `{"name":"日本語","tags":["a","b"],"nested":{"x":1.50}}`
+	blob := "\x00\x01\xff\x00bin\x00"
+
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		return 200, `{"session":{},"result":{
+			"fields":[{"name":"doc","type":"JSON"},{"name":"data","type":"BLOB","charset":63}],
+			"rows":[` + rowJSON(doc, blob) + `]}}`
+	})
+
+	rows, err := c.QueryContext(context.Background(), "SELECT doc, data FROM t", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	dest := make([]driver.Value, 2)
+	if err := rows.Next(dest); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range []string{doc, blob} {
+		got, ok := dest[i].([]byte)
+		if !ok {
+			t.Fatalf("column %d: expected []byte, got %T", i, dest[i])
+		}
+		if !bytes.Equal(got, []byte(want)) {
+			t.Fatalf("column %d: expected %q, got %q", i, want, got)
+		}
+	}
+}
+
+func TestConvertValues(t *testing.T) {
+	for _, tt := range []struct {
+		field PsField
+		raw   string
+		want  driver.Value
+	}{
+		{PsField{Type: "INT64"}, "-42", int64(-42)},
+		{PsField{Type: "UINT32"}, "42", int64(42)},
+		{PsField{Type: "UINT64"}, "42", uint64(42)},
+		{PsField{Type: "UINT64"}, "18446744073709551615", uint64(18446744073709551615)},
+		{PsField{Type: "YEAR"}, "2023", int64(2023)},
+		{PsField{Type: "FLOAT64"}, "1.25", 1.25},
+		{PsField{Type: "DATETIME"}, "2023-02-08 01:28:32", time.Date(2023, 2, 8, 1, 28, 32, 0, time.UTC)},
+		{PsField{Type: "TIMESTAMP"}, "2023-02-08 01:28:32.123456", time.Date(2023, 2, 8, 1, 28, 32, 123456000, time.UTC)},
+		{PsField{Type: "DATE"}, "2023-02-08", time.Date(2023, 2, 8, 0, 0, 0, 0, time.UTC)},
+		{PsField{Type: "DATE"}, "0000-00-00", []byte("0000-00-00")},
+		{PsField{Type: "BIT", ColumnLength: 1}, "\x01", true},
+		{PsField{Type: "DECIMAL"}, "1.10", "1.10"},
+		{PsField{Type: "DECIMAL"}, "-99999999999999999.99", "-99999999999999999.99"},
+		{PsField{Type: "VARCHAR"}, "hi", "hi"},
+		{PsField{Type: "VARCHAR", Charset: 255}, "hi", "hi"},
+		{PsField{Type: "VARCHAR", Charset: binaryCharset}, "hi", []byte("hi")},
+		{PsField{Type: "TEXT", Flags: flagBinary}, "hi", []byte("hi")},
+		{PsField{Type: "TEXT", Charset: 255, Flags: flagBinary}, "hi", "hi"},
+		{PsField{Type: "ENUM"}, "a", "a"},
+		{PsField{Type: "VARBINARY"}, "hi", []byte("hi")},
+		{PsField{Type: "BLOB", Charset: binaryCharset}, "hi", []byte("hi")},
+	} {
+		got, err := tt.field.convert([]byte(tt.raw), time.UTC, nil)
+		if err != nil {
+			t.Fatalf("%s %q: %v", tt.field.Type, tt.raw, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %q: expected %#v, got %#v", tt.field.Type, tt.raw, tt.want, got)
+		}
+	}
+
+	if _, err := (PsField{Type: "INT64"}).convert([]byte("nope"), time.UTC, nil); err == nil {
+		t.Fatal("expected error converting an invalid integer")
+	}
+}
+
+func TestScanConvertedValues(t *testing.T) {
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		return 200, `{"session":{},"result":{
+			"fields":[{"name":"id","type":"INT64"},{"name":"score","type":"FLOAT64"},{"name":"created","type":"DATETIME"}],
+			"rows":[` + rowJSON("7", "9.5", "2023-02-08 01:28:32") + `]}}`
+	})
+	db := sql.OpenDB(stubConnector{c})
+	defer db.Close()
+
+	var (
+		id      int64
+		score   float64
+		created time.Time
+	)
+	err := db.QueryRow("SELECT id, score, created FROM t").Scan(&id, &score, &created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 7 || score != 9.5 || !created.Equal(time.Date(2023, 2, 8, 1, 28, 32, 0, time.UTC)) {
+		t.Fatalf("unexpected values %d %v %v", id, score, created)
+	}
+}
+
+func TestUnsignedAndDecimalValues(t *testing.T) {
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		return 200, `{"session":{},"result":{
+			"fields":[{"name":"id","type":"UINT64","flags":33},{"name":"n","type":"UINT64","flags":32},{"name":"price","type":"DECIMAL"}],
+			"rows":[{"lengths":["20","-1","20"],"values":"MTg0NDY3NDQwNzM3MDk1NTE2MTUxMjM0NTY3ODkwMTIzNDU2Ny44OQ=="}]}}`
+	})
+	db := sql.OpenDB(stubConnector{c})
+	defer db.Close()
+
+	var (
+		id    uint64
+		n     NullUint64
+		price string
+	)
+	if err := db.QueryRow("SELECT id, n, price FROM t").Scan(&id, &n, &price); err != nil {
+		t.Fatal(err)
+	}
+	if id != 18446744073709551615 || n.Valid || price != "12345678901234567.89" {
+		t.Fatalf("unexpected values %d %+v %q", id, n, price)
+	}
+
+	type decimal struct{ text string }
+	c.cfg.DecodeDecimal = func(text string) (driver.Value, error) {
+		return decimal{text}, nil
+	}
+	rows, err := c.QueryContext(context.Background(), "SELECT id, n, price FROM t", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	dest := make([]driver.Value, 3)
+	if err := rows.Next(dest); err != nil {
+		t.Fatal(err)
+	}
+	if dest[2] != (decimal{"12345678901234567.89"}) {
+		t.Fatalf("expected decoded decimal, got %#v", dest[2])
+	}
+	if st := rows.(*PsResults).ColumnTypeScanType(1); st != reflect.TypeOf(NullUint64{}) {
+		t.Fatalf("expected NullUint64 scan type, got %v", st)
+	}
+}
+
+func TestUnsignedArguments(t *testing.T) {
+	var typ string
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		typ = string(parseJSON(t, string(body)).GetStringBytes("bindVariables", "v1", "type"))
+		return 200, `{"session":{},"result":{"rowsAffected":"1"}}`
+	})
+	db := sql.OpenDB(stubConnector{c})
+	defer db.Close()
+
+	for _, arg := range []interface{}{uint64(1 << 63), NullUint64{Uint64: 1 << 63, Valid: true}} {
+		if _, err := db.Exec("UPDATE t SET n = ?", arg); err != nil {
+			t.Fatalf("%T: %v", arg, err)
+		}
+		if typ != "UINT64" {
+			t.Fatalf("%T: expected UINT64 bind variable, got %s", arg, typ)
+		}
+	}
+}
+
+func TestColumnTypes(t *testing.T) {
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		return 200, `{"session":{},"result":{"fields":[
+			{"name":"id","type":"INT64","flags":515},
+			{"name":"name","type":"VARCHAR","columnLength":1020},
+			{"name":"price","type":"DECIMAL","columnLength":12,"decimals":2,"flags":1},
+			{"name":"created","type":"DATETIME"},
+			{"name":"data","type":"VARBINARY","charset":63}
+		],"rows":[]}}`
+	})
+	db := sql.OpenDB(stubConnector{c})
+	defer db.Close()
+
+	rows, err := db.Query("SELECT id, name, price, created, data FROM t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range []struct {
+		name     string
+		scanType reflect.Type
+		nullable bool
+	}{
+		{"BIGINT", reflect.TypeOf(int64(0)), false},
+		{"VARCHAR", reflect.TypeOf(sql.NullString{}), true},
+		{"DECIMAL", reflect.TypeOf(""), false},
+		{"DATETIME", reflect.TypeOf(sql.NullTime{}), true},
+		{"VARBINARY", reflect.TypeOf(sql.RawBytes{}), true},
+	} {
+		ct := types[i]
+		if ct.DatabaseTypeName() != want.name {
+			t.Errorf("column %d: expected type %s, got %s", i, want.name, ct.DatabaseTypeName())
+		}
+		if ct.ScanType() != want.scanType {
+			t.Errorf("column %d: expected scan type %v, got %v", i, want.scanType, ct.ScanType())
+		}
+		if nullable, ok := ct.Nullable(); !ok || nullable != want.nullable {
+			t.Errorf("column %d: expected nullable %v, got %v", i, want.nullable, nullable)
+		}
+	}
+
+	if length, ok := types[1].Length(); !ok || length != 1020 {
+		t.Errorf("expected length 1020, got %d", length)
+	}
+	if _, ok := types[0].Length(); ok {
+		t.Error("expected no length for BIGINT")
+	}
+	if p, s, ok := types[2].DecimalSize(); !ok || p != 10 || s != 2 {
+		t.Errorf("expected DECIMAL(10,2), got (%d,%d)", p, s)
+	}
+}
+
+func TestParseTimeOptions(t *testing.T) {
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		return 200, `{"session":{},"result":{"fields":[{"name":"t","type":"DATETIME"}],"rows":[` + rowJSON("2023-02-08 01:28:32") + `]}}`
+	})
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	dest := make([]driver.Value, 1)
+
+	c.cfg.Location = loc
+	rows, err := c.QueryContext(context.Background(), "SELECT t FROM x", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rows.Next(dest); err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2023, 2, 8, 1, 28, 32, 0, loc); !dest[0].(time.Time).Equal(want) {
+		t.Fatalf("expected %v, got %v", want, dest[0])
+	}
+	rows.Close()
+
+	c.cfg.NoParseTime = true
+	rows, err = c.QueryContext(context.Background(), "SELECT t FROM x", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rows.Next(dest); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := dest[0].([]byte); !ok || string(got) != "2023-02-08 01:28:32" {
+		t.Fatalf("expected raw text, got %#v", dest[0])
+	}
+	if st := rows.(*PsResults).ColumnTypeScanType(0); st != scanTypeRawBytes {
+		t.Fatalf("expected sql.RawBytes scan type, got %v", st)
+	}
+	rows.Close()
+}
+
+func TestScanTextAndBinaryIntoInterface(t *testing.T) {
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		return 200, `{"session":{},"result":{"fields":[
+			{"name":"name","type":"VARCHAR","charset":255},
+			{"name":"hash","type":"VARBINARY","charset":63}
+		],"rows":[` + rowJSON("日本語", "\x00\xff") + `]}}`
+	})
+	db := sql.OpenDB(stubConnector{c})
+	defer db.Close()
+
+	var name, hash interface{}
+	if err := db.QueryRow("SELECT name, hash FROM t").Scan(&name, &hash); err != nil {
+		t.Fatal(err)
+	}
+	if name != "日本語" {
+		t.Fatalf("expected a string for the text column, got %#v", name)
+	}
+	if b, ok := hash.([]byte); !ok || !bytes.Equal(b, []byte("\x00\xff")) {
+		t.Fatalf("expected []byte for the binary column, got %#v", hash)
+	}
+}
@@ -0,0 +1,124 @@
+package planetscale
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+
+	"github.com/valyala/fastjson"
+)
+
+// validateResponse checks that an Execute response is shaped like the API's,
+// for Config.StrictResponses: it has a session, and either an error, which
+// the caller reads, or a result whose fields and rows are well formed.
+func validateResponse(v *fastjson.Value) error {
+	if v.Type() != fastjson.TypeObject {
+		return protocolErrorf("response is a JSON %s", v.Type())
+	}
+	if session := v.Get("session"); session == nil || session.Type() != fastjson.TypeObject {
+		return protocolErrorf("no session")
+	}
+	if e := v.Get("error"); e != nil && e.Type() == fastjson.TypeObject {
+		return nil
+	}
+
+	result := v.Get("result")
+	if result == nil || result.Type() != fastjson.TypeObject {
+		return protocolErrorf("no result")
+	}
+
+	fields, rows := result.Get("fields"), result.Get("rows")
+	if fields == nil {
+		if len(result.GetArray("rows")) > 0 {
+			return protocolErrorf("rows without fields")
+		}
+		return nil
+	}
+	if err := validateFields(fields); err != nil {
+		return err
+	}
+	if rows == nil || rows.Type() == fastjson.TypeNull {
+		return nil
+	}
+	return validateRows(rows, len(fields.GetArray()))
+}
+
+// validateFields checks that each of a result's fields has a name and a
+// type.
+func validateFields(fields *fastjson.Value) error {
+	if fields.Type() != fastjson.TypeArray {
+		return protocolErrorf("fields are a JSON %s", fields.Type())
+	}
+	for i, f := range fields.GetArray() {
+		if f.Type() != fastjson.TypeObject {
+			return protocolErrorf("field %d is a JSON %s", i, f.Type())
+		}
+		if name := f.Get("name"); name == nil || name.Type() != fastjson.TypeString {
+			return protocolErrorf("field %d has no name", i)
+		}
+		if typ := f.Get("type"); typ == nil || typ.Type() != fastjson.TypeString || len(typ.GetStringBytes()) == 0 {
+			return protocolErrorf("field %d has no type", i)
+		}
+	}
+	return nil
+}
+
+// validateRows checks that each row has a length for each of the n columns
+// and that they add up to the size of its decoded values.
+func validateRows(rows *fastjson.Value, n int) error {
+	if rows.Type() != fastjson.TypeArray {
+		return protocolErrorf("rows are a JSON %s", rows.Type())
+	}
+	for i, r := range rows.GetArray() {
+		if r.Type() != fastjson.TypeObject {
+			return protocolErrorf("row %d is a JSON %s", i, r.Type())
+		}
+
+		lengths := r.GetArray("lengths")
+		if len(lengths) != n {
+			return protocolErrorf("row %d has %d lengths for %d columns", i, len(lengths), n)
+		}
+		var total int64
+		for j, l := range lengths {
+			if l.Type() != fastjson.TypeString {
+				return protocolErrorf("row %d column %d: length is a JSON %s", i, j, l.Type())
+			}
+			length, err := strconv.ParseInt(string(l.GetStringBytes()), 10, 64)
+			if err != nil || length < -1 {
+				return protocolErrorf("row %d column %d: invalid length %q", i, j, l.GetStringBytes())
+			}
+			if length > 0 {
+				total += length
+			}
+		}
+
+		values := r.Get("values")
+		if values == nil {
+			if total != 0 {
+				return protocolErrorf("row %d has no values for %d bytes of lengths", i, total)
+			}
+			continue
+		}
+		if values.Type() != fastjson.TypeString {
+			return protocolErrorf("row %d: values are a JSON %s", i, values.Type())
+		}
+		size := decodedLen(values.GetStringBytes())
+		if size < 0 {
+			return protocolErrorf("row %d: values aren't base64", i)
+		}
+		if size != total {
+			return protocolErrorf("row %d: lengths total %d bytes but values are %d bytes", i, total, size)
+		}
+	}
+	return nil
+}
+
+// decodedLen returns the size of the base64 encoded b once decoded, or -1
+// if b can't be valid base64.
+func decodedLen(b []byte) int64 {
+	s := string(b)
+	if len(s)%4 != 0 {
+		return -1
+	}
+	return int64(base64.StdEncoding.DecodedLen(len(s)) - (len(s) - len(strings.TrimRight(s, "="))))
+}
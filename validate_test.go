@@ -0,0 +1,76 @@
+package planetscale
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestStrictResponses(t *testing.T) {
+	for name, resp := range map[string]string{
+		"no session":       `{"result":{"rowsAffected":"1"}}`,
+		"no result":        `{"session":{}}`,
+		"untyped field":    `{"session":{},"result":{"fields":[{"name":"n"}],"rows":[]}}`,
+		"missing lengths":  `{"session":{},"result":{"fields":[{"name":"n","type":"INT64"}],"rows":[{"values":"MQ=="}]}}`,
+		"short values":     `{"session":{},"result":{"fields":[{"name":"n","type":"INT64"}],"rows":[{"lengths":["2"],"values":"MQ=="}]}}`,
+		"values not bytes": `{"session":{},"result":{"fields":[{"name":"n","type":"INT64"}],"rows":[{"lengths":["1"],"values":1}]}}`,
+		"rows not array":   `{"session":{},"result":{"fields":[{"name":"n","type":"INT64"}],"rows":{}}}`,
+	} {
+		c := stubConn(func(endpoint string, body []byte) (int, string) {
+			return 200, resp
+		})
+		c.session = []byte(`{}`)
+		c.cfg.StrictResponses = true
+
+		var protoErr *ProtocolError
+		if _, err := c.execOne(context.Background(), "SELECT n FROM t", nil); !errors.As(err, &protoErr) {
+			t.Errorf("%s: expected a *ProtocolError, got %v", name, err)
+		}
+	}
+
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		return 200, `{"session":{},"result":{"fields":[{"name":"n","type":"INT64"}],"rows":[` + rowJSON("1") + `,{"lengths":["-1"]}]}}`
+	})
+	c.session = []byte(`{}`)
+	c.cfg.StrictResponses = true
+	if _, err := c.execOne(context.Background(), "SELECT n FROM t", nil); err != nil {
+		t.Fatalf("expected a well formed response to pass, got %v", err)
+	}
+}
+
+func TestStrictStreamedResponses(t *testing.T) {
+	resp := `{"result":{"fields":[{"name":"n","type":"INT64"}],"rows":[` + rowJSON("1") + `]}}`
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		return 200, resp
+	})
+	c.session = []byte(`{}`)
+
+	rows, err := c.QueryContext(context.Background(), "SELECT n FROM t", nil)
+	if err != nil {
+		t.Fatalf("expected a response without a session to be read by default, got %v", err)
+	}
+	rows.Close()
+
+	c.cfg.StrictResponses = true
+	var protoErr *ProtocolError
+	if _, err := c.QueryContext(context.Background(), "SELECT n FROM t", nil); !errors.As(err, &protoErr) || protoErr.Msg != "no session" {
+		t.Fatalf("expected a no session *ProtocolError, got %v", err)
+	}
+
+	resp = `{"session":{},"result":{"fields":[{"type":"INT64"}],"rows":[]}}`
+	if _, err := c.QueryContext(context.Background(), "SELECT n FROM t", nil); !errors.As(err, &protoErr) {
+		t.Fatalf("expected a *ProtocolError for a field without a name, got %v", err)
+	}
+}
+
+func TestMalformedResponseIsProtocolError(t *testing.T) {
+	c := stubConn(func(endpoint string, body []byte) (int, string) {
+		return 200, `{"session":{},"result":{"rowsAff`
+	})
+	c.session = []byte(`{}`)
+
+	var protoErr *ProtocolError
+	if _, err := c.ExecContext(context.Background(), "UPDATE t SET n = 1", nil); !errors.As(err, &protoErr) {
+		t.Fatalf("expected a *ProtocolError, got %v", err)
+	}
+}